@@ -2,10 +2,12 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -16,6 +18,7 @@ import (
 	"time"
 
 	"toolbox/auth"
+	"toolbox/billing"
 	"toolbox/email"
 	"toolbox/tools"
 
@@ -33,6 +36,12 @@ func SetupRoutes(mux *http.ServeMux, database *sql.DB) {
 	// Configurar la base de datos en el paquete auth
 	auth.SetDB(database)
 
+	// Limitador de peticiones (RATE_LIMIT_*)
+	setupRateLimiter(database)
+
+	// Registro asíncrono del uso de las herramientas
+	startUsageRecorder(database)
+
 	// Authentication routes
 	mux.HandleFunc("/api/auth/request-magic-link", handleRequestMagicLink)
 	mux.HandleFunc("/api/auth/validate", handleValidateMagicLink)
@@ -51,17 +60,37 @@ func SetupRoutes(mux *http.ServeMux, database *sql.DB) {
 		}
 	})
 
-	// API Key deletion route (using DELETE method)
-	mux.HandleFunc("/api/keys/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodDelete {
-			handleDeleteAPIKey(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
+	// Revocación (DELETE), renombrado (PATCH) y rotación (POST .../rotate) de claves
+	mux.HandleFunc("/api/keys/", handleAPIKey)
 
 	// Ruta para herramientas como webfetch
 	mux.HandleFunc("/api/tool", handleTool)
+
+	// Trabajos asíncronos (crawl): estado, progreso, resultado y cancelación
+	mux.HandleFunc("/api/jobs", handleJobs)
+	mux.HandleFunc("/api/jobs/", handleJobs)
+	markInterruptedJobs()
+
+	// Monitores de cambios; el planificador se inicia con StartMonitorScheduler
+	mux.HandleFunc("/api/monitors", handleMonitors)
+	mux.HandleFunc("/api/monitors/", handleMonitors)
+
+	// Capturas guardadas por visual_diff
+	mux.HandleFunc("/api/artifacts/", handleArtifacts)
+
+	// Colecciones de documentos indexados (webfetch con "collection", búsqueda con collection_search)
+	mux.HandleFunc("/api/collections", handleCollections)
+	mux.HandleFunc("/api/collections/", handleCollections)
+
+	// Uso agregado por día, herramienta y clave
+	mux.HandleFunc("/api/usage", handleUsage)
+	mux.HandleFunc("/api/plan", handlePlan)
+
+	// Facturación con Stripe: Checkout, Customer Portal y webhooks
+	billingClient = billing.NewClient(database, billing.LoadConfig())
+	mux.HandleFunc("/api/billing/checkout", handleBillingCheckout)
+	mux.HandleFunc("/api/billing/portal", handleBillingPortal)
+	mux.HandleFunc("/api/billing/webhook", handleBillingWebhook)
 }
 
 // handleRequestMagicLink maneja la solicitud de un enlace mágico
@@ -98,6 +127,11 @@ func handleRequestMagicLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Limitar las solicitudes por IP y por email para evitar abusos del envío de correos
+	if !checkRateLimit(w, magicLinkRateBuckets(r, req.Email), 1) {
+		return
+	}
+
 	// Crear usuario si no existe
 	if err := auth.CreateUser(req.Email); err != nil {
 		errMsg := fmt.Sprintf("Error al crear usuario %s: %v", req.Email, err)
@@ -288,36 +322,95 @@ func getUserIDByEmail(email string) (int64, error) {
 	return userID, nil
 }
 
-// validateAPIKey valida una clave API y devuelve el email del usuario si es válida
-func validateAPIKey(key string) (string, error) {
+// authKey es la API key que autenticó una petición, cargada una sola vez
+type authKey struct {
+	ID             string
+	Scopes         []string // nil = acceso completo
+	RespectRobots  bool
+	SearchProvider string
+}
+
+// caller es el usuario autenticado de una petición y, si usó una API key, la
+// clave con la que lo hizo; las sesiones del dashboard (JWT) no tienen Key
+type caller struct {
+	Email  string
+	UserID int64
+	Key    *authKey
+}
+
+// scopes devuelve los permisos del llamante; nil significa acceso completo
+func (c *caller) scopes() []string {
+	if c.Key == nil {
+		return nil
+	}
+	return c.Key.Scopes
+}
+
+// keyID devuelve el ID de la API key usada, o "" en sesiones del dashboard
+func (c *caller) keyID() string {
+	if c.Key == nil {
+		return ""
+	}
+	return c.Key.ID
+}
+
+// validateAPIKey valida una clave API y devuelve su usuario y configuración si
+// es válida y la petición cumple sus restricciones de IP y origen
+func validateAPIKey(r *http.Request, key string) (*caller, error) {
 	// Verificar que la clave tenga el formato correcto
 	if !strings.HasPrefix(key, "tbx_") {
-		return "", fmt.Errorf("formato de clave API inválido")
+		return nil, fmt.Errorf("formato de clave API inválido")
 	}
 
-	var email string
+	c := &caller{Key: &authKey{}}
+	var scopes, searchProvider, allowedIPs, allowedOrigins sql.NullString
+	var respectRobots sql.NullBool
 	err := db.QueryRow(
-		"SELECT u.email FROM users u "+
-			"JOIN api_keys ak ON u.id = ak.user_id "+
-			"WHERE ak.key = ? AND (ak.revoked = 0 OR ak.revoked IS NULL)",
-		key,
-	).Scan(&email)
+		"SELECT u.email, u.id, ak.id, ak.scopes, ak.respect_robots, ak.search_provider, ak.allowed_ips, ak.allowed_origins "+
+			"FROM users u JOIN api_keys ak ON u.id = ak.user_id "+
+			"WHERE ak.key_hash = ? AND (ak.revoked = 0 OR ak.revoked IS NULL) "+
+			"AND (ak.expires_at IS NULL OR ak.expires_at > datetime('now'))",
+		auth.HashAPIKey(key),
+	).Scan(&c.Email, &c.UserID, &c.Key.ID, &scopes, &respectRobots, &searchProvider, &allowedIPs, &allowedOrigins)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", fmt.Errorf("clave API no válida o revocada")
+			return nil, fmt.Errorf("clave API no válida, revocada o caducada")
 		}
-		return "", fmt.Errorf("error validando la clave API: %v", err)
+		return nil, fmt.Errorf("error validando la clave API: %v", err)
+	}
+
+	if err := checkKeyRestrictions(r, strings.Fields(allowedIPs.String), strings.Fields(allowedOrigins.String)); err != nil {
+		return nil, err
 	}
 
+	if scopes.Valid {
+		c.Key.Scopes = strings.Fields(scopes.String)
+	}
+	c.Key.RespectRobots = respectRobots.Valid && respectRobots.Bool
+	c.Key.SearchProvider = searchProvider.String
+
 	// Actualizar last_used_at
-	_, err = db.Exec("UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE key = ?", key)
+	_, err = db.Exec("UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", c.Key.ID)
 	if err != nil {
 		log.Printf("Error actualizando last_used_at: %v", err)
 		// Continuamos a pesar del error, no es crítico
 	}
 
-	return email, nil
+	return c, nil
+}
+
+// validateSession valida un JWT del dashboard y devuelve su usuario
+func validateSession(token string) (*caller, error) {
+	claims, err := auth.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := getUserIDByEmail(claims.Email)
+	if err != nil {
+		return nil, err
+	}
+	return &caller{Email: claims.Email, UserID: userID}, nil
 }
 
 // handleGetCurrentUser maneja la solicitud para obtener el usuario actual
@@ -342,7 +435,7 @@ func handleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
 // handleCreateAPIKey maneja la creación de una nueva clave API
 func handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 	// Obtener el email del usuario autenticado
-	email, err := getAuthenticatedEmail(r)
+	who, err := authenticate(r)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
@@ -353,51 +446,120 @@ func handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Obtener el ID del usuario
-	userID, err := getUserIDByEmail(email)
+	// Gestionar claves con una API key requiere el permiso keys:manage
+	if !requireScope(w, who, scopeKeysManage) {
+		return
+	}
+
+	userID := who.UserID
+
+	// Leer las opciones de la clave (el cuerpo es opcional)
+	var options struct {
+		Name           string   `json:"name"`
+		Description    string   `json:"description"`
+		ExpiresAt      string   `json:"expires_at"`
+		RespectRobots  bool     `json:"respect_robots"`
+		SearchProvider string   `json:"search_provider"`
+		Scopes         []string `json:"scopes"`
+		AllowedIPs     []string `json:"allowed_ips"`
+		AllowedOrigins []string `json:"allowed_origins"`
+	}
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&options); err != nil && err != io.EOF {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "Solicitud inválida: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	options.Name = strings.TrimSpace(options.Name)
+	options.Description = strings.TrimSpace(options.Description)
+	if options.Name == "" {
+		options.Name = "Clave generada " + time.Now().Format("2006-01-02 15:04")
+	}
+	expiresAt, err := parseKeyExpiry(options.ExpiresAt)
+	if err == nil {
+		err = validateKeyName(options.Name, options.Description)
+	}
+	if err == nil {
+		options.AllowedIPs, err = normalizeAllowedIPs(options.AllowedIPs)
+	}
+	if err == nil {
+		options.AllowedOrigins, err = normalizeAllowedOrigins(options.AllowedOrigins)
+	}
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Error al obtener el ID de usuario",
+			"error":   err.Error(),
+			"code":    "invalid_key_options",
 		})
 		return
 	}
 
-	// Generar una nueva clave API
-	apiKey, err := generateAPIKey()
-	if err != nil {
+	if options.SearchProvider != "" && !tools.IsSearchProvider(options.SearchProvider) {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Error al generar la clave API",
+			"success":  false,
+			"error":    "Proveedor de búsqueda no válido",
+			"code":     "invalid_provider",
+			"accepted": tools.SearchProviderNames,
 		})
 		return
 	}
 
-	// Generar un ID único para la clave
-	keyID, err := generateRandomString(8)
-	if err != nil {
+	scopes, invalid := normalizeScopes(options.Scopes)
+	if invalid != "" {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Error al generar el ID de la clave",
+			"success":  false,
+			"error":    "Permiso no válido: " + invalid,
+			"code":     "invalid_scope",
+			"accepted": apiKeyScopeNames(),
 		})
 		return
 	}
 
-	// Insertar la nueva clave en la base de datos
-	_, err = db.Exec(
-		"INSERT INTO api_keys (id, user_id, name, key, created_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)",
-		keyID,
-		userID,
-		"Clave generada "+time.Now().Format("2006-01-02 15:04"),
-		apiKey,
-	)
+	// Una API key con permisos no puede crear claves con más permisos que ella
+	if callerScopes := who.scopes(); callerScopes != nil {
+		if len(scopes) == 0 {
+			scopes = callerScopes
+		}
+		for _, scope := range scopes {
+			if !hasScope(callerScopes, scope) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"success": false,
+					"error":   "La API key no puede conceder el permiso '" + scope + "'",
+					"code":    "insufficient_scope",
+					"scope":   scope,
+				})
+				return
+			}
+		}
+	}
+
+	record := &apiKeyRecord{
+		Name:           options.Name,
+		Description:    options.Description,
+		ExpiresAt:      expiresAt,
+		RespectRobots:  options.RespectRobots,
+		SearchProvider: options.SearchProvider,
+		Scopes:         scopes,
+		AllowedIPs:     options.AllowedIPs,
+		AllowedOrigins: options.AllowedOrigins,
+	}
+	keyID, apiKey, err := insertAPIKey(userID, record)
 	if err != nil {
+		log.Printf("Error al crear la clave API: %v", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -407,47 +569,61 @@ func handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Devolver la clave generada
+	// Devolver la clave generada: es la única vez que se muestra completa
+	response := map[string]interface{}{
+		"success":         true,
+		"key":             apiKey,
+		"prefix":          auth.APIKeyPrefix(apiKey),
+		"id":              keyID,
+		"name":            options.Name,
+		"description":     options.Description,
+		"respect_robots":  options.RespectRobots,
+		"search_provider": options.SearchProvider,
+		"scopes":          scopes,
+		"allowed_ips":     nonNilStrings(options.AllowedIPs),
+		"allowed_origins": nonNilStrings(options.AllowedOrigins),
+	}
+	if expiresAt != nil {
+		response["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"key":     apiKey,
-		"id":      keyID,
-	})
+	json.NewEncoder(w).Encode(response)
 }
 
-// handleDeleteAPIKey maneja la eliminación de una clave API
+// handleDeleteAPIKey revoca una clave API
 func handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
 	// Obtener el ID de la clave de la URL
-	keyID := strings.TrimPrefix(r.URL.Path, "/api/keys/")
+	keyID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/keys/"), "/")
 	if keyID == "" {
 		http.Error(w, "Se requiere el ID de la clave", http.StatusBadRequest)
 		return
 	}
 
 	// Obtener el email del usuario autenticado
-	email, err := getAuthenticatedEmail(r)
+	who, err := authenticate(r)
 	if err != nil {
 		http.Error(w, "No autorizado", http.StatusUnauthorized)
 		return
 	}
 
-	// Obtener el ID del usuario
-	userID, err := getUserIDByEmail(email)
-	if err != nil {
-		http.Error(w, "Error al obtener el ID de usuario", http.StatusInternalServerError)
+	// Gestionar claves con una API key requiere el permiso keys:manage
+	if !requireScope(w, who, scopeKeysManage) {
 		return
 	}
 
-	// Verificar que la clave pertenece al usuario y eliminarla
+	userID := who.UserID
+
+	// Verificar que la clave pertenece al usuario y revocarla; la fila se
+	// conserva para mantener el historial
 	result, err := db.Exec(
-		"DELETE FROM api_keys WHERE id = ? AND user_id = ?",
+		"UPDATE api_keys SET revoked = 1, revoked_at = CURRENT_TIMESTAMP "+
+			"WHERE id = ? AND user_id = ? AND (revoked = 0 OR revoked IS NULL)",
 		keyID,
 		userID,
 	)
 
 	if err != nil {
-		http.Error(w, "Error al eliminar la clave API", http.StatusInternalServerError)
+		http.Error(w, "Error al revocar la clave API", http.StatusInternalServerError)
 		return
 	}
 
@@ -459,13 +635,15 @@ func handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Clave no encontrada o no tienes permiso para eliminarla", http.StatusNotFound)
+		http.Error(w, "Clave no encontrada, ya revocada o no tienes permiso para revocarla", http.StatusNotFound)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{
+	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
+		"id":      keyID,
+		"revoked": true,
 	})
 }
 
@@ -494,7 +672,7 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
 
 func handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 	// Obtener el email del usuario autenticado
-	email, err := getAuthenticatedEmail(r)
+	who, err := authenticate(r)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
@@ -505,20 +683,23 @@ func handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Obtener el ID del usuario
-	userID, err := getUserIDByEmail(email)
-	if err != nil {
-		http.Error(w, "Error al obtener el ID de usuario", http.StatusInternalServerError)
+	// Gestionar claves con una API key requiere el permiso keys:manage
+	if !requireScope(w, who, scopeKeysManage) {
 		return
 	}
 
-	// Obtener las claves del usuario desde la base de datos
-	rows, err := db.Query(
-		"SELECT id, name, key, created_at, last_used_at "+
-			"FROM api_keys WHERE user_id = ? "+
-			"ORDER BY created_at DESC",
-		userID,
-	)
+	userID := who.UserID
+
+	// Obtener las claves del usuario desde la base de datos; las revocadas solo
+	// se incluyen con ?include_revoked=true
+	query := "SELECT id, name, description, key_prefix, created_at, last_used_at, expires_at, " +
+		"COALESCE(expires_at <= datetime('now'), 0), revoked, revoked_at, replaced_by, respect_robots, search_provider, scopes, " +
+		"allowed_ips, allowed_origins " +
+		"FROM api_keys WHERE user_id = ? "
+	if r.URL.Query().Get("include_revoked") != "true" {
+		query += "AND (revoked = 0 OR revoked IS NULL) "
+	}
+	rows, err := db.Query(query+"ORDER BY created_at DESC, rowid DESC", userID)
 	if err != nil {
 		log.Printf("Error al consultar claves API: %v", err)
 		http.Error(w, "Error al obtener las claves API", http.StatusInternalServerError)
@@ -529,24 +710,52 @@ func handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 	// Procesar los resultados
 	var keys []map[string]interface{}
 	for rows.Next() {
-		var id, name, key string
-		var createdAt, lastUsedAt sql.NullTime
-
-		if err := rows.Scan(&id, &name, &key, &createdAt, &lastUsedAt); err != nil {
+		var id, name, prefix string
+		var createdAt, lastUsedAt, expiresAt, revokedAt sql.NullTime
+		var expired bool
+		var revoked, respectRobots sql.NullBool
+		var description, replacedBy, searchProvider, scopes, allowedIPs, allowedOrigins sql.NullString
+
+		if err := rows.Scan(&id, &name, &description, &prefix, &createdAt, &lastUsedAt, &expiresAt, &expired,
+			&revoked, &revokedAt, &replacedBy, &respectRobots, &searchProvider, &scopes, &allowedIPs, &allowedOrigins); err != nil {
 			log.Printf("Error escaneando fila: %v", err)
 			continue
 		}
 
 		keyData := map[string]interface{}{
-			"id":         id,
-			"name":       name,
-			"created_at": createdAt.Time.Format(time.RFC3339),
+			"id":              id,
+			"name":            name,
+			"prefix":          prefix,
+			"created_at":      createdAt.Time.Format(time.RFC3339),
+			"respect_robots":  respectRobots.Valid && respectRobots.Bool,
+			"status":          "active",
+			"allowed_ips":     nonNilStrings(strings.Fields(allowedIPs.String)),
+			"allowed_origins": nonNilStrings(strings.Fields(allowedOrigins.String)),
 		}
-
-		// Solo incluir la clave si fue generada recientemente (últimos 5 minutos)
-		// y está en el almacenamiento local del navegador
-		if time.Since(createdAt.Time) < 5*time.Minute {
-			keyData["key"] = key
+		switch {
+		case revoked.Valid && revoked.Bool:
+			keyData["status"] = "revoked"
+		case expired:
+			keyData["status"] = "expired"
+		}
+		if description.Valid {
+			keyData["description"] = description.String
+		}
+		if expiresAt.Valid {
+			keyData["expires_at"] = expiresAt.Time.UTC().Format(time.RFC3339)
+		}
+		if revokedAt.Valid {
+			keyData["revoked_at"] = revokedAt.Time.UTC().Format(time.RFC3339)
+		}
+		if replacedBy.Valid {
+			keyData["replaced_by"] = replacedBy.String
+		}
+		if searchProvider.Valid {
+			keyData["search_provider"] = searchProvider.String
+		}
+		// Sin scopes la clave tiene acceso completo
+		if scopes.Valid {
+			keyData["scopes"] = strings.Fields(scopes.String)
 		}
 
 		if lastUsedAt.Valid {
@@ -569,10 +778,21 @@ func handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// getAuthenticatedEmail devuelve el email del usuario autenticado
 func getAuthenticatedEmail(r *http.Request) (string, error) {
+	c, err := authenticate(r)
+	if err != nil {
+		return "", err
+	}
+	return c.Email, nil
+}
+
+// authenticate identifica al llamante por el encabezado Authorization, la
+// cookie de sesión o el campo "token" del cuerpo JSON, en ese orden. Los
+// permisos se comprueban siempre contra la credencial devuelta aquí.
+func authenticate(r *http.Request) (*caller, error) {
 	// 1. Intentar obtener el token del encabezado Authorization
 	authHeader := r.Header.Get("Authorization")
-	// ... (rest of the code remains the same)
 	if authHeader != "" {
 		// Formato: "Bearer <token>"
 		headerParts := strings.Split(authHeader, " ")
@@ -580,19 +800,21 @@ func getAuthenticatedEmail(r *http.Request) (string, error) {
 			token := headerParts[1]
 
 			// Primero intentar validar como JWT
-			claims, err := auth.ValidateToken(token)
-			if err == nil {
-				return claims.Email, nil
+			if c, err := validateSession(token); err == nil {
+				return c, nil
 			}
 
 			// Si no es un JWT válido, intentar como API key
-			email, err := validateAPIKey(token)
+			c, err := validateAPIKey(r, token)
 			if err == nil {
-				return email, nil
+				return c, nil
+			}
+			if errors.Is(err, errKeyRestricted) {
+				return nil, err
 			}
 
 			// Si llegamos aquí, el token no es válido
-			return "", fmt.Errorf("invalid or expired token")
+			return nil, fmt.Errorf("invalid or expired token")
 		}
 	}
 
@@ -600,9 +822,8 @@ func getAuthenticatedEmail(r *http.Request) (string, error) {
 	cookie, err := r.Cookie("session_token")
 	if err == nil && cookie != nil && cookie.Value != "" {
 		// Validar el token JWT de la cookie
-		claims, err := auth.ValidateToken(cookie.Value)
-		if err == nil {
-			return claims.Email, nil
+		if c, err := validateSession(cookie.Value); err == nil {
+			return c, nil
 		}
 	}
 
@@ -619,23 +840,29 @@ func getAuthenticatedEmail(r *http.Request) (string, error) {
 
 		if err := json.Unmarshal(bodyBytes, &body); err == nil && body.Token != "" {
 			// Primero intentar como JWT
-			claims, err := auth.ValidateToken(body.Token)
-			if err == nil {
-				return claims.Email, nil
+			if c, err := validateSession(body.Token); err == nil {
+				return c, nil
 			}
 
 			// Luego intentar como API key
-			email, err := validateAPIKey(body.Token)
+			c, err := validateAPIKey(r, body.Token)
 			if err == nil {
-				return email, nil
+				return c, nil
+			}
+			if errors.Is(err, errKeyRestricted) {
+				return nil, err
 			}
 		}
 	}
 
 	// Si llegamos hasta aquí, no se pudo autenticar al usuario
-	return "", fmt.Errorf("se requiere autenticación")
+	return nil, fmt.Errorf("se requiere autenticación")
 }
 
+// maxToolRequestBody es el tamaño máximo del cuerpo de /api/tool; deja sitio
+// para imágenes de referencia y documentos de colecciones en base64
+const maxToolRequestBody = 20 << 20
+
 // handleTool maneja las solicitudes a /api/tool
 func handleTool(w http.ResponseWriter, r *http.Request) {
 	// Configurar el tipo de contenido de la respuesta
@@ -653,7 +880,7 @@ func handleTool(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verificar autenticación
-	email, err := getAuthenticatedEmail(r)
+	who, err := authenticate(r)
 	if err != nil {
 		// Determinar el tipo de error de autenticación
 		errMsg := "Se requiere autenticación"
@@ -666,6 +893,17 @@ func handleTool(w http.ResponseWriter, r *http.Request) {
 			errCode = "invalid_token"
 		}
 
+		// Clave válida usada desde una IP u origen no permitidos
+		if errors.Is(err, errKeyRestricted) {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+				"code":    "key_restricted",
+			})
+			return
+		}
+
 		// Si es una solicitud AJAX, devolver un error JSON
 		w.WriteHeader(statusCode)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -677,16 +915,34 @@ func handleTool(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Registrar el uso de la API para métricas
-	_, _ = db.Exec("UPDATE api_keys SET last_used_at = datetime('now') WHERE user_id = (SELECT id FROM users WHERE email = ?)", email)
-
 	// Decodificar el cuerpo de la solicitud
 	var req struct {
 		Tool    string                 `json:"tool"`
 		Payload map[string]interface{} `json:"payload"`
+		Token   string                 `json:"token"`
 	}
 
+	// Registrar la llamada en tool_calls (estado, latencia, bytes y host consultado)
+	start := time.Now()
+	body := &countingReader{ReadCloser: http.MaxBytesReader(w, r.Body, maxToolRequestBody)}
+	r.Body = body
+	metered := &meteredWriter{ResponseWriter: w}
+	w = metered
+	defer func() {
+		recordToolCall(who, req.Tool, req.Payload, metered, body.bytes, start)
+	}()
+
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("El cuerpo de la solicitud supera el límite de %d MB", maxToolRequestBody>>20),
+				"code":    "request_too_large",
+			})
+			return
+		}
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -697,6 +953,22 @@ func handleTool(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Payload == nil {
+		req.Payload = map[string]interface{}{}
+	}
+
+	// Las API keys configuradas para respetar robots.txt lo imponen en todas las herramientas
+	if who.Key != nil && who.Key.RespectRobots {
+		req.Payload["respect_robots"] = true
+	}
+
+	// Proveedor de búsqueda por defecto de la API key, si la petición no elige uno
+	if _, ok := req.Payload["provider"]; !ok {
+		if who.Key != nil && who.Key.SearchProvider != "" {
+			req.Payload["provider"] = who.Key.SearchProvider
+		}
+	}
+
 	// Verificar que se proporcionó una herramienta
 	if req.Tool == "" {
 		w.WriteHeader(http.StatusBadRequest)
@@ -709,13 +981,8 @@ func handleTool(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Manejar diferentes herramientas
-	switch req.Tool {
-	case "webfetch":
-		handleWebFetch(w, req.Payload)
-	case "screenshot":
-		handleScreenshot(w, req.Payload)
-	default:
+	// Rechazar herramientas desconocidas antes de consumir fichas o cuota
+	if !isSupportedTool(req.Tool) {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -723,6 +990,115 @@ func handleTool(w http.ResponseWriter, r *http.Request) {
 			"code":    "unsupported_tool",
 			"tool":    req.Tool,
 		})
+		return
+	}
+
+	// Las API keys con permisos solo pueden usar las herramientas autorizadas
+	if !requireScope(w, who, "tool:"+req.Tool) {
+		return
+	}
+
+	// Limitar por API key, usuario e IP según el coste de la herramienta
+	if !checkRateLimit(w, toolRateBuckets(r, who), toolCost(req.Tool)) {
+		return
+	}
+
+	// Aplicar el plan del usuario: opciones permitidas, cuota mensual y concurrencia
+	release, ok := enforcePlan(w, who.UserID, req.Tool, req.Payload)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Manejar diferentes herramientas
+	switch req.Tool {
+	case "webfetch":
+		handleWebFetch(w, who.UserID, req.Payload)
+	case "screenshot":
+		handleScreenshot(w, req.Payload)
+	case "crawl":
+		handleCrawl(w, who.UserID, req.Payload)
+	case "sitemap":
+		handleSitemap(w, req.Payload)
+	case "feed":
+		handleFeed(w, req.Payload)
+	case "visual_diff":
+		handleVisualDiff(w, who.UserID, req.Payload)
+	case "collection_search":
+		handleCollectionSearch(w, who.UserID, req.Payload)
+	case "research":
+		handleResearch(w, req.Payload)
+	case "search":
+		handleSearch(w, req.Payload)
+	}
+}
+
+// toolErrorCode devuelve el código de un *tools.ToolError o el valor por defecto
+func toolErrorCode(err error, fallback string) string {
+	var toolErr *tools.ToolError
+	if errors.As(err, &toolErr) && toolErr.Code != "" {
+		return toolErr.Code
+	}
+	return fallback
+}
+
+// toolErrorStatuses relaciona códigos de *tools.ToolError con códigos HTTP
+var toolErrorStatuses = map[string]int{
+	"blocked_by_robots":       http.StatusForbidden,
+	"too_many_redirects":      http.StatusBadGateway,
+	"invalid_url":             http.StatusBadRequest,
+	"sitemap_not_found":       http.StatusNotFound,
+	"feed_not_found":          http.StatusNotFound,
+	"invalid_feed":            http.StatusUnprocessableEntity,
+	"missing_query":           http.StatusBadRequest,
+	"invalid_provider":        http.StatusBadRequest,
+	"invalid_search_options":  http.StatusBadRequest,
+	"provider_not_configured": http.StatusServiceUnavailable,
+	"unsupported_search_type": http.StatusBadRequest,
+	"search_blocked":          http.StatusServiceUnavailable,
+	"quota_exceeded":          http.StatusTooManyRequests,
+}
+
+// toolErrorStatus devuelve el código HTTP asociado a un *tools.ToolError
+func toolErrorStatus(err error, fallback int) int {
+	if status, ok := toolErrorStatuses[toolErrorCode(err, "")]; ok {
+		return status
+	}
+	return fallback
+}
+
+// addChunks añade la estimación de tokens a los metadatos y, si se pidió,
+// el contenido dividido en fragmentos
+func addChunks(response, metadata map[string]interface{}, output string, opts *tools.ChunkOptions) {
+	metadata["token_estimate"] = tools.EstimateTokens(output)
+	if opts.Enabled {
+		chunks := tools.ChunkContent(output, opts)
+		response["chunks"] = chunks
+		metadata["chunk_count"] = len(chunks)
+	}
+}
+
+// addToCollection indexa el resultado en la colección indicada, si la hay.
+// Un fallo al guardar no invalida la respuesta: se devuelve como advertencia.
+func addToCollection(response, metadata map[string]interface{}, userID int64, collection, output string) {
+	if collection == "" {
+		return
+	}
+	title, _ := metadata["title"].(string)
+	pageURL, _ := metadata["final_url"].(string)
+	docID, err := saveToCollection(userID, collection, pageURL, title, output)
+	if err != nil {
+		log.Printf("Error al guardar %s en la colección %s: %v", pageURL, collection, err)
+		response["warning"] = map[string]string{
+			"code":    toolErrorCode(err, "collection_save_failed"),
+			"message": "No se pudo guardar el contenido en la colección",
+			"details": err.Error(),
+		}
+		return
+	}
+	metadata["collection"] = map[string]interface{}{
+		"name":        collection,
+		"document_id": docID,
 	}
 }
 
@@ -752,8 +1128,23 @@ func handleScreenshot(w http.ResponseWriter, payload map[string]interface{}) {
 		return
 	}
 
-	// Tomar la captura de pantalla
-	screenshot, err := tools.ShotScrapper(urlStr)
+	// Respetar robots.txt si lo pide la petición o la API key
+	if tools.RespectRobots(payload) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := tools.Robots.Check(ctx, urlStr); err != nil {
+			sendError(toolErrorStatus(err, http.StatusBadGateway), toolErrorCode(err, "robots_check_failed"), err.Error())
+			return
+		}
+	}
+
+	// Tomar la captura de pantalla: la página completa salvo que se pida
+	// full_page=false (el plan lo fija a false si no la permite)
+	fullPage := true
+	if v, ok := payload["full_page"].(bool); ok {
+		fullPage = v
+	}
+	screenshot, err := tools.ShotScrapper(urlStr, fullPage)
 	if err != nil {
 		sendError(http.StatusInternalServerError, "screenshot_failed", "Error al tomar la captura de pantalla: "+err.Error())
 		return
@@ -765,8 +1156,140 @@ func handleScreenshot(w http.ResponseWriter, payload map[string]interface{}) {
 	w.Write(screenshot)
 }
 
+// handleSitemap descubre y analiza los sitemaps de un sitio
+func handleSitemap(w http.ResponseWriter, payload map[string]interface{}) {
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	opts, err := tools.ParseSitemapOptions(payload)
+	if err != nil {
+		sendError(http.StatusBadRequest, toolErrorCode(err, "invalid_sitemap_options"), err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	result, err := tools.Sitemap(ctx, opts)
+	if err != nil {
+		sendError(toolErrorStatus(err, http.StatusBadGateway), toolErrorCode(err, "sitemap_failed"), err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"sitemaps":  result.Sitemaps,
+		"urls":      result.URLs,
+		"count":     result.Count,
+		"truncated": result.Truncated,
+		"errors":    result.Errors,
+	})
+}
+
+// handleFeed lee un feed RSS, Atom o JSON Feed y lo devuelve normalizado
+func handleFeed(w http.ResponseWriter, payload map[string]interface{}) {
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	opts, err := tools.ParseFeedOptions(payload)
+	if err != nil {
+		sendError(http.StatusBadRequest, toolErrorCode(err, "invalid_feed_options"), err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	feed, feedURL, err := tools.FetchFeed(ctx, opts)
+	if err != nil {
+		sendError(toolErrorStatus(err, http.StatusBadGateway), toolErrorCode(err, "feed_fetch_failed"), err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"feed_url": feedURL,
+		"feed":     feed,
+		"count":    len(feed.Items),
+	})
+}
+
+// handleSearch maneja la herramienta search con el proveedor elegido y respaldo automático
+func handleSearch(w http.ResponseWriter, payload map[string]interface{}) {
+	result, err := tools.WebSearch(payload)
+	if err != nil {
+		w.WriteHeader(toolErrorStatus(err, http.StatusBadGateway))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+			"code":    toolErrorCode(err, "search_failed"),
+		})
+		return
+	}
+
+	search := result.(*tools.DuckDuckGoSearchResult)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"output":   search.Output,
+		"metadata": search.Metadata,
+	})
+}
+
+// handleResearch busca, descarga los mejores resultados y los combina con citas
+func handleResearch(w http.ResponseWriter, payload map[string]interface{}) {
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	opts, err := tools.ParseResearchOptions(payload)
+	if err != nil {
+		sendError(http.StatusBadRequest, toolErrorCode(err, "invalid_research_options"), err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	result, err := tools.Research(ctx, opts)
+	if err != nil {
+		sendError(toolErrorStatus(err, http.StatusBadGateway), toolErrorCode(err, "search_failed"), err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"output":  result.Output,
+		"sources": result.Sources,
+		"metadata": map[string]interface{}{
+			"query":        result.Query,
+			"source_count": len(result.Sources),
+			"duplicates":   result.Duplicates,
+			"tokens":       result.Tokens,
+			"token_budget": opts.TokenBudget,
+			"provider":     result.Provider,
+		},
+	})
+}
+
 // handleWebFetch maneja la herramienta webfetch
-func handleWebFetch(w http.ResponseWriter, payload map[string]interface{}) {
+func handleWebFetch(w http.ResponseWriter, userID int64, payload map[string]interface{}) {
 	// Función para enviar errores estandarizados
 	sendError := func(statusCode int, code, message string, details ...interface{}) {
 		w.WriteHeader(statusCode)
@@ -819,59 +1342,95 @@ func handleWebFetch(w http.ResponseWriter, payload map[string]interface{}) {
 		}
 	}
 
-	// Obtener el timeout (opcional, por defecto 30 segundos)
-	timeout := 30
-	if t, ok := payload["timeout"].(float64); ok && t > 0 {
-		timeout = int(t)
-		if timeout > 120 { // Máximo 2 minutos
-			timeout = 120
-		}
-	}
-
-	// Configurar el cliente HTTP con timeout
-	client := &http.Client{
-		Timeout: time.Duration(timeout) * time.Second,
+	// Obtener las opciones de descarga: timeout, petición (method, headers, body,
+	// cookies, auth, user_agent), redirecciones y robots.txt
+	fetchOptions, err := tools.ParseFetchOptions(payload)
+	if err != nil {
+		sendError(http.StatusBadRequest, toolErrorCode(err, "invalid_request_options"), err.Error())
+		return
 	}
 
-	// Crear la solicitud
-	req, err := http.NewRequest("GET", urlStr, nil)
+	// Obtener las opciones de fragmentación (chunks, chunk_size, chunk_overlap)
+	chunkOptions, err := tools.ParseChunkOptions(payload)
 	if err != nil {
-		sendError(http.StatusInternalServerError, "request_creation_failed", "Error al crear la solicitud HTTP", map[string]string{
-			"details": err.Error(),
-		})
+		sendError(http.StatusBadRequest, toolErrorCode(err, "invalid_chunk_options"), err.Error())
 		return
 	}
 
-	// Añadir headers para parecer un navegador
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "es-ES,es;q=0.8,en-US;q=0.5,en;q=0.3")
-	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Pragma", "no-cache")
+	// Colección opcional en la que indexar el resultado
+	collection, _ := payload["collection"].(string)
+	if collection != "" {
+		if err := validateCollectionName(collection); err != nil {
+			sendError(http.StatusBadRequest, toolErrorCode(err, "invalid_collection"), err.Error())
+			return
+		}
+	}
 
-	// Realizar la petición
-	resp, err := client.Do(req)
+	// Descargar la página; robots.txt se revisa en la URL y en cada redirección
+	resp, err := tools.Fetch(context.Background(), urlStr, fetchOptions)
 	if err != nil {
-		sendError(http.StatusBadGateway, "request_failed", "No se pudo completar la solicitud al servidor remoto", map[string]string{
-			"url":     urlStr,
-			"details": err.Error(),
-		})
+		switch code := toolErrorCode(err, "request_failed"); code {
+		case "request_failed":
+			sendError(http.StatusBadGateway, code, "No se pudo completar la solicitud al servidor remoto", map[string]string{
+				"url":     urlStr,
+				"details": err.Error(),
+			})
+		case "document_extraction_failed":
+			sendError(http.StatusUnprocessableEntity, code, "No se pudo extraer el contenido del documento", map[string]string{
+				"url":           urlStr,
+				"document_type": resp.DocumentType,
+				"details":       err.Error(),
+			})
+		default:
+			details := map[string]interface{}{
+				"url":            urlStr,
+				"redirect_chain": resp.RedirectChain,
+			}
+			if fetchOptions.RespectRobots {
+				details["user_agent"] = tools.Robots.UserAgent
+			}
+			sendError(toolErrorStatus(err, http.StatusBadGateway), code, err.Error(), details)
+		}
 		return
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		sendError(http.StatusInternalServerError, "read_response_failed", "Error al leer la respuesta del servidor remoto", map[string]string{
-			"details": err.Error(),
-		})
+	contentType := resp.ContentType
+	isHTML := resp.IsHTML()
+	body := resp.Body
+
+	// Los documentos (PDF, Office, EPUB) devuelven su texto en lugar del binario
+	if doc := resp.Document; doc != nil {
+		// Los documentos no tienen HTML de origen: "html" y "text" devuelven texto plano
+		output := doc.Text
+		if format == "markdown" {
+			output = doc.Markdown
+		}
+
+		metadata := map[string]interface{}{
+			"url":            urlStr,
+			"format":         format,
+			"content_type":   contentType,
+			"status_code":    resp.StatusCode,
+			"method":         fetchOptions.Request.Method,
+			"final_url":      resp.FinalURL.String(),
+			"redirect_chain": resp.RedirectChain,
+			"content_length": resp.ContentLength,
+		}
+		for k, v := range doc.Metadata {
+			metadata[k] = v
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"output":   output,
+			"metadata": metadata,
+		}
+		addChunks(response, metadata, output, chunkOptions)
+		addToCollection(response, metadata, userID, collection, output)
+		json.NewEncoder(w).Encode(response)
 		return
 	}
 
-	// Determinar el tipo de contenido
-	contentType := resp.Header.Get("Content-Type")
-	isHTML := strings.Contains(contentType, "text/html") || strings.Contains(contentType, "application/xhtml+xml")
-
 	// Convertir el contenido según el formato solicitado
 	var result string
 	var conversionError error
@@ -909,7 +1468,15 @@ func handleWebFetch(w http.ResponseWriter, payload map[string]interface{}) {
 		"format":         format,
 		"content_type":   contentType,
 		"status_code":    resp.StatusCode,
-		"content_length": len(body),
+		"method":         fetchOptions.Request.Method,
+		"final_url":      resp.FinalURL.String(),
+		"redirect_chain": resp.RedirectChain,
+		"content_length": resp.ContentLength,
+	}
+
+	if resp.Charset != "" {
+		metadata["charset"] = resp.Charset
+		metadata["charset_source"] = resp.CharsetSource
 	}
 
 	// Si es HTML, extraer metadatos adicionales
@@ -939,6 +1506,11 @@ func handleWebFetch(w http.ResponseWriter, payload map[string]interface{}) {
 				}
 			}
 
+			// Feeds anunciados por la página, utilizables directamente con la herramienta feed
+			if feeds := tools.DiscoverFeeds(resp.FinalURL, doc); len(feeds) > 0 {
+				metadata["feeds"] = feeds
+			}
+
 			// Extraer descripción si está disponible
 			if desc, exists := doc.Find("meta[property='og:description']").First().Attr("content"); exists && desc != "" {
 				metadata["description"] = strings.TrimSpace(desc)
@@ -955,6 +1527,9 @@ func handleWebFetch(w http.ResponseWriter, payload map[string]interface{}) {
 		"metadata": metadata,
 	}
 
+	addChunks(response, metadata, result, chunkOptions)
+	addToCollection(response, metadata, userID, collection, result)
+
 	// Si hubo un error de conversión, incluirlo como advertencia
 	if conversionError != nil {
 		response["warning"] = map[string]string{
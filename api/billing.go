@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"toolbox/billing"
+)
+
+// billingClient gestiona la facturación con Stripe; se crea en SetupRoutes
+var billingClient *billing.Client
+
+// maxWebhookBody es el tamaño máximo aceptado para un webhook de Stripe
+const maxWebhookBody = 1 << 20
+
+// billingSession valida la petición común a Checkout y al Customer Portal:
+// método POST, autenticación y permiso billing:manage. Devuelve el email y el
+// ID del usuario, o false si ya se respondió con un error.
+func billingSession(w http.ResponseWriter, r *http.Request, sendError func(int, string, string)) (string, int64, bool) {
+	if r.Method != http.MethodPost {
+		sendError(http.StatusMethodNotAllowed, "method_not_allowed", "Método no permitido")
+		return "", 0, false
+	}
+	who, err := authenticate(r)
+	if err != nil {
+		sendError(http.StatusUnauthorized, "unauthorized", "Se requiere autenticación")
+		return "", 0, false
+	}
+	if !requireScope(w, who, scopeBillingManage) {
+		return "", 0, false
+	}
+	if billingClient == nil || !billingClient.Enabled() {
+		sendError(http.StatusServiceUnavailable, "billing_disabled", "La facturación no está disponible")
+		return "", 0, false
+	}
+	return who.Email, who.UserID, true
+}
+
+// handleBillingCheckout maneja POST /api/billing/checkout {"plan": "pro"}:
+// devuelve la URL de una sesión de Checkout para contratar el plan
+func handleBillingCheckout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	email, userID, ok := billingSession(w, r, sendError)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Plan string `json:"plan"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(http.StatusBadRequest, "invalid_request", "Error al decodificar el cuerpo de la solicitud")
+		return
+	}
+
+	url, err := billingClient.CreateCheckoutSession(userID, email, req.Plan)
+	if errors.Is(err, billing.ErrUnknownPlan) {
+		sendError(http.StatusBadRequest, "invalid_plan", "El plan '"+req.Plan+"' no se puede contratar")
+		return
+	}
+	if err != nil {
+		log.Printf("Error al crear la sesión de Checkout: %v", err)
+		sendError(http.StatusBadGateway, "billing_error", "Error al crear la sesión de pago")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"url":     url,
+	})
+}
+
+// handleBillingPortal maneja POST /api/billing/portal: devuelve la URL del
+// Customer Portal para gestionar la suscripción
+func handleBillingPortal(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	_, userID, ok := billingSession(w, r, sendError)
+	if !ok {
+		return
+	}
+
+	url, err := billingClient.CreatePortalSession(userID)
+	if errors.Is(err, billing.ErrNoCustomer) {
+		sendError(http.StatusNotFound, "no_subscription", "No hay ninguna suscripción que gestionar")
+		return
+	}
+	if err != nil {
+		log.Printf("Error al crear la sesión del Customer Portal: %v", err)
+		sendError(http.StatusBadGateway, "billing_error", "Error al abrir el portal de facturación")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"url":     url,
+	})
+}
+
+// handleBillingWebhook maneja POST /api/billing/webhook. Responde 400 si la
+// firma no es válida y 500 si el evento no se pudo aplicar, para que Stripe
+// lo reintente.
+func handleBillingWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	if r.Method != http.MethodPost {
+		sendError(http.StatusMethodNotAllowed, "method_not_allowed", "Método no permitido")
+		return
+	}
+	if billingClient == nil {
+		sendError(http.StatusServiceUnavailable, "billing_disabled", "La facturación no está disponible")
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		sendError(http.StatusBadRequest, "invalid_request", "Error al leer el cuerpo de la solicitud")
+		return
+	}
+
+	event, err := billingClient.ConstructEvent(payload, r.Header.Get("Stripe-Signature"))
+	if errors.Is(err, billing.ErrNotConfigured) {
+		sendError(http.StatusServiceUnavailable, "billing_disabled", "La facturación no está disponible")
+		return
+	}
+	if err != nil {
+		log.Printf("Webhook de Stripe rechazado: %v", err)
+		sendError(http.StatusBadRequest, "invalid_signature", "Firma de webhook no válida")
+		return
+	}
+
+	if err := billingClient.HandleEvent(event); err != nil {
+		log.Printf("Error al procesar el evento de Stripe %s (%s): %v", event.ID, event.Type, err)
+		sendError(http.StatusInternalServerError, "webhook_failed", "Error al procesar el evento")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"received": true,
+	})
+}
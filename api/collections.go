@@ -0,0 +1,340 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"toolbox/tools"
+)
+
+const (
+	defaultCollectionResults = 10
+	maxCollectionResults     = 50
+	maxCollectionsPerUser    = 100
+	// maxDocumentsPerCollection y maxCollectionDocumentSize acotan lo que ocupa cada colección
+	maxDocumentsPerCollection = 1000
+	maxCollectionDocumentSize = 1 * 1024 * 1024 // 1MB
+)
+
+// collectionName restringe los nombres de colección a identificadores sencillos
+var collectionName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// validateCollectionName comprueba el nombre de una colección
+func validateCollectionName(name string) error {
+	if !collectionName.MatchString(name) {
+		return &tools.ToolError{Code: "invalid_collection", Message: "el nombre de la colección solo admite letras, números, '-' y '_' (máximo 64 caracteres)"}
+	}
+	return nil
+}
+
+// collectionID obtiene el id de una colección del usuario; si create es true la crea cuando no existe
+func collectionID(userID int64, name string, create bool) (int64, error) {
+	var id int64
+	err := db.QueryRow("SELECT id FROM collections WHERE user_id = ? AND name = ?", userID, name).Scan(&id)
+	switch {
+	case err == nil:
+		return id, nil
+	case err != sql.ErrNoRows:
+		return 0, err
+	case !create:
+		return 0, &tools.ToolError{Code: "collection_not_found", Message: "la colección '" + name + "' no existe"}
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM collections WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return 0, err
+	}
+	if count >= maxCollectionsPerUser {
+		return 0, &tools.ToolError{Code: "collection_limit_reached", Message: fmt.Sprintf("se alcanzó el máximo de %d colecciones", maxCollectionsPerUser)}
+	}
+
+	result, err := db.Exec("INSERT INTO collections (user_id, name) VALUES (?, ?)", userID, name)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// sendCollectionError responde 404 si la colección no existe y 500 ante un
+// error de base de datos
+func sendCollectionError(sendError func(int, string, string), err error) {
+	if toolErrorCode(err, "") == "collection_not_found" {
+		sendError(http.StatusNotFound, "collection_not_found", err.Error())
+		return
+	}
+	log.Printf("Error al obtener la colección: %v", err)
+	sendError(http.StatusInternalServerError, "database_error", "Error al obtener la colección")
+}
+
+// saveToCollection indexa un resultado de webfetch en la colección indicada.
+// Si la URL ya estaba en la colección, su contenido se reemplaza.
+func saveToCollection(userID int64, name, pageURL, title, content string) (int64, error) {
+	if err := validateCollectionName(name); err != nil {
+		return 0, err
+	}
+	if len(content) > maxCollectionDocumentSize {
+		return 0, &tools.ToolError{Code: "collection_document_too_large", Message: "el contenido excede el tamaño máximo de 1MB por documento"}
+	}
+	colID, err := collectionID(userID, name, true)
+	if err != nil {
+		return 0, err
+	}
+
+	// Reemplazar un documento existente no cuenta contra el límite
+	var count int
+	var exists bool
+	err = db.QueryRow("SELECT COUNT(*), COALESCE(MAX(url = ?), 0) FROM collection_documents WHERE collection_id = ?", pageURL, colID).Scan(&count, &exists)
+	if err != nil {
+		return 0, err
+	}
+	if !exists && count >= maxDocumentsPerCollection {
+		return 0, &tools.ToolError{Code: "collection_full", Message: fmt.Sprintf("la colección '%s' alcanzó el máximo de %d documentos", name, maxDocumentsPerCollection)}
+	}
+
+	domain := ""
+	if parsed, err := url.Parse(pageURL); err == nil {
+		domain = strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	}
+
+	_, err = db.Exec(`INSERT INTO collection_documents (collection_id, url, domain, title, content) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (collection_id, url) DO UPDATE SET title = excluded.title, content = excluded.content, domain = excluded.domain, fetched_at = CURRENT_TIMESTAMP`,
+		colID, pageURL, domain, title, content)
+	if err != nil {
+		return 0, err
+	}
+
+	var docID int64
+	err = db.QueryRow("SELECT id FROM collection_documents WHERE collection_id = ? AND url = ?", colID, pageURL).Scan(&docID)
+	return docID, err
+}
+
+// ftsQuery convierte el texto del usuario en una consulta FTS5 segura: cada
+// término se cita para que los operadores de FTS5 no provoquen errores de sintaxis
+func ftsQuery(query string) string {
+	var terms []string
+	for _, term := range strings.FieldsFunc(query, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"'
+	}) {
+		terms = append(terms, `"`+term+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// handleCollectionSearch busca en una colección con ranking BM25
+func handleCollectionSearch(w http.ResponseWriter, userID int64, payload map[string]interface{}) {
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	name, _ := payload["collection"].(string)
+	if err := validateCollectionName(name); err != nil {
+		sendError(http.StatusBadRequest, "invalid_collection", "Se requiere el parámetro 'collection' con un nombre válido")
+		return
+	}
+
+	query, _ := payload["query"].(string)
+	match := ftsQuery(query)
+	if match == "" {
+		sendError(http.StatusBadRequest, "missing_query", "Se requiere el parámetro 'query' en el payload")
+		return
+	}
+
+	limit := defaultCollectionResults
+	if v, ok := payload["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+		if limit > maxCollectionResults {
+			limit = maxCollectionResults
+		}
+	}
+
+	conditions := []string{"collection_fts MATCH ?", "d.collection_id = ?"}
+
+	domain, _ := payload["domain"].(string)
+	domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+
+	var dateArgs []interface{}
+	for _, filter := range []struct{ field, op string }{{"since", ">="}, {"until", "<="}} {
+		value, ok := payload[filter.field].(string)
+		if !ok || value == "" {
+			continue
+		}
+		date, err := parseDateFilter(value)
+		if err != nil {
+			sendError(http.StatusBadRequest, "invalid_date", fmt.Sprintf("El campo '%s' debe ser una fecha (YYYY-MM-DD o RFC 3339)", filter.field))
+			return
+		}
+		conditions = append(conditions, "d.fetched_at "+filter.op+" ?")
+		dateArgs = append(dateArgs, date.UTC().Format("2006-01-02 15:04:05"))
+	}
+
+	colID, err := collectionID(userID, name, false)
+	if err != nil {
+		sendCollectionError(sendError, err)
+		return
+	}
+
+	args := []interface{}{match, colID}
+	if domain != "" {
+		conditions = append(conditions, "(d.domain = ? OR d.domain LIKE ?)")
+		args = append(args, domain, "%."+domain)
+	}
+	args = append(args, dateArgs...)
+	args = append(args, limit)
+
+	// bm25() devuelve valores menores cuanto más relevante; el título pesa más que el cuerpo
+	rows, err := db.Query(`SELECT d.id, d.url, d.domain, COALESCE(d.title, ''), d.fetched_at,
+			-bm25(collection_fts, 5.0, 1.0) AS score,
+			snippet(collection_fts, 1, '**', '**', '…', 24)
+		FROM collection_fts JOIN collection_documents d ON d.id = collection_fts.rowid
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY bm25(collection_fts, 5.0, 1.0) LIMIT ?`, args...)
+	if err != nil {
+		log.Printf("Error en la búsqueda de la colección %s: %v", name, err)
+		sendError(http.StatusInternalServerError, "search_failed", "Error al buscar en la colección")
+		return
+	}
+	defer rows.Close()
+
+	results := []map[string]interface{}{}
+	for rows.Next() {
+		var (
+			id                          int64
+			docURL, docDomain, docTitle string
+			fetchedAt                   time.Time
+			score                       float64
+			snippet                     string
+		)
+		if err := rows.Scan(&id, &docURL, &docDomain, &docTitle, &fetchedAt, &score, &snippet); err != nil {
+			log.Printf("Error al leer resultado de la colección: %v", err)
+			continue
+		}
+		results = append(results, map[string]interface{}{
+			"id":         id,
+			"url":        docURL,
+			"domain":     docDomain,
+			"title":      docTitle,
+			"score":      score,
+			"snippet":    snippet,
+			"fetched_at": fetchedAt.Format(time.RFC3339),
+		})
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"collection": name,
+		"query":      query,
+		"results":    results,
+		"count":      len(results),
+	})
+}
+
+// parseDateFilter interpreta fechas YYYY-MM-DD o RFC 3339
+func parseDateFilter(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// handleCollections maneja GET /api/collections y DELETE /api/collections/{name}
+func handleCollections(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	who, err := authenticate(r)
+	if err != nil {
+		sendError(http.StatusUnauthorized, "unauthorized", "Se requiere autenticación")
+		return
+	}
+	if !requireScope(w, who, "tool:collection_search") {
+		return
+	}
+	userID := who.UserID
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/collections"), "/")
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		rows, err := db.Query(`SELECT c.name, c.created_at, COUNT(d.id), MAX(d.fetched_at)
+			FROM collections c LEFT JOIN collection_documents d ON d.collection_id = c.id
+			WHERE c.user_id = ? GROUP BY c.id ORDER BY c.name`, userID)
+		if err != nil {
+			log.Printf("Error al listar colecciones: %v", err)
+			sendError(http.StatusInternalServerError, "database_error", "Error al obtener las colecciones")
+			return
+		}
+		defer rows.Close()
+
+		collections := []map[string]interface{}{}
+		for rows.Next() {
+			var (
+				colName   string
+				createdAt time.Time
+				documents int
+				lastSaved sql.NullString
+			)
+			if err := rows.Scan(&colName, &createdAt, &documents, &lastSaved); err != nil {
+				log.Printf("Error al leer colección: %v", err)
+				continue
+			}
+			collection := map[string]interface{}{
+				"name":       colName,
+				"documents":  documents,
+				"created_at": createdAt.Format(time.RFC3339),
+			}
+			if lastSaved.Valid {
+				collection["updated_at"] = lastSaved.String
+			}
+			collections = append(collections, collection)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     true,
+			"collections": collections,
+		})
+
+	case name != "" && r.Method == http.MethodDelete:
+		colID, err := collectionID(userID, name, false)
+		if err != nil {
+			sendCollectionError(sendError, err)
+			return
+		}
+		// Borrar los documentos primero para que los triggers actualicen el índice FTS
+		if _, err := db.Exec("DELETE FROM collection_documents WHERE collection_id = ?", colID); err != nil {
+			sendError(http.StatusInternalServerError, "database_error", "Error al eliminar la colección")
+			return
+		}
+		if _, err := db.Exec("DELETE FROM collections WHERE id = ?", colID); err != nil {
+			sendError(http.StatusInternalServerError, "database_error", "Error al eliminar la colección")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Colección eliminada correctamente",
+		})
+
+	default:
+		sendError(http.StatusMethodNotAllowed, "method_not_allowed", "Método no permitido")
+	}
+}
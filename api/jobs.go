@@ -0,0 +1,379 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"toolbox/tools"
+)
+
+const (
+	jobStatusQueued    = "queued"
+	jobStatusRunning   = "running"
+	jobStatusCompleted = "completed"
+	jobStatusFailed    = "failed"
+	jobStatusCancelled = "cancelled"
+
+	// maxJobDuration limita cuánto puede durar un trabajo asíncrono
+	maxJobDuration = 30 * time.Minute
+	// jobHeartbeat es cada cuánto un trabajo en curso renueva su latido;
+	// sin latido durante jobLease se considera abandonado
+	jobHeartbeat = 30 * time.Second
+	jobLease     = 2 * time.Minute
+)
+
+// jobCancels guarda la función de cancelación de los trabajos en curso en este proceso
+var (
+	jobCancels   = map[string]context.CancelFunc{}
+	jobCancelsMu sync.Mutex
+)
+
+// instanceID identifica a este proceso como dueño de los trabajos que lanza.
+// En Fly.io se usa el identificador de la máquina, que se conserva al reiniciar.
+var instanceID = newInstanceID()
+
+func newInstanceID() string {
+	if id := os.Getenv("FLY_MACHINE_ID"); id != "" {
+		return id
+	}
+	host, _ := os.Hostname()
+	random, err := generateRandomString(8)
+	if err != nil {
+		return host
+	}
+	return host + "-" + random
+}
+
+// markInterruptedJobs marca como fallidos los trabajos que quedaron a medias
+// tras un reinicio: los de esta instancia y los de cualquier otra que haya
+// dejado de renovar su latido. Los trabajos vivos de otras máquinas no se tocan.
+func markInterruptedJobs() {
+	_, err := db.Exec(
+		`UPDATE jobs SET status = ?, error = ?, error_code = ?, finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE status IN (?, ?) AND (owner = ? OR heartbeat_at IS NULL OR heartbeat_at < datetime('now', ?))`,
+		jobStatusFailed, "El trabajo se interrumpió por un reinicio del servidor", "job_interrupted",
+		jobStatusQueued, jobStatusRunning, instanceID, fmt.Sprintf("-%d seconds", int(jobLease.Seconds())),
+	)
+	if err != nil {
+		log.Printf("Error al marcar trabajos interrumpidos: %v", err)
+	}
+}
+
+// activeJobs cuenta los trabajos en cola o en curso del usuario en cualquier
+// instancia; los que han dejado de renovar su latido no cuentan
+func activeJobs(userID int64) (int, error) {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM jobs WHERE user_id = ? AND status IN (?, ?) AND heartbeat_at >= datetime('now', ?)",
+		userID, jobStatusQueued, jobStatusRunning, fmt.Sprintf("-%d seconds", int(jobLease.Seconds())),
+	).Scan(&count)
+	return count, err
+}
+
+// jobSecretParams son opciones de la petición que pueden llevar credenciales
+// (contraseñas, tokens, cookies de sesión) y no se guardan en jobs.params
+var jobSecretParams = []string{"auth", "cookies", "headers", "user_agent"}
+
+// jobParams copia el payload sin las opciones con credenciales
+func jobParams(payload map[string]interface{}) map[string]interface{} {
+	params := make(map[string]interface{}, len(payload))
+	for key, value := range payload {
+		params[key] = value
+	}
+	for _, key := range jobSecretParams {
+		delete(params, key)
+	}
+	return params
+}
+
+// startJob registra un trabajo y lo ejecuta en segundo plano. run recibe una
+// función para publicar el progreso y devuelve el resultado final.
+func startJob(userID int64, tool string, params interface{}, run func(ctx context.Context, report func(progress interface{})) (interface{}, error)) (string, error) {
+	random, err := generateRandomString(16)
+	if err != nil {
+		return "", err
+	}
+	jobID := "job_" + random
+
+	paramsJSON, _ := json.Marshal(params)
+	_, err = db.Exec(
+		"INSERT INTO jobs (id, user_id, tool, status, params, owner, heartbeat_at) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)",
+		jobID, userID, tool, jobStatusQueued, string(paramsJSON), instanceID,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), maxJobDuration)
+	jobCancelsMu.Lock()
+	jobCancels[jobID] = cancel
+	jobCancelsMu.Unlock()
+
+	go func() {
+		defer func() {
+			cancel()
+			jobCancelsMu.Lock()
+			delete(jobCancels, jobID)
+			jobCancelsMu.Unlock()
+		}()
+
+		db.Exec("UPDATE jobs SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", jobStatusRunning, jobID)
+
+		// Renovar el latido mientras el trabajo siga en curso
+		go func() {
+			ticker := time.NewTicker(jobHeartbeat)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					db.Exec("UPDATE jobs SET heartbeat_at = CURRENT_TIMESTAMP WHERE id = ?", jobID)
+				}
+			}
+		}()
+
+		report := func(progress interface{}) {
+			progressJSON, err := json.Marshal(progress)
+			if err != nil {
+				return
+			}
+			if _, err := db.Exec("UPDATE jobs SET progress = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", string(progressJSON), jobID); err != nil {
+				log.Printf("Error al actualizar progreso del trabajo %s: %v", jobID, err)
+			}
+		}
+
+		result, runErr := run(ctx, report)
+		finishJob(jobID, ctx, result, runErr)
+	}()
+
+	return jobID, nil
+}
+
+// finishJob guarda el resultado o el error final de un trabajo
+func finishJob(jobID string, ctx context.Context, result interface{}, runErr error) {
+	status := jobStatusCompleted
+	var errMsg, errCode sql.NullString
+	if runErr != nil {
+		status = jobStatusFailed
+		errMsg = sql.NullString{String: runErr.Error(), Valid: true}
+		errCode = sql.NullString{String: toolErrorCode(runErr, "job_failed"), Valid: true}
+		switch ctx.Err() {
+		case context.Canceled:
+			status = jobStatusCancelled
+			errCode.String = "job_cancelled"
+		case context.DeadlineExceeded:
+			errCode.String = "job_timeout"
+		}
+	}
+
+	var resultJSON sql.NullString
+	if result != nil {
+		if data, err := json.Marshal(result); err == nil {
+			resultJSON = sql.NullString{String: string(data), Valid: true}
+		}
+	}
+
+	_, err := db.Exec(
+		"UPDATE jobs SET status = ?, result = ?, error = ?, error_code = ?, finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		status, resultJSON, errMsg, errCode, jobID,
+	)
+	if err != nil {
+		log.Printf("Error al guardar el resultado del trabajo %s: %v", jobID, err)
+	}
+}
+
+// scanJob convierte una fila de la tabla jobs en la respuesta de la API
+func scanJob(row interface{ Scan(...interface{}) error }, includeResult bool) (map[string]interface{}, error) {
+	var (
+		id, tool, status                  string
+		progress, result, errMsg, errCode sql.NullString
+		createdAt, updatedAt              time.Time
+		finishedAt                        sql.NullTime
+	)
+	if err := row.Scan(&id, &tool, &status, &progress, &result, &errMsg, &errCode, &createdAt, &updatedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+
+	job := map[string]interface{}{
+		"id":         id,
+		"tool":       tool,
+		"status":     status,
+		"created_at": createdAt.Format(time.RFC3339),
+		"updated_at": updatedAt.Format(time.RFC3339),
+	}
+	if progress.Valid {
+		job["progress"] = json.RawMessage(progress.String)
+	}
+	if includeResult && result.Valid {
+		job["result"] = json.RawMessage(result.String)
+	}
+	if errMsg.Valid {
+		job["error"] = errMsg.String
+		job["code"] = errCode.String
+	}
+	if finishedAt.Valid {
+		job["finished_at"] = finishedAt.Time.Format(time.RFC3339)
+	}
+	return job, nil
+}
+
+const jobColumns = "id, tool, status, progress, result, error, error_code, created_at, updated_at, finished_at"
+
+// handleJobs maneja GET /api/jobs, GET /api/jobs/{id} y DELETE /api/jobs/{id}
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	who, err := authenticate(r)
+	if err != nil {
+		sendError(http.StatusUnauthorized, "unauthorized", "Se requiere autenticación")
+		return
+	}
+	// Los trabajos asíncronos son rastreos lanzados con crawl
+	if !requireScope(w, who, "tool:crawl") {
+		return
+	}
+	userID := who.UserID
+
+	jobID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs"), "/")
+
+	// Listado de trabajos del usuario (sin resultados, que pueden ser grandes)
+	if jobID == "" {
+		if r.Method != http.MethodGet {
+			sendError(http.StatusMethodNotAllowed, "method_not_allowed", "Método no permitido")
+			return
+		}
+
+		rows, err := db.Query("SELECT "+jobColumns+" FROM jobs WHERE user_id = ? ORDER BY created_at DESC LIMIT 100", userID)
+		if err != nil {
+			log.Printf("Error al listar trabajos: %v", err)
+			sendError(http.StatusInternalServerError, "database_error", "Error al obtener los trabajos")
+			return
+		}
+		defer rows.Close()
+
+		jobs := []map[string]interface{}{}
+		for rows.Next() {
+			job, err := scanJob(rows, false)
+			if err != nil {
+				log.Printf("Error al leer trabajo: %v", err)
+				continue
+			}
+			jobs = append(jobs, job)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"jobs":    jobs,
+		})
+		return
+	}
+
+	job, err := scanJob(db.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ? AND user_id = ?", jobID, userID), true)
+	if err == sql.ErrNoRows {
+		sendError(http.StatusNotFound, "job_not_found", "Trabajo no encontrado")
+		return
+	}
+	if err != nil {
+		log.Printf("Error al obtener trabajo %s: %v", jobID, err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al obtener el trabajo")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"job":     job,
+		})
+
+	case http.MethodDelete:
+		// Cancelar un trabajo en curso; los terminados no se modifican
+		jobCancelsMu.Lock()
+		cancel, running := jobCancels[jobID]
+		jobCancelsMu.Unlock()
+		if !running {
+			sendError(http.StatusConflict, "job_not_running", "El trabajo no está en curso")
+			return
+		}
+		cancel()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Cancelación solicitada",
+		})
+
+	default:
+		sendError(http.StatusMethodNotAllowed, "method_not_allowed", "Método no permitido")
+	}
+}
+
+// handleCrawl valida las opciones del rastreo y lo lanza como trabajo asíncrono
+func handleCrawl(w http.ResponseWriter, userID int64, payload map[string]interface{}) {
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	opts, err := tools.ParseCrawlOptions(payload)
+	if err != nil {
+		sendError(http.StatusBadRequest, toolErrorCode(err, "invalid_crawl_options"), err.Error())
+		return
+	}
+
+	jobID, err := startJob(userID, "crawl", jobParams(payload), func(ctx context.Context, report func(interface{})) (interface{}, error) {
+		var mu sync.Mutex
+		pages, err := tools.Crawl(ctx, opts, func(progress tools.CrawlProgress, page tools.CrawlPage) {
+			mu.Lock()
+			defer mu.Unlock()
+			report(map[string]interface{}{
+				"visited":   progress.Visited,
+				"failed":    progress.Failed,
+				"queued":    progress.Queued,
+				"depth":     progress.Depth,
+				"max_pages": progress.MaxPages,
+				"last_url":  page.URL,
+			})
+		})
+		result := map[string]interface{}{
+			"seed":   opts.URL,
+			"format": opts.Format,
+			"count":  len(pages),
+			"pages":  pages,
+		}
+		return result, err
+	})
+	if err != nil {
+		log.Printf("Error al crear trabajo de crawl: %v", err)
+		sendError(http.StatusInternalServerError, "job_creation_failed", "Error al crear el trabajo")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"job_id":     jobID,
+		"status":     jobStatusQueued,
+		"status_url": "/api/jobs/" + jobID,
+	})
+}
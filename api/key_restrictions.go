@@ -0,0 +1,159 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// maxKeyRestrictions limita el número de entradas de cada lista de restricciones
+const maxKeyRestrictions = 50
+
+// errKeyRestricted indica que la clave es válida pero no se puede usar desde
+// la IP u origen de la petición
+var errKeyRestricted = errors.New("la API key no admite peticiones desde este origen")
+
+// normalizeAllowedIPs valida una lista de IPs o rangos CIDR y la devuelve en
+// forma canónica
+func normalizeAllowedIPs(entries []string) ([]string, error) {
+	if len(entries) > maxKeyRestrictions {
+		return nil, fmt.Errorf("'allowed_ips' admite como máximo %d entradas", maxKeyRestrictions)
+	}
+	var result []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			result = append(result, network.String())
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			result = append(result, ip.String())
+			continue
+		}
+		return nil, fmt.Errorf("'allowed_ips' contiene una IP o rango CIDR no válido: %q", entry)
+	}
+	return result, nil
+}
+
+// normalizeAllowedOrigins valida una lista de orígenes permitidos. Cada entrada
+// puede ser un origen completo (https://app.ejemplo.com), un host con puerto
+// opcional (ejemplo.com:8080) o un comodín de subdominios (*.ejemplo.com)
+func normalizeAllowedOrigins(entries []string) ([]string, error) {
+	if len(entries) > maxKeyRestrictions {
+		return nil, fmt.Errorf("'allowed_origins' admite como máximo %d entradas", maxKeyRestrictions)
+	}
+	var result []string
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(entry), "/"))
+		host := entry
+		if strings.Contains(entry, "://") {
+			u, err := url.Parse(entry)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+				return nil, fmt.Errorf("'allowed_origins' contiene un origen no válido: %q", entry)
+			}
+			host = u.Host
+		}
+		host = strings.TrimPrefix(host, "*.")
+		if host == "" || strings.ContainsAny(host, "/*?#@ ") {
+			return nil, fmt.Errorf("'allowed_origins' contiene un origen no válido: %q", entry)
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// clientIP devuelve la IP del cliente. En Fly.io se usa Fly-Client-IP, que
+// fija el proxy; en otros entornos se usa la dirección de la conexión
+func clientIP(r *http.Request) net.IP {
+	if os.Getenv("FLY") == "true" {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("Fly-Client-IP"))); ip != nil {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// requestOrigin devuelve el origen de la petición a partir de Origin o, si no
+// lo hay, de Referer
+func requestOrigin(r *http.Request) *url.URL {
+	for _, header := range []string{"Origin", "Referer"} {
+		value := strings.TrimSpace(r.Header.Get(header))
+		if value == "" || value == "null" {
+			continue
+		}
+		if u, err := url.Parse(value); err == nil && u.Host != "" {
+			return u
+		}
+	}
+	return nil
+}
+
+// ipAllowed indica si la IP pertenece a alguna entrada de la lista
+func ipAllowed(ip net.IP, allowed []string) bool {
+	if ip == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// originAllowed indica si el origen coincide con alguna entrada de la lista
+func originAllowed(origin *url.URL, allowed []string) bool {
+	if origin == nil {
+		return false
+	}
+	scheme := strings.ToLower(origin.Scheme)
+	host := strings.ToLower(origin.Host)
+	hostname := strings.ToLower(origin.Hostname())
+	for _, entry := range allowed {
+		pattern := entry
+		if i := strings.Index(entry, "://"); i >= 0 {
+			if entry[:i] != scheme {
+				continue
+			}
+			pattern = entry[i+3:]
+		}
+		target := hostname
+		if strings.Contains(strings.TrimPrefix(pattern, "*."), ":") {
+			target = host
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(target, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if target == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKeyRestrictions aplica las listas de IPs y orígenes permitidos de una
+// clave; una lista vacía no restringe nada
+func checkKeyRestrictions(r *http.Request, allowedIPs, allowedOrigins []string) error {
+	if len(allowedIPs) > 0 && !ipAllowed(clientIP(r), allowedIPs) {
+		return fmt.Errorf("%w: IP no permitida", errKeyRestricted)
+	}
+	if len(allowedOrigins) > 0 && !originAllowed(requestOrigin(r), allowedOrigins) {
+		return fmt.Errorf("%w: origen no permitido", errKeyRestricted)
+	}
+	return nil
+}
@@ -0,0 +1,384 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"toolbox/auth"
+)
+
+const (
+	maxKeyNameLength        = 100
+	maxKeyDescriptionLength = 500
+	defaultRotationGrace    = 60          // minutos durante los que la clave anterior sigue siendo válida
+	maxRotationGrace        = 7 * 24 * 60 // una semana
+)
+
+// apiKeyRecord son los datos configurables de una API key
+type apiKeyRecord struct {
+	Name           string
+	Description    string
+	ExpiresAt      *time.Time
+	RespectRobots  bool
+	SearchProvider string
+	Scopes         []string // nil = acceso completo
+	AllowedIPs     []string
+	AllowedOrigins []string
+}
+
+// insertAPIKey genera una clave nueva, guarda su hash y devuelve su ID y la
+// clave en claro, que no vuelve a estar disponible
+func insertAPIKey(userID int64, record *apiKeyRecord) (string, string, error) {
+	apiKey, err := generateAPIKey()
+	if err != nil {
+		return "", "", err
+	}
+	keyID, err := generateRandomString(8)
+	if err != nil {
+		return "", "", fmt.Errorf("error al generar el ID de la clave: %v", err)
+	}
+
+	var expiresAt interface{}
+	if record.ExpiresAt != nil {
+		expiresAt = record.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO api_keys (id, user_id, name, description, key_hash, key_prefix, respect_robots, search_provider, scopes, "+
+			"allowed_ips, allowed_origins, expires_at, created_at) "+
+			"VALUES (?, ?, ?, NULLIF(?, ''), ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), datetime(?), CURRENT_TIMESTAMP)",
+		keyID,
+		userID,
+		record.Name,
+		record.Description,
+		auth.HashAPIKey(apiKey),
+		auth.APIKeyPrefix(apiKey),
+		record.RespectRobots,
+		record.SearchProvider,
+		strings.Join(record.Scopes, " "),
+		strings.Join(record.AllowedIPs, " "),
+		strings.Join(record.AllowedOrigins, " "),
+		expiresAt,
+	)
+	if err != nil {
+		return "", "", fmt.Errorf("error al guardar la clave API: %v", err)
+	}
+	return keyID, apiKey, nil
+}
+
+// validateKeyName comprueba el nombre y la descripción de una clave
+func validateKeyName(name, description string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("el nombre de la clave no puede estar vacío")
+	}
+	if len([]rune(name)) > maxKeyNameLength {
+		return fmt.Errorf("el nombre de la clave admite como máximo %d caracteres", maxKeyNameLength)
+	}
+	if len([]rune(description)) > maxKeyDescriptionLength {
+		return fmt.Errorf("la descripción admite como máximo %d caracteres", maxKeyDescriptionLength)
+	}
+	return nil
+}
+
+// parseKeyExpiry interpreta expires_at (RFC 3339), que debe ser una fecha futura
+func parseKeyExpiry(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("'expires_at' debe tener formato RFC 3339")
+	}
+	if !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("'expires_at' debe ser una fecha futura")
+	}
+	return &expiresAt, nil
+}
+
+// scopesCover indica si los permisos del llamante incluyen todos los de target
+func scopesCover(caller, target []string) bool {
+	if caller == nil {
+		return true
+	}
+	if target == nil {
+		return false
+	}
+	for _, scope := range target {
+		if !hasScope(caller, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// nonNilStrings devuelve una lista vacía en lugar de nil para serializarla como []
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// handleAPIKey atiende /api/keys/{id} (DELETE revoca, PATCH renombra) y
+// /api/keys/{id}/rotate (POST)
+func handleAPIKey(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/keys/"), "/")
+	keyID, action, _ := strings.Cut(path, "/")
+
+	switch {
+	case action == "" && r.Method == http.MethodDelete:
+		handleDeleteAPIKey(w, r)
+	case action == "" && r.Method == http.MethodPatch:
+		handleUpdateAPIKey(w, r, keyID)
+	case action == "rotate" && r.Method == http.MethodPost:
+		handleRotateAPIKey(w, r, keyID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUpdateAPIKey cambia el nombre, la descripción y las restricciones de
+// IP y origen de una clave
+func handleUpdateAPIKey(w http.ResponseWriter, r *http.Request, keyID string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	who, err := authenticate(r)
+	if err != nil {
+		sendError(http.StatusUnauthorized, "unauthorized", "Se requiere autenticación")
+		return
+	}
+	if !requireScope(w, who, scopeKeysManage) {
+		return
+	}
+	userID := who.UserID
+
+	var body struct {
+		Name           *string   `json:"name"`
+		Description    *string   `json:"description"`
+		AllowedIPs     *[]string `json:"allowed_ips"`
+		AllowedOrigins *[]string `json:"allowed_origins"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendError(http.StatusBadRequest, "invalid_request", "Solicitud inválida: "+err.Error())
+		return
+	}
+
+	var name, description, ipList, originList string
+	err = db.QueryRow(
+		"SELECT name, COALESCE(description, ''), COALESCE(allowed_ips, ''), COALESCE(allowed_origins, '') "+
+			"FROM api_keys WHERE id = ? AND user_id = ?",
+		keyID, userID,
+	).Scan(&name, &description, &ipList, &originList)
+	if err == sql.ErrNoRows {
+		sendError(http.StatusNotFound, "key_not_found", "Clave no encontrada")
+		return
+	}
+	if err != nil {
+		log.Printf("Error al consultar la clave API: %v", err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al obtener la clave API")
+		return
+	}
+
+	if body.Name != nil {
+		name = strings.TrimSpace(*body.Name)
+	}
+	if body.Description != nil {
+		description = strings.TrimSpace(*body.Description)
+	}
+	if err := validateKeyName(name, description); err != nil {
+		sendError(http.StatusBadRequest, "invalid_key_options", err.Error())
+		return
+	}
+
+	// Una lista vacía elimina la restricción
+	allowedIPs := strings.Fields(ipList)
+	if body.AllowedIPs != nil {
+		if allowedIPs, err = normalizeAllowedIPs(*body.AllowedIPs); err != nil {
+			sendError(http.StatusBadRequest, "invalid_key_options", err.Error())
+			return
+		}
+	}
+	allowedOrigins := strings.Fields(originList)
+	if body.AllowedOrigins != nil {
+		if allowedOrigins, err = normalizeAllowedOrigins(*body.AllowedOrigins); err != nil {
+			sendError(http.StatusBadRequest, "invalid_key_options", err.Error())
+			return
+		}
+	}
+
+	_, err = db.Exec(
+		"UPDATE api_keys SET name = ?, description = NULLIF(?, ''), allowed_ips = NULLIF(?, ''), allowed_origins = NULLIF(?, '') "+
+			"WHERE id = ? AND user_id = ?",
+		name, description, strings.Join(allowedIPs, " "), strings.Join(allowedOrigins, " "), keyID, userID,
+	)
+	if err != nil {
+		log.Printf("Error al actualizar la clave API: %v", err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al actualizar la clave API")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":         true,
+		"id":              keyID,
+		"name":            name,
+		"description":     description,
+		"allowed_ips":     nonNilStrings(allowedIPs),
+		"allowed_origins": nonNilStrings(allowedOrigins),
+	})
+}
+
+// handleRotateAPIKey emite una clave nueva con la misma configuración y deja
+// la anterior activa durante un periodo de gracia antes de que caduque
+func handleRotateAPIKey(w http.ResponseWriter, r *http.Request, keyID string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	who, err := authenticate(r)
+	if err != nil {
+		sendError(http.StatusUnauthorized, "unauthorized", "Se requiere autenticación")
+		return
+	}
+	if !requireScope(w, who, scopeKeysManage) {
+		return
+	}
+	userID := who.UserID
+
+	// El cuerpo es opcional
+	var body struct {
+		GracePeriodMinutes *int   `json:"grace_period_minutes"`
+		ExpiresAt          string `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		sendError(http.StatusBadRequest, "invalid_request", "Solicitud inválida: "+err.Error())
+		return
+	}
+	grace := defaultRotationGrace
+	if body.GracePeriodMinutes != nil {
+		grace = *body.GracePeriodMinutes
+		if grace < 0 || grace > maxRotationGrace {
+			sendError(http.StatusBadRequest, "invalid_key_options", fmt.Sprintf("'grace_period_minutes' debe estar entre 0 y %d", maxRotationGrace))
+			return
+		}
+	}
+	expiresAt, err := parseKeyExpiry(body.ExpiresAt)
+	if err != nil {
+		sendError(http.StatusBadRequest, "invalid_key_options", err.Error())
+		return
+	}
+
+	var (
+		record         apiKeyRecord
+		description    sql.NullString
+		respectRobots  sql.NullBool
+		searchProvider sql.NullString
+		scopes         sql.NullString
+		allowedIPs     sql.NullString
+		allowedOrigins sql.NullString
+		revoked        sql.NullBool
+		expired        bool
+	)
+	err = db.QueryRow(
+		"SELECT name, description, respect_robots, search_provider, scopes, allowed_ips, allowed_origins, revoked, "+
+			"COALESCE(expires_at <= datetime('now'), 0) FROM api_keys WHERE id = ? AND user_id = ?",
+		keyID, userID,
+	).Scan(&record.Name, &description, &respectRobots, &searchProvider, &scopes, &allowedIPs, &allowedOrigins, &revoked, &expired)
+	if err == sql.ErrNoRows {
+		sendError(http.StatusNotFound, "key_not_found", "Clave no encontrada")
+		return
+	}
+	if err != nil {
+		log.Printf("Error al consultar la clave API: %v", err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al obtener la clave API")
+		return
+	}
+	if (revoked.Valid && revoked.Bool) || expired {
+		sendError(http.StatusConflict, "key_inactive", "No se puede rotar una clave revocada o caducada")
+		return
+	}
+
+	record.Description = description.String
+	record.RespectRobots = respectRobots.Valid && respectRobots.Bool
+	record.SearchProvider = searchProvider.String
+	record.ExpiresAt = expiresAt
+	if scopes.Valid {
+		record.Scopes = strings.Fields(scopes.String)
+	}
+	record.AllowedIPs = strings.Fields(allowedIPs.String)
+	record.AllowedOrigins = strings.Fields(allowedOrigins.String)
+
+	// Una API key con permisos no puede obtener una clave con más permisos que ella
+	if !scopesCover(who.scopes(), record.Scopes) {
+		sendError(http.StatusForbidden, "insufficient_scope", "La API key no puede rotar una clave con más permisos que ella")
+		return
+	}
+
+	newID, apiKey, err := insertAPIKey(userID, &record)
+	if err != nil {
+		log.Printf("Error al rotar la clave API: %v", err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al generar la clave API")
+		return
+	}
+
+	// La clave anterior caduca al acabar el periodo de gracia (o antes, si ya
+	// tenía una caducidad más próxima); sin periodo de gracia se revoca ya
+	if grace == 0 {
+		_, err = db.Exec("UPDATE api_keys SET revoked = 1, revoked_at = CURRENT_TIMESTAMP, replaced_by = ? WHERE id = ?", newID, keyID)
+	} else {
+		until := fmt.Sprintf("+%d minutes", grace)
+		_, err = db.Exec(
+			"UPDATE api_keys SET replaced_by = ?, expires_at = CASE "+
+				"WHEN expires_at IS NOT NULL AND expires_at < datetime('now', ?) THEN expires_at "+
+				"ELSE datetime('now', ?) END WHERE id = ?",
+			newID, until, until, keyID,
+		)
+	}
+	if err != nil {
+		log.Printf("Error al retirar la clave API rotada: %v", err)
+	}
+
+	var oldExpiresAt sql.NullTime
+	db.QueryRow("SELECT expires_at FROM api_keys WHERE id = ?", keyID).Scan(&oldExpiresAt)
+
+	response := map[string]interface{}{
+		"success":         true,
+		"id":              newID,
+		"key":             apiKey,
+		"prefix":          auth.APIKeyPrefix(apiKey),
+		"name":            record.Name,
+		"scopes":          record.Scopes,
+		"replaces":        keyID,
+		"allowed_ips":     nonNilStrings(record.AllowedIPs),
+		"allowed_origins": nonNilStrings(record.AllowedOrigins),
+		"grace_period":    grace,
+	}
+	if expiresAt != nil {
+		response["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
+	if oldExpiresAt.Valid {
+		response["previous_expires_at"] = oldExpiresAt.Time.UTC().Format(time.RFC3339)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,638 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"toolbox/email"
+	"toolbox/tools"
+)
+
+const (
+	defaultMonitorInterval = 60
+	minMonitorInterval     = 5
+	maxMonitorInterval     = 7 * 24 * 60
+	maxMonitorsPerUser     = 50
+	// monitorSnapshotsKept es el número de instantáneas que se conservan por monitor
+	monitorSnapshotsKept = 50
+	// monitorTick es la frecuencia con la que el planificador busca monitores pendientes
+	monitorTick            = 30 * time.Second
+	monitorConcurrency     = 4
+	monitorWebhookTimeout  = 10 * time.Second
+	monitorCheckTimeout    = 2 * time.Minute
+	monitorSnapshotsListed = 20
+)
+
+// monitor es un monitor de cambios registrado por un usuario
+type monitor struct {
+	ID              string
+	UserID          int64
+	OwnerEmail      string
+	URL             string
+	Selector        string
+	Format          string
+	IntervalMinutes int
+	Threshold       float64
+	WebhookURL      string
+	NotifyEmail     bool
+	RespectRobots   bool
+	FetchOptions    string // JSON con headers, cookies, auth, user_agent, timeout y redirecciones
+}
+
+// monitorCheck es el resultado de comprobar un monitor
+type monitorCheck struct {
+	Baseline      bool    `json:"baseline"`
+	Changed       bool    `json:"changed"`
+	ChangePercent float64 `json:"change_percent"`
+	Notified      bool    `json:"notified"`
+	Diff          string  `json:"diff,omitempty"`
+}
+
+// monitorsRunning evita comprobar el mismo monitor dos veces a la vez
+var (
+	monitorsRunning   = map[string]bool{}
+	monitorsRunningMu sync.Mutex
+)
+
+// StartMonitorScheduler lanza el planificador que comprueba periódicamente los
+// monitores pendientes. Se detiene al cancelar ctx.
+func StartMonitorScheduler(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(monitorTick)
+		defer ticker.Stop()
+
+		for {
+			runDueMonitors(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+const monitorSelect = `SELECT m.id, m.user_id, u.email, m.url, COALESCE(m.selector, ''), m.format, m.interval_minutes,
+	m.threshold, COALESCE(m.webhook_url, ''), COALESCE(m.notify_email, 0), COALESCE(m.respect_robots, 0),
+	m.fetch_options FROM monitors m JOIN users u ON u.id = m.user_id`
+
+func scanMonitor(row interface{ Scan(...interface{}) error }) (*monitor, error) {
+	m := &monitor{}
+	err := row.Scan(&m.ID, &m.UserID, &m.OwnerEmail, &m.URL, &m.Selector, &m.Format, &m.IntervalMinutes,
+		&m.Threshold, &m.WebhookURL, &m.NotifyEmail, &m.RespectRobots, &m.FetchOptions)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// fetchOptions reconstruye las opciones de descarga guardadas del monitor
+func (m *monitor) fetchOptions() (*tools.FetchOptions, error) {
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(m.FetchOptions), &payload); err != nil {
+		return nil, fmt.Errorf("opciones de descarga no válidas: %v", err)
+	}
+	payload["respect_robots"] = m.RespectRobots
+	return tools.ParseFetchOptions(payload)
+}
+
+// runDueMonitors comprueba los monitores activos cuya próxima comprobación ya venció
+func runDueMonitors(ctx context.Context) {
+	rows, err := db.Query(monitorSelect + " WHERE m.active = 1 AND m.next_check_at <= datetime('now') ORDER BY m.next_check_at LIMIT 100")
+	if err != nil {
+		log.Printf("Error al buscar monitores pendientes: %v", err)
+		return
+	}
+	var due []*monitor
+	for rows.Next() {
+		m, err := scanMonitor(rows)
+		if err != nil {
+			log.Printf("Error al leer monitor: %v", err)
+			continue
+		}
+		due = append(due, m)
+	}
+	rows.Close()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, monitorConcurrency)
+	for _, m := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(m *monitor) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, err := checkMonitor(ctx, m); err != nil {
+				log.Printf("Error al comprobar el monitor %s (%s): %v", m.ID, m.URL, err)
+			}
+		}(m)
+	}
+	wg.Wait()
+}
+
+// checkMonitor descarga la página, la compara con la última instantánea y
+// notifica si el cambio supera el umbral del monitor
+func checkMonitor(ctx context.Context, m *monitor) (*monitorCheck, error) {
+	monitorsRunningMu.Lock()
+	if monitorsRunning[m.ID] {
+		monitorsRunningMu.Unlock()
+		return nil, &tools.ToolError{Code: "monitor_busy", Message: "el monitor ya se está comprobando"}
+	}
+	monitorsRunning[m.ID] = true
+	monitorsRunningMu.Unlock()
+	defer func() {
+		monitorsRunningMu.Lock()
+		delete(monitorsRunning, m.ID)
+		monitorsRunningMu.Unlock()
+	}()
+
+	// Reprogramar antes de descargar para que un fallo no provoque reintentos en cada ciclo
+	db.Exec("UPDATE monitors SET next_check_at = datetime('now', ?) WHERE id = ?",
+		fmt.Sprintf("+%d minutes", m.IntervalMinutes), m.ID)
+
+	// Cada comprobación cuenta como una llamada a webfetch del plan
+	if err := chargeMonitorRun(m.UserID); err != nil {
+		db.Exec("UPDATE monitors SET last_checked_at = CURRENT_TIMESTAMP, last_error = ? WHERE id = ?", err.Error(), m.ID)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, monitorCheckTimeout)
+	defer cancel()
+
+	var content string
+	opts, err := m.fetchOptions()
+	if err == nil {
+		content, err = tools.FetchSnapshot(ctx, m.URL, m.Selector, m.Format, opts)
+	}
+	if err != nil {
+		db.Exec("UPDATE monitors SET last_checked_at = CURRENT_TIMESTAMP, last_error = ? WHERE id = ?", err.Error(), m.ID)
+		return nil, err
+	}
+	hash := tools.SnapshotHash(content)
+
+	var previous, previousHash string
+	err = db.QueryRow("SELECT content, content_hash FROM monitor_snapshots WHERE monitor_id = ? ORDER BY id DESC LIMIT 1", m.ID).
+		Scan(&previous, &previousHash)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	result := &monitorCheck{}
+	switch {
+	case err == sql.ErrNoRows:
+		// Primera comprobación: guardar la instantánea de referencia
+		result.Baseline = true
+		_, err = db.Exec("INSERT INTO monitor_snapshots (monitor_id, content, content_hash) VALUES (?, ?, ?)", m.ID, content, hash)
+
+	case previousHash == hash:
+		// Sin cambios: no se guarda una instantánea nueva
+		err = nil
+
+	default:
+		result.Changed = true
+		result.Diff, result.ChangePercent = tools.DiffSnapshots(previous, content)
+		if result.ChangePercent >= m.Threshold {
+			result.Notified = notifyMonitorChange(m, result)
+		}
+		_, err = db.Exec(
+			"INSERT INTO monitor_snapshots (monitor_id, content, content_hash, diff, change_percent, notified) VALUES (?, ?, ?, ?, ?, ?)",
+			m.ID, content, hash, result.Diff, result.ChangePercent, result.Notified,
+		)
+		if err == nil {
+			db.Exec("UPDATE monitors SET last_changed_at = CURRENT_TIMESTAMP WHERE id = ?", m.ID)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db.Exec("UPDATE monitors SET last_checked_at = CURRENT_TIMESTAMP, last_error = NULL WHERE id = ?", m.ID)
+
+	// Conservar solo las instantáneas más recientes
+	db.Exec(`DELETE FROM monitor_snapshots WHERE monitor_id = ? AND id NOT IN (
+		SELECT id FROM monitor_snapshots WHERE monitor_id = ? ORDER BY id DESC LIMIT ?)`,
+		m.ID, m.ID, monitorSnapshotsKept)
+
+	return result, nil
+}
+
+// notifyMonitorChange envía el webhook y/o el correo del monitor. Devuelve true
+// si al menos una notificación se entregó.
+func notifyMonitorChange(m *monitor, result *monitorCheck) bool {
+	notified := false
+
+	if m.WebhookURL != "" {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"event":          "monitor.changed",
+			"monitor_id":     m.ID,
+			"url":            m.URL,
+			"selector":       m.Selector,
+			"change_percent": result.ChangePercent,
+			"diff":           result.Diff,
+			"checked_at":     time.Now().UTC().Format(time.RFC3339),
+		})
+		client := &http.Client{Timeout: monitorWebhookTimeout}
+		req, err := http.NewRequest(http.MethodPost, m.WebhookURL, bytes.NewReader(payload))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("User-Agent", "Toolbox-Monitor/1.0")
+			req.Header.Set("X-Toolbox-Event", "monitor.changed")
+			var resp *http.Response
+			resp, err = client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode >= 300 {
+					err = fmt.Errorf("el webhook respondió con el código %d", resp.StatusCode)
+				}
+			}
+		}
+		if err != nil {
+			log.Printf("Error al enviar webhook del monitor %s: %v", m.ID, err)
+		} else {
+			notified = true
+		}
+	}
+
+	if m.NotifyEmail {
+		if err := email.SendMonitorChange(m.OwnerEmail, m.URL, result.Diff, result.ChangePercent); err != nil {
+			log.Printf("Error al enviar correo del monitor %s: %v", m.ID, err)
+		} else {
+			notified = true
+		}
+	}
+
+	return notified
+}
+
+// monitorJSON convierte una fila de monitors en la respuesta de la API
+func monitorJSON(row interface{ Scan(...interface{}) error }) (map[string]interface{}, error) {
+	var (
+		id, monitorURL, format              string
+		selector, webhookURL, lastError     sql.NullString
+		interval                            int
+		threshold                           float64
+		notifyEmail, respectRobots, active  bool
+		lastChecked, lastChanged, nextCheck sql.NullTime
+		createdAt                           time.Time
+	)
+	err := row.Scan(&id, &monitorURL, &selector, &format, &interval, &threshold, &webhookURL, &notifyEmail,
+		&respectRobots, &active, &lastChecked, &lastChanged, &lastError, &nextCheck, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"id":               id,
+		"url":              monitorURL,
+		"selector":         selector.String,
+		"format":           format,
+		"interval_minutes": interval,
+		"threshold":        threshold,
+		"webhook_url":      webhookURL.String,
+		"notify_email":     notifyEmail,
+		"respect_robots":   respectRobots,
+		"active":           active,
+		"created_at":       createdAt.Format(time.RFC3339),
+	}
+	for key, value := range map[string]sql.NullTime{"last_checked_at": lastChecked, "last_changed_at": lastChanged, "next_check_at": nextCheck} {
+		if value.Valid {
+			data[key] = value.Time.Format(time.RFC3339)
+		}
+	}
+	if lastError.Valid {
+		data["last_error"] = lastError.String
+	}
+	return data, nil
+}
+
+const monitorColumns = `id, url, selector, format, interval_minutes, threshold, webhook_url, COALESCE(notify_email, 0),
+	COALESCE(respect_robots, 0), COALESCE(active, 1), last_checked_at, last_changed_at, last_error, next_check_at, created_at`
+
+// handleMonitors maneja /api/monitors y /api/monitors/{id}[/check]
+func handleMonitors(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	who, err := authenticate(r)
+	if err != nil {
+		sendError(http.StatusUnauthorized, "unauthorized", "Se requiere autenticación")
+		return
+	}
+	// Los monitores repiten webfetch periódicamente
+	if !requireScope(w, who, "tool:webfetch") {
+		return
+	}
+	userID := who.UserID
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/monitors"), "/"), "/")
+	monitorID, action := parts[0], ""
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+
+	if monitorID == "" {
+		switch r.Method {
+		case http.MethodGet:
+			listMonitors(w, userID, sendError)
+		case http.MethodPost:
+			createMonitor(w, r, who, sendError)
+		default:
+			sendError(http.StatusMethodNotAllowed, "method_not_allowed", "Método no permitido")
+		}
+		return
+	}
+
+	data, err := monitorJSON(db.QueryRow("SELECT "+monitorColumns+" FROM monitors WHERE id = ? AND user_id = ?", monitorID, userID))
+	if err == sql.ErrNoRows {
+		sendError(http.StatusNotFound, "monitor_not_found", "Monitor no encontrado")
+		return
+	}
+	if err != nil {
+		log.Printf("Error al obtener monitor %s: %v", monitorID, err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al obtener el monitor")
+		return
+	}
+
+	switch {
+	case action == "check" && r.Method == http.MethodPost:
+		// Comprobación inmediata, fuera del calendario; consume fichas como /api/tool
+		if !checkRateLimit(w, toolRateBuckets(r, who), toolCost("webfetch")) {
+			return
+		}
+		m, err := scanMonitor(db.QueryRow(monitorSelect+" WHERE m.id = ?", monitorID))
+		if err != nil {
+			sendError(http.StatusInternalServerError, "database_error", "Error al obtener el monitor")
+			return
+		}
+		result, err := checkMonitor(r.Context(), m)
+		if err != nil {
+			status := toolErrorStatus(err, http.StatusBadGateway)
+			if toolErrorCode(err, "") == "monitor_busy" {
+				status = http.StatusConflict
+			}
+			sendError(status, toolErrorCode(err, "monitor_check_failed"), err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"check":   result,
+		})
+
+	case action == "" && r.Method == http.MethodGet:
+		rows, err := db.Query(`SELECT id, content_hash, diff, change_percent, COALESCE(notified, 0), created_at
+			FROM monitor_snapshots WHERE monitor_id = ? ORDER BY id DESC LIMIT ?`, monitorID, monitorSnapshotsListed)
+		if err != nil {
+			sendError(http.StatusInternalServerError, "database_error", "Error al obtener las instantáneas")
+			return
+		}
+		defer rows.Close()
+
+		snapshots := []map[string]interface{}{}
+		for rows.Next() {
+			var (
+				id            int64
+				hash          string
+				diff          sql.NullString
+				changePercent sql.NullFloat64
+				notified      bool
+				createdAt     time.Time
+			)
+			if err := rows.Scan(&id, &hash, &diff, &changePercent, &notified, &createdAt); err != nil {
+				log.Printf("Error al leer instantánea: %v", err)
+				continue
+			}
+			snapshot := map[string]interface{}{
+				"id":           id,
+				"content_hash": hash,
+				"notified":     notified,
+				"created_at":   createdAt.Format(time.RFC3339),
+			}
+			if diff.Valid {
+				snapshot["diff"] = diff.String
+				snapshot["change_percent"] = changePercent.Float64
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"monitor":   data,
+			"snapshots": snapshots,
+		})
+
+	case action == "" && r.Method == http.MethodDelete:
+		if _, err := db.Exec("DELETE FROM monitor_snapshots WHERE monitor_id = ?", monitorID); err != nil {
+			sendError(http.StatusInternalServerError, "database_error", "Error al eliminar el monitor")
+			return
+		}
+		if _, err := db.Exec("DELETE FROM monitors WHERE id = ? AND user_id = ?", monitorID, userID); err != nil {
+			sendError(http.StatusInternalServerError, "database_error", "Error al eliminar el monitor")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Monitor eliminado correctamente",
+		})
+
+	default:
+		sendError(http.StatusMethodNotAllowed, "method_not_allowed", "Método no permitido")
+	}
+}
+
+func listMonitors(w http.ResponseWriter, userID int64, sendError func(int, string, string)) {
+	rows, err := db.Query("SELECT "+monitorColumns+" FROM monitors WHERE user_id = ? ORDER BY created_at DESC", userID)
+	if err != nil {
+		log.Printf("Error al listar monitores: %v", err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al obtener los monitores")
+		return
+	}
+	defer rows.Close()
+
+	monitors := []map[string]interface{}{}
+	for rows.Next() {
+		data, err := monitorJSON(rows)
+		if err != nil {
+			log.Printf("Error al leer monitor: %v", err)
+			continue
+		}
+		monitors = append(monitors, data)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"monitors": monitors,
+	})
+}
+
+func createMonitor(w http.ResponseWriter, r *http.Request, who *caller, sendError func(int, string, string)) {
+	userID := who.UserID
+
+	var req struct {
+		URL             string   `json:"url"`
+		Selector        string   `json:"selector"`
+		Format          string   `json:"format"`
+		IntervalMinutes *int     `json:"interval_minutes"`
+		Threshold       *float64 `json:"threshold"`
+		WebhookURL      string   `json:"webhook_url"`
+		NotifyEmail     bool     `json:"notify_email"`
+		RespectRobots   bool     `json:"respect_robots"`
+		// Opciones de descarga, las mismas que en webfetch salvo method y body
+		Headers         map[string]interface{} `json:"headers"`
+		Cookies         map[string]interface{} `json:"cookies"`
+		Auth            map[string]interface{} `json:"auth"`
+		UserAgent       string                 `json:"user_agent"`
+		Timeout         *float64               `json:"timeout"`
+		FollowRedirects *bool                  `json:"follow_redirects"`
+		MaxRedirects    *float64               `json:"max_redirects"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(http.StatusBadRequest, "invalid_request", "Error al decodificar el cuerpo de la solicitud")
+		return
+	}
+
+	parsed, err := url.ParseRequestURI(req.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		sendError(http.StatusBadRequest, "invalid_url", "URL inválida. Debe comenzar con http:// o https://")
+		return
+	}
+
+	if req.Selector != "" {
+		if err := tools.ValidateSelector(req.Selector); err != nil {
+			sendError(http.StatusBadRequest, "invalid_selector", err.Error())
+			return
+		}
+	}
+
+	switch req.Format {
+	case "":
+		req.Format = "text"
+	case "text", "markdown":
+	default:
+		sendError(http.StatusBadRequest, "invalid_format", "Formato no válido. Use 'text' o 'markdown'")
+		return
+	}
+
+	interval := defaultMonitorInterval
+	if req.IntervalMinutes != nil {
+		interval = *req.IntervalMinutes
+		if interval < minMonitorInterval || interval > maxMonitorInterval {
+			sendError(http.StatusBadRequest, "invalid_interval", fmt.Sprintf("El intervalo debe estar entre %d y %d minutos", minMonitorInterval, maxMonitorInterval))
+			return
+		}
+	}
+
+	threshold := 0.0
+	if req.Threshold != nil {
+		threshold = *req.Threshold
+		if threshold < 0 || threshold > 100 {
+			sendError(http.StatusBadRequest, "invalid_threshold", "El umbral debe ser un porcentaje entre 0 y 100")
+			return
+		}
+	}
+
+	if req.WebhookURL != "" {
+		webhook, err := url.ParseRequestURI(req.WebhookURL)
+		if err != nil || (webhook.Scheme != "http" && webhook.Scheme != "https") || webhook.Host == "" {
+			sendError(http.StatusBadRequest, "invalid_webhook_url", "La URL del webhook no es válida")
+			return
+		}
+	}
+
+	// Guardar solo las opciones de descarga indicadas, validadas como en webfetch
+	fetchPayload := map[string]interface{}{}
+	if req.Headers != nil {
+		fetchPayload["headers"] = req.Headers
+	}
+	if req.Cookies != nil {
+		fetchPayload["cookies"] = req.Cookies
+	}
+	if req.Auth != nil {
+		fetchPayload["auth"] = req.Auth
+	}
+	if req.UserAgent != "" {
+		fetchPayload["user_agent"] = req.UserAgent
+	}
+	if req.Timeout != nil {
+		fetchPayload["timeout"] = *req.Timeout
+	}
+	if req.FollowRedirects != nil {
+		fetchPayload["follow_redirects"] = *req.FollowRedirects
+	}
+	if req.MaxRedirects != nil {
+		fetchPayload["max_redirects"] = *req.MaxRedirects
+	}
+	if _, err := tools.ParseFetchOptions(fetchPayload); err != nil {
+		sendError(http.StatusBadRequest, toolErrorCode(err, "invalid_request_options"), err.Error())
+		return
+	}
+	if p, err := loadUserPlan(userID); err == nil {
+		if err := checkPlanOptions(&p.plan, "webfetch", fetchPayload); err != nil {
+			sendError(http.StatusForbidden, "plan_limit_exceeded", err.Error())
+			return
+		}
+	}
+	fetchOptions, _ := json.Marshal(fetchPayload)
+
+	// Las API keys que respetan robots.txt lo imponen también en sus monitores
+	if who.Key != nil && who.Key.RespectRobots {
+		req.RespectRobots = true
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM monitors WHERE user_id = ?", userID).Scan(&count); err != nil {
+		sendError(http.StatusInternalServerError, "database_error", "Error al crear el monitor")
+		return
+	}
+	if count >= maxMonitorsPerUser {
+		sendError(http.StatusConflict, "monitor_limit_reached", fmt.Sprintf("Se alcanzó el máximo de %d monitores", maxMonitorsPerUser))
+		return
+	}
+
+	random, err := generateRandomString(16)
+	if err != nil {
+		sendError(http.StatusInternalServerError, "internal_error", "Error al crear el monitor")
+		return
+	}
+	monitorID := "mon_" + random
+
+	_, err = db.Exec(`INSERT INTO monitors (id, user_id, url, selector, format, interval_minutes, threshold, webhook_url, notify_email, respect_robots, fetch_options)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		monitorID, userID, parsed.String(), req.Selector, req.Format, interval, threshold, req.WebhookURL, req.NotifyEmail, req.RespectRobots, string(fetchOptions))
+	if err != nil {
+		log.Printf("Error al crear monitor: %v", err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al crear el monitor")
+		return
+	}
+
+	data, err := monitorJSON(db.QueryRow("SELECT "+monitorColumns+" FROM monitors WHERE id = ?", monitorID))
+	if err != nil {
+		sendError(http.StatusInternalServerError, "database_error", "Error al obtener el monitor")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"monitor": data,
+	})
+}
@@ -0,0 +1,425 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"toolbox/tools"
+)
+
+// quotaTick es cada cuánto el planificador renueva los periodos de cuota vencidos
+const quotaTick = time.Hour
+
+// plan describe un plan de la tabla plans; los límites a 0 son ilimitados
+type plan struct {
+	ID             string         `json:"id"`
+	Name           string         `json:"name"`
+	MonthlyCalls   int            `json:"monthly_calls"`
+	ToolQuotas     map[string]int `json:"tool_quotas"`
+	MaxConcurrency int            `json:"max_concurrency"`
+	MaxTimeout     int            `json:"max_timeout"`
+	MaxCrawlPages  int            `json:"max_crawl_pages"`
+	AllowFullPage  bool           `json:"allow_full_page"`
+}
+
+// userPlan es el plan de un usuario junto con su periodo de cuota en curso
+type userPlan struct {
+	plan
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+}
+
+// loadUserPlan devuelve el plan del usuario, renovando antes el periodo de
+// cuota si ya terminó
+func loadUserPlan(userID int64) (*userPlan, error) {
+	if err := renewQuotaPeriod(userID); err != nil {
+		return nil, err
+	}
+
+	p := &userPlan{}
+	var toolQuotas string
+	var start, end sql.NullTime
+	err := db.QueryRow(`SELECT p.id, p.name, p.monthly_calls, p.tool_quotas, p.max_concurrency, p.max_timeout,
+		p.max_crawl_pages, p.allow_full_page, u.quota_period_start, u.quota_period_end
+		FROM users u JOIN plans p ON p.id = u.plan WHERE u.id = ?`, userID,
+	).Scan(&p.ID, &p.Name, &p.MonthlyCalls, &toolQuotas, &p.MaxConcurrency, &p.MaxTimeout,
+		&p.MaxCrawlPages, &p.AllowFullPage, &start, &end)
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener el plan del usuario: %v", err)
+	}
+	if err := json.Unmarshal([]byte(toolQuotas), &p.ToolQuotas); err != nil {
+		return nil, fmt.Errorf("cuotas por herramienta no válidas en el plan %s: %v", p.ID, err)
+	}
+	p.PeriodStart, p.PeriodEnd = start.Time, end.Time
+	return p, nil
+}
+
+// renewQuotaPeriod inicia un periodo mensual si el usuario no tiene ninguno o
+// el actual ya terminó, y pone a cero sus contadores de cuota
+func renewQuotaPeriod(userID int64) error {
+	var start, end sql.NullTime
+	if err := db.QueryRow("SELECT quota_period_start, quota_period_end FROM users WHERE id = ?", userID).Scan(&start, &end); err != nil {
+		return fmt.Errorf("error al obtener el periodo de cuota: %v", err)
+	}
+
+	now := time.Now().UTC()
+	if end.Valid && end.Time.After(now) {
+		return nil
+	}
+
+	// Los periodos se encadenan desde el anterior para conservar la fecha de renovación
+	newStart := now
+	if end.Valid {
+		newStart = end.Time.UTC()
+		for !newStart.AddDate(0, 1, 0).After(now) {
+			newStart = newStart.AddDate(0, 1, 0)
+		}
+	}
+	newEnd := newStart.AddDate(0, 1, 0)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"UPDATE users SET quota_period_start = ?, quota_period_end = ? WHERE id = ? AND (quota_period_end IS NULL OR quota_period_end <= ?)",
+		newStart.Format("2006-01-02 15:04:05"), newEnd.Format("2006-01-02 15:04:05"), userID, now.Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return fmt.Errorf("error al renovar el periodo de cuota: %v", err)
+	}
+	// Otra petición ya lo renovó
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+	if _, err := tx.Exec("DELETE FROM quota_usage WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("error al reiniciar la cuota: %v", err)
+	}
+	return tx.Commit()
+}
+
+// StartQuotaScheduler renueva periódicamente los periodos de cuota vencidos
+// hasta que se cancele el contexto
+func StartQuotaScheduler(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(quotaTick)
+		defer ticker.Stop()
+
+		for {
+			renewExpiredQuotaPeriods()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// renewExpiredQuotaPeriods reinicia las cuotas de los usuarios cuyo periodo terminó
+func renewExpiredQuotaPeriods() {
+	rows, err := db.Query("SELECT id FROM users WHERE quota_period_end <= ?", time.Now().UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		log.Printf("Error al consultar periodos de cuota vencidos: %v", err)
+		return
+	}
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range userIDs {
+		if err := renewQuotaPeriod(id); err != nil {
+			log.Printf("Error al renovar la cuota del usuario %d: %v", id, err)
+		}
+	}
+}
+
+// checkPlanOptions comprueba que las opciones del payload están permitidas en el plan
+func checkPlanOptions(p *plan, tool string, payload map[string]interface{}) error {
+	if t, ok := payload["timeout"].(float64); ok && p.MaxTimeout > 0 && t > float64(p.MaxTimeout) {
+		return fmt.Errorf("el plan %s permite un 'timeout' máximo de %d segundos", p.Name, p.MaxTimeout)
+	}
+	if fullPage, _ := payload["full_page"].(bool); fullPage && !p.AllowFullPage {
+		return fmt.Errorf("el plan %s no permite capturas de página completa", p.Name)
+	}
+	if n, ok := payload["max_pages"].(float64); ok && tool == "crawl" && p.MaxCrawlPages > 0 && n > float64(p.MaxCrawlPages) {
+		return fmt.Errorf("el plan %s permite rastrear como máximo %d páginas", p.Name, p.MaxCrawlPages)
+	}
+	return nil
+}
+
+// fullPageTools son las herramientas que capturan la página completa por
+// defecto cuando el plan lo permite
+var fullPageTools = map[string]bool{"screenshot": true, "visual_diff": true}
+
+// applyPlanDefaults completa las opciones que el payload no indica con los
+// valores por defecto del plan
+func applyPlanDefaults(p *plan, tool string, payload map[string]interface{}) {
+	if _, ok := payload["full_page"]; !ok && fullPageTools[tool] {
+		payload["full_page"] = p.AllowFullPage
+	}
+}
+
+// quotaStatus es el estado de la cuota más restrictiva para una herramienta
+type quotaStatus struct {
+	Limit     int // 0 = ilimitada
+	Remaining int
+}
+
+// toolQuotaStatus calcula lo que queda de la cuota mensual total y de la de
+// la herramienta, y devuelve la más restrictiva
+func toolQuotaStatus(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, userID int64, p *plan, tool string) (quotaStatus, error) {
+	var total, toolCalls int
+	err := q.QueryRow(
+		"SELECT COALESCE(SUM(calls), 0), COALESCE(SUM(CASE WHEN tool = ? THEN calls END), 0) FROM quota_usage WHERE user_id = ?",
+		tool, userID,
+	).Scan(&total, &toolCalls)
+	if err != nil {
+		return quotaStatus{}, fmt.Errorf("error al consultar la cuota: %v", err)
+	}
+
+	status := quotaStatus{}
+	consider := func(limit, used int) {
+		if limit <= 0 {
+			return
+		}
+		remaining := limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		if status.Limit == 0 || remaining < status.Remaining {
+			status = quotaStatus{Limit: limit, Remaining: remaining}
+		}
+	}
+	consider(p.MonthlyCalls, total)
+	consider(p.ToolQuotas[tool], toolCalls)
+	return status, nil
+}
+
+// consumeQuota descuenta una llamada si cabe en la cuota mensual total y en
+// la de la herramienta. La comprobación y el incremento son una sola UPDATE
+// condicional, así que las peticiones simultáneas no pueden sobrepasar la
+// cuota. Devuelve el estado tras descontar y si la llamada se admitió.
+func consumeQuota(userID int64, p *plan, tool string) (quotaStatus, bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return quotaStatus{}, false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO quota_usage (user_id, tool, calls) VALUES (?, ?, 0) ON CONFLICT(user_id, tool) DO NOTHING", userID, tool); err != nil {
+		return quotaStatus{}, false, fmt.Errorf("error al descontar la cuota: %v", err)
+	}
+	toolLimit := p.ToolQuotas[tool]
+	result, err := tx.Exec(`UPDATE quota_usage SET calls = calls + 1
+		WHERE user_id = ? AND tool = ?
+		AND (? <= 0 OR calls < ?)
+		AND (? <= 0 OR (SELECT SUM(calls) FROM quota_usage WHERE user_id = ?) < ?)`,
+		userID, tool, toolLimit, toolLimit, p.MonthlyCalls, userID, p.MonthlyCalls,
+	)
+	if err != nil {
+		return quotaStatus{}, false, fmt.Errorf("error al descontar la cuota: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return quotaStatus{}, false, err
+	}
+
+	status, err := toolQuotaStatus(tx, userID, p, tool)
+	if err != nil {
+		return quotaStatus{}, false, err
+	}
+	return status, n == 1, tx.Commit()
+}
+
+// chargeMonitorRun descuenta una comprobación de monitor de la cuota de
+// webfetch del usuario. Devuelve un *tools.ToolError quota_exceeded si la
+// cuota está agotada.
+func chargeMonitorRun(userID int64) error {
+	p, err := loadUserPlan(userID)
+	if err != nil {
+		// Igual que en enforcePlan, un fallo al leer el plan no bloquea la comprobación
+		log.Printf("Error al aplicar el plan: %v", err)
+		return nil
+	}
+	_, admitted, err := consumeQuota(userID, &p.plan, "webfetch")
+	if err != nil {
+		log.Printf("Error al aplicar el plan: %v", err)
+		return nil
+	}
+	if !admitted {
+		return &tools.ToolError{
+			Code:    "quota_exceeded",
+			Message: fmt.Sprintf("Cuota mensual agotada para 'webfetch' en el plan %s; se renueva el %s", p.Name, p.PeriodEnd.UTC().Format("2006-01-02")),
+		}
+	}
+	return nil
+}
+
+// activeCalls cuenta las llamadas en curso por usuario para limitar la concurrencia
+var activeCalls = struct {
+	sync.Mutex
+	byUser map[int64]int
+}{byUser: map[int64]int{}}
+
+// acquireConcurrency reserva un hueco de ejecución; devuelve false si el
+// usuario ya tiene max llamadas en curso. jobs son los trabajos asíncronos
+// que tiene en marcha y también cuentan
+func acquireConcurrency(userID int64, max, jobs int) (func(), bool) {
+	activeCalls.Lock()
+	defer activeCalls.Unlock()
+	if max > 0 && activeCalls.byUser[userID]+jobs >= max {
+		return nil, false
+	}
+	activeCalls.byUser[userID]++
+	return func() {
+		activeCalls.Lock()
+		defer activeCalls.Unlock()
+		if activeCalls.byUser[userID]--; activeCalls.byUser[userID] <= 0 {
+			delete(activeCalls.byUser, userID)
+		}
+	}, true
+}
+
+// enforcePlan aplica el plan del usuario a una llamada a /api/tool: opciones
+// permitidas, cuota mensual y concurrencia. Escribe los encabezados X-Quota-*
+// y, si la llamada no puede continuar, la respuesta de error. Si la llamada
+// se admite se descuenta de la cuota y se devuelve la función que libera el
+// hueco de concurrencia.
+func enforcePlan(w http.ResponseWriter, userID int64, tool string, payload map[string]interface{}) (func(), bool) {
+	sendError := func(statusCode int, code, message string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	p, err := loadUserPlan(userID)
+	if err != nil {
+		// Un fallo al leer el plan no debe dejar el servicio sin respuesta
+		log.Printf("Error al aplicar el plan: %v", err)
+		return func() {}, true
+	}
+
+	if err := checkPlanOptions(&p.plan, tool, payload); err != nil {
+		sendError(http.StatusForbidden, "plan_limit_exceeded", err.Error())
+		return nil, false
+	}
+	applyPlanDefaults(&p.plan, tool, payload)
+
+	// Los trabajos asíncronos (crawl) siguen ocupando un hueco después de
+	// que termine la petición que los lanzó
+	jobs := 0
+	if p.MaxConcurrency > 0 {
+		if jobs, err = activeJobs(userID); err != nil {
+			log.Printf("Error al contar los trabajos en curso: %v", err)
+			jobs = 0
+		}
+	}
+	release, ok := acquireConcurrency(userID, p.MaxConcurrency, jobs)
+	if !ok {
+		sendError(http.StatusTooManyRequests, "concurrency_limit_exceeded",
+			fmt.Sprintf("El plan %s permite %d llamadas simultáneas", p.Name, p.MaxConcurrency))
+		return nil, false
+	}
+
+	status, admitted, err := consumeQuota(userID, &p.plan, tool)
+	if err != nil {
+		log.Printf("Error al aplicar el plan: %v", err)
+		return release, true
+	}
+	if status.Limit > 0 {
+		w.Header().Set("X-Quota-Limit", strconv.Itoa(status.Limit))
+		w.Header().Set("X-Quota-Remaining", strconv.Itoa(status.Remaining))
+		w.Header().Set("X-Quota-Reset", p.PeriodEnd.UTC().Format(time.RFC3339))
+	}
+	if !admitted {
+		release()
+		sendError(http.StatusTooManyRequests, "quota_exceeded",
+			fmt.Sprintf("Cuota mensual agotada para '%s' en el plan %s; se renueva el %s", tool, p.Name, p.PeriodEnd.UTC().Format("2006-01-02")))
+		return nil, false
+	}
+	return release, true
+}
+
+// handlePlan maneja GET /api/plan: plan del usuario y consumo del periodo en curso
+func handlePlan(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	if r.Method != http.MethodGet {
+		sendError(http.StatusMethodNotAllowed, "method_not_allowed", "Método no permitido")
+		return
+	}
+	who, err := authenticate(r)
+	if err != nil {
+		sendError(http.StatusUnauthorized, "unauthorized", "Se requiere autenticación")
+		return
+	}
+	if !requireScope(w, who, scopeReadUsage) {
+		return
+	}
+	userID := who.UserID
+
+	p, err := loadUserPlan(userID)
+	if err != nil {
+		log.Printf("Error al obtener el plan: %v", err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al obtener el plan")
+		return
+	}
+
+	rows, err := db.Query("SELECT tool, calls FROM quota_usage WHERE user_id = ? ORDER BY tool", userID)
+	if err != nil {
+		log.Printf("Error al consultar la cuota: %v", err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al obtener el consumo")
+		return
+	}
+	defer rows.Close()
+
+	used := map[string]int{}
+	total := 0
+	for rows.Next() {
+		var tool string
+		var calls int
+		if rows.Scan(&tool, &calls) == nil {
+			used[tool] = calls
+			total += calls
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"plan":          p.plan,
+		"period_start":  p.PeriodStart.UTC().Format(time.RFC3339),
+		"period_end":    p.PeriodEnd.UTC().Format(time.RFC3339),
+		"calls":         total,
+		"calls_by_tool": used,
+	})
+}
@@ -0,0 +1,358 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// toolCosts es el número de fichas que consume cada herramienta; las que no
+// aparecen cuestan 1
+var toolCosts = map[string]int{
+	"screenshot":  5,
+	"visual_diff": 5,
+	"crawl":       10,
+	"research":    5,
+	"search":      2,
+}
+
+// toolCost devuelve el coste de una herramienta para el limitador
+func toolCost(tool string) int {
+	if cost, ok := toolCosts[tool]; ok {
+		return cost
+	}
+	return 1
+}
+
+// rateBucket describe un cubo de fichas: Limit fichas que se rellenan por
+// completo en Period
+type rateBucket struct {
+	Key    string
+	Limit  int
+	Period time.Duration
+}
+
+// rate devuelve las fichas que se recuperan por segundo
+func (b rateBucket) rate() float64 {
+	return float64(b.Limit) / b.Period.Seconds()
+}
+
+// take devuelve las fichas que consume una petición de coste cost; si supera
+// la capacidad del cubo basta con tenerlo lleno
+func (b rateBucket) take(cost int) float64 {
+	return math.Min(float64(cost), float64(b.Limit))
+}
+
+// refill calcula las fichas disponibles tras el tiempo transcurrido
+func (b rateBucket) refill(tokens float64, updated, now time.Time) float64 {
+	tokens += now.Sub(updated).Seconds() * b.rate()
+	return math.Min(tokens, float64(b.Limit))
+}
+
+// rateDecision es el resultado de consultar el limitador
+type rateDecision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // tiempo hasta que el cubo más restrictivo se llena
+	RetryAfter time.Duration // tiempo de espera si la petición se rechaza
+}
+
+// rateLimiter consume cost fichas de todos los cubos a la vez, o de ninguno
+// si alguno no tiene suficientes
+type rateLimiter interface {
+	Take(buckets []rateBucket, cost int) (rateDecision, error)
+}
+
+// decide evalúa los cubos con sus fichas actuales y devuelve la decisión
+func decide(buckets []rateBucket, tokens []float64, cost int) rateDecision {
+	decision := rateDecision{Allowed: true, Remaining: math.MaxInt}
+	for i, b := range buckets {
+		if tokens[i] < b.take(cost) {
+			decision.Allowed = false
+			wait := time.Duration((b.take(cost) - tokens[i]) / b.rate() * float64(time.Second))
+			if wait > decision.RetryAfter {
+				decision.RetryAfter = wait
+			}
+		}
+	}
+	for i, b := range buckets {
+		left := tokens[i]
+		if decision.Allowed {
+			left -= b.take(cost)
+		}
+		if remaining := int(math.Max(left, 0)); remaining < decision.Remaining {
+			decision.Remaining = remaining
+			decision.Limit = b.Limit
+			decision.Reset = time.Duration((float64(b.Limit) - left) / b.rate() * float64(time.Second))
+		}
+	}
+	return decision
+}
+
+// memoryRateLimiter guarda los cubos en memoria (una sola máquina)
+type memoryRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// maxMemoryBuckets es el tamaño a partir del cual se descartan los cubos llenos
+const maxMemoryBuckets = 10000
+
+func newMemoryRateLimiter() *memoryRateLimiter {
+	return &memoryRateLimiter{buckets: map[string]*memoryBucket{}}
+}
+
+func (l *memoryRateLimiter) Take(buckets []rateBucket, cost int) (rateDecision, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if len(l.buckets) > maxMemoryBuckets {
+		// Un cubo sin uso durante todo su periodo está lleno y no hace falta guardarlo
+		for key, b := range l.buckets {
+			if now.Sub(b.updated) >= b.period {
+				delete(l.buckets, key)
+			}
+		}
+	}
+
+	tokens := make([]float64, len(buckets))
+	for i, b := range buckets {
+		tokens[i] = float64(b.Limit)
+		if stored, ok := l.buckets[b.Key]; ok {
+			tokens[i] = b.refill(stored.tokens, stored.updated, now)
+		}
+	}
+
+	decision := decide(buckets, tokens, cost)
+	if decision.Allowed {
+		for i, b := range buckets {
+			l.buckets[b.Key] = &memoryBucket{tokens: tokens[i] - b.take(cost), updated: now, period: b.Period}
+		}
+	}
+	return decision, nil
+}
+
+// sqliteRateLimiter guarda los cubos en la tabla rate_limits para compartirlos
+// entre varias máquinas que usen la misma base de datos
+type sqliteRateLimiter struct {
+	db *sql.DB
+}
+
+// sqliteBusyRetries y sqliteBusyBackoff controlan los reintentos cuando otra
+// petición tiene el bloqueo de escritura
+const (
+	sqliteBusyRetries = 5
+	sqliteBusyBackoff = 20 * time.Millisecond
+)
+
+// isSQLiteBusy indica si el error es SQLITE_BUSY (base de datos bloqueada)
+func isSQLiteBusy(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "SQLITE_BUSY") || strings.Contains(err.Error(), "database is locked"))
+}
+
+func (l *sqliteRateLimiter) Take(buckets []rateBucket, cost int) (rateDecision, error) {
+	ctx := context.Background()
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return rateDecision{}, err
+	}
+	defer conn.Close()
+
+	// BEGIN IMMEDIATE toma el bloqueo de escritura al empezar. Con una
+	// transacción diferida, la lectura seguida de escritura falla con
+	// SQLITE_BUSY en modo WAL cuando llegan peticiones concurrentes.
+	for attempt := 0; ; attempt++ {
+		_, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE")
+		if !isSQLiteBusy(err) || attempt >= sqliteBusyRetries {
+			break
+		}
+		time.Sleep(sqliteBusyBackoff * time.Duration(attempt+1))
+	}
+	if err != nil {
+		return rateDecision{}, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			conn.ExecContext(ctx, "ROLLBACK")
+		}
+	}()
+
+	now := time.Now()
+	tokens := make([]float64, len(buckets))
+	for i, b := range buckets {
+		var stored, updated float64
+		err := conn.QueryRowContext(ctx, "SELECT tokens, updated_at FROM rate_limits WHERE key = ?", b.Key).Scan(&stored, &updated)
+		switch {
+		case err == sql.ErrNoRows:
+			tokens[i] = float64(b.Limit)
+		case err != nil:
+			return rateDecision{}, err
+		default:
+			tokens[i] = b.refill(stored, time.Unix(0, int64(updated*float64(time.Second))), now)
+		}
+	}
+
+	decision := decide(buckets, tokens, cost)
+	if !decision.Allowed {
+		return decision, nil
+	}
+	for i, b := range buckets {
+		_, err := conn.ExecContext(ctx,
+			"INSERT INTO rate_limits (key, tokens, updated_at) VALUES (?, ?, ?) "+
+				"ON CONFLICT(key) DO UPDATE SET tokens = excluded.tokens, updated_at = excluded.updated_at",
+			b.Key, tokens[i]-b.take(cost), float64(now.UnixNano())/float64(time.Second),
+		)
+		if err != nil {
+			return rateDecision{}, err
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return rateDecision{}, err
+	}
+	committed = true
+	return decision, nil
+}
+
+// rateLimitConfig son los límites configurados; 0 desactiva el cubo
+type rateLimitConfig struct {
+	KeyPerMinute     int
+	UserPerMinute    int
+	IPPerMinute      int
+	MagicLinkPerHour int
+}
+
+var (
+	limiter    rateLimiter
+	rateLimits rateLimitConfig
+)
+
+// envInt lee un entero no negativo de una variable de entorno
+func envInt(name string, fallback int) int {
+	if value := os.Getenv(name); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+		log.Printf("Valor no válido para %s: %q, se usa %d", name, value, fallback)
+	}
+	return fallback
+}
+
+// setupRateLimiter configura el limitador a partir del entorno:
+// RATE_LIMIT_BACKEND (memory o sqlite), RATE_LIMIT_KEY_PER_MINUTE,
+// RATE_LIMIT_USER_PER_MINUTE, RATE_LIMIT_IP_PER_MINUTE y
+// RATE_LIMIT_MAGIC_LINK_PER_HOUR
+func setupRateLimiter(database *sql.DB) {
+	rateLimits = rateLimitConfig{
+		KeyPerMinute:     envInt("RATE_LIMIT_KEY_PER_MINUTE", 60),
+		UserPerMinute:    envInt("RATE_LIMIT_USER_PER_MINUTE", 120),
+		IPPerMinute:      envInt("RATE_LIMIT_IP_PER_MINUTE", 120),
+		MagicLinkPerHour: envInt("RATE_LIMIT_MAGIC_LINK_PER_HOUR", 5),
+	}
+
+	switch backend := os.Getenv("RATE_LIMIT_BACKEND"); backend {
+	case "sqlite":
+		limiter = &sqliteRateLimiter{db: database}
+	case "", "memory":
+		limiter = newMemoryRateLimiter()
+	default:
+		log.Printf("RATE_LIMIT_BACKEND desconocido %q, se usa memory", backend)
+		limiter = newMemoryRateLimiter()
+	}
+}
+
+// appendBucket añade un cubo si su límite está activado
+func appendBucket(buckets []rateBucket, key string, limit int, period time.Duration) []rateBucket {
+	if limit <= 0 {
+		return buckets
+	}
+	return append(buckets, rateBucket{Key: key, Limit: limit, Period: period})
+}
+
+// checkRateLimit consume cost fichas de los cubos indicados, escribe los
+// encabezados RateLimit-* y, si se supera el límite, responde 429 con el
+// código rate_limited. Devuelve false si la petición no debe continuar.
+func checkRateLimit(w http.ResponseWriter, buckets []rateBucket, cost int) bool {
+	if limiter == nil || len(buckets) == 0 {
+		return true
+	}
+
+	decision, err := limiter.Take(buckets, cost)
+	if err != nil {
+		// Si el limitador falla, rechazar: dejar pasar la petición anularía el
+		// límite justo en las ráfagas que debe frenar
+		log.Printf("Error en el limitador de peticiones: %v", err)
+		w.Header().Set("Retry-After", "1")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     false,
+			"error":       "No se pudo comprobar el límite de peticiones, reintenta en unos segundos",
+			"code":        "rate_limiter_unavailable",
+			"retry_after": 1,
+		})
+		return false
+	}
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(decision.Reset.Seconds()))))
+	if decision.Allowed {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     false,
+		"error":       fmt.Sprintf("Demasiadas peticiones, reintenta en %d s", retryAfter),
+		"code":        "rate_limited",
+		"retry_after": retryAfter,
+	})
+	return false
+}
+
+// toolRateBuckets devuelve los cubos de una llamada a /api/tool: por API key
+// (si la hay), por usuario y por IP
+func toolRateBuckets(r *http.Request, who *caller) []rateBucket {
+	var buckets []rateBucket
+	if who.Key != nil {
+		buckets = appendBucket(buckets, "key:"+who.Key.ID, rateLimits.KeyPerMinute, time.Minute)
+	}
+	buckets = appendBucket(buckets, "user:"+who.Email, rateLimits.UserPerMinute, time.Minute)
+	if ip := clientIP(r); ip != nil {
+		buckets = appendBucket(buckets, "ip:"+ip.String(), rateLimits.IPPerMinute, time.Minute)
+	}
+	return buckets
+}
+
+// magicLinkRateBuckets limita las solicitudes de enlace mágico por IP y por email
+func magicLinkRateBuckets(r *http.Request, email string) []rateBucket {
+	var buckets []rateBucket
+	if ip := clientIP(r); ip != nil {
+		buckets = appendBucket(buckets, "magic_ip:"+ip.String(), rateLimits.MagicLinkPerHour, time.Hour)
+	}
+	return appendBucket(buckets, "magic_email:"+strings.ToLower(email), rateLimits.MagicLinkPerHour, time.Hour)
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Permisos que se pueden asignar a una API key. Una clave sin permisos
+// explícitos (scopes NULL) conserva el acceso completo de las claves antiguas.
+const (
+	scopeKeysManage    = "keys:manage"
+	scopeReadUsage     = "read:usage"
+	scopeBillingManage = "billing:manage"
+)
+
+// toolScopes son las herramientas de /api/tool que admiten un permiso
+// tool:<nombre>. El permiso cubre también los recursos de la herramienta:
+// monitores (webfetch), trabajos (crawl), colecciones (collection_search) y
+// capturas guardadas (visual_diff).
+var toolScopes = []string{"webfetch", "screenshot", "crawl", "sitemap", "feed", "visual_diff", "collection_search", "research", "search"}
+
+// isSupportedTool indica si /api/tool admite la herramienta
+func isSupportedTool(tool string) bool {
+	for _, name := range toolScopes {
+		if name == tool {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyScopeNames devuelve todos los permisos válidos, ordenados
+func apiKeyScopeNames() []string {
+	names := []string{scopeKeysManage, scopeReadUsage, scopeBillingManage}
+	for _, tool := range toolScopes {
+		names = append(names, "tool:"+tool)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isAPIKeyScope indica si el permiso es uno de los reconocidos
+func isAPIKeyScope(scope string) bool {
+	for _, name := range apiKeyScopeNames() {
+		if name == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeScopes valida los permisos pedidos y los devuelve sin duplicados y
+// ordenados; devuelve el primer permiso desconocido si lo hay
+func normalizeScopes(scopes []string) ([]string, string) {
+	seen := map[string]bool{}
+	var result []string
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !isAPIKeyScope(scope) {
+			return nil, scope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	sort.Strings(result)
+	return result, ""
+}
+
+// hasScope indica si la lista de permisos incluye scope; nil concede todos
+func hasScope(scopes []string, scope string) bool {
+	if scopes == nil {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// requireScope comprueba que la credencial con la que se autenticó la petición
+// tiene el permiso indicado; las sesiones del dashboard (JWT) no tienen
+// restricciones. Si falta el permiso responde 403 con el código insufficient_scope.
+func requireScope(w http.ResponseWriter, c *caller, scope string) bool {
+	if hasScope(c.scopes(), scope) {
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   "La API key no tiene el permiso '" + scope + "'",
+		"code":    "insufficient_scope",
+		"scope":   scope,
+	})
+	return false
+}
@@ -0,0 +1,408 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	usageBatchSize     = 100
+	usageFlushInterval = 2 * time.Second
+	usageQueueSize     = 4096
+	defaultUsageDays   = 30
+)
+
+// toolCall es el registro de una llamada a /api/tool
+type toolCall struct {
+	UserID       int64
+	APIKeyID     string
+	Tool         string
+	Status       int
+	ErrorCode    string
+	Latency      time.Duration
+	BytesIn      int64
+	BytesOut     int64
+	UpstreamHost string
+	CreatedAt    time.Time
+}
+
+// usageRecorder escribe los registros de uso en lotes desde una goroutine para
+// no retrasar las respuestas
+type usageRecorder struct {
+	db      *sql.DB
+	calls   chan toolCall
+	flushes chan chan struct{}
+	done    chan struct{}
+}
+
+var usage *usageRecorder
+
+// startUsageRecorder inicia el registro de uso, deteniendo el anterior si lo hay
+func startUsageRecorder(database *sql.DB) {
+	if usage != nil {
+		usage.stop()
+	}
+	usage = &usageRecorder{
+		db:      database,
+		calls:   make(chan toolCall, usageQueueSize),
+		flushes: make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go usage.run()
+}
+
+// record encola una llamada; si la cola está llena se descarta para no bloquear
+func (u *usageRecorder) record(call toolCall) {
+	select {
+	case u.calls <- call:
+	default:
+		log.Printf("Cola de registro de uso llena, se descarta la llamada a %s", call.Tool)
+	}
+}
+
+// flush espera a que se escriban todos los registros encolados
+func (u *usageRecorder) flush() {
+	ack := make(chan struct{})
+	select {
+	case u.flushes <- ack:
+		<-ack
+	case <-u.done:
+	}
+}
+
+func (u *usageRecorder) stop() {
+	u.flush()
+	close(u.done)
+}
+
+func (u *usageRecorder) run() {
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+
+	var batch []toolCall
+	for {
+		select {
+		case call := <-u.calls:
+			batch = append(batch, call)
+			if len(batch) >= usageBatchSize {
+				u.write(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			u.write(batch)
+			batch = nil
+		case ack := <-u.flushes:
+			// Vaciar también lo que siga en la cola
+			for len(u.calls) > 0 {
+				batch = append(batch, <-u.calls)
+			}
+			u.write(batch)
+			batch = nil
+			close(ack)
+		case <-u.done:
+			return
+		}
+	}
+}
+
+// write inserta un lote de registros en una transacción
+func (u *usageRecorder) write(batch []toolCall) {
+	if len(batch) == 0 {
+		return
+	}
+	tx, err := u.db.Begin()
+	if err != nil {
+		log.Printf("Error al registrar el uso: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(
+		"INSERT INTO tool_calls (user_id, api_key_id, tool, status, error_code, latency_ms, bytes_in, bytes_out, upstream_host, created_at) " +
+			"VALUES (?, NULLIF(?, ''), ?, ?, NULLIF(?, ''), ?, ?, ?, NULLIF(?, ''), ?)",
+	)
+	if err != nil {
+		log.Printf("Error al registrar el uso: %v", err)
+		return
+	}
+	defer stmt.Close()
+
+	for _, call := range batch {
+		_, err := stmt.Exec(call.UserID, call.APIKeyID, call.Tool, call.Status, call.ErrorCode,
+			call.Latency.Milliseconds(), call.BytesIn, call.BytesOut, call.UpstreamHost,
+			call.CreatedAt.UTC().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			log.Printf("Error al registrar el uso de %s: %v", call.Tool, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error al registrar el uso: %v", err)
+	}
+}
+
+// meteredWriter cuenta los bytes y el estado de la respuesta y guarda el
+// inicio del cuerpo de los errores para extraer su código
+type meteredWriter struct {
+	http.ResponseWriter
+	status  int
+	bytes   int64
+	errBody []byte
+}
+
+func (m *meteredWriter) WriteHeader(status int) {
+	if m.status == 0 {
+		m.status = status
+	}
+	m.ResponseWriter.WriteHeader(status)
+}
+
+func (m *meteredWriter) Write(p []byte) (int, error) {
+	if m.status == 0 {
+		m.status = http.StatusOK
+	}
+	if m.status >= 400 && len(m.errBody) < 4096 {
+		m.errBody = append(m.errBody, p...)
+	}
+	n, err := m.ResponseWriter.Write(p)
+	m.bytes += int64(n)
+	return n, err
+}
+
+// errorCode devuelve el campo "code" de una respuesta de error JSON
+func (m *meteredWriter) errorCode() string {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if len(m.errBody) > 0 && json.Unmarshal(m.errBody, &body) == nil {
+		return body.Code
+	}
+	return ""
+}
+
+// countingReader cuenta los bytes leídos del cuerpo de la petición
+type countingReader struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.bytes += int64(n)
+	return n, err
+}
+
+// upstreamHost devuelve el host de la URL que consulta la herramienta, si la hay
+func upstreamHost(payload map[string]interface{}) string {
+	for _, field := range []string{"url", "baseline_url"} {
+		if raw, ok := payload[field].(string); ok {
+			if u, err := url.Parse(raw); err == nil && u.Host != "" {
+				return strings.ToLower(u.Hostname())
+			}
+		}
+	}
+	return ""
+}
+
+// recordToolCall encola el registro de una llamada a /api/tool
+func recordToolCall(who *caller, tool string, payload map[string]interface{}, metered *meteredWriter, bytesIn int64, start time.Time) {
+	if usage == nil {
+		return
+	}
+	status := metered.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	usage.record(toolCall{
+		UserID:       who.UserID,
+		APIKeyID:     who.keyID(),
+		Tool:         tool,
+		Status:       status,
+		ErrorCode:    metered.errorCode(),
+		Latency:      time.Since(start),
+		BytesIn:      bytesIn,
+		BytesOut:     metered.bytes,
+		UpstreamHost: upstreamHost(payload),
+		CreatedAt:    start,
+	})
+}
+
+// usageGroups son las dimensiones por las que se puede agrupar /api/usage
+var usageGroups = map[string]string{
+	"day":  "date(c.created_at)",
+	"tool": "c.tool",
+	"key":  "c.api_key_id",
+}
+
+// handleUsage maneja GET /api/usage?from=&to=&group_by=day,tool,key&tool=&key_id=
+func handleUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	if r.Method != http.MethodGet {
+		sendError(http.StatusMethodNotAllowed, "method_not_allowed", "Método no permitido")
+		return
+	}
+	who, err := authenticate(r)
+	if err != nil {
+		sendError(http.StatusUnauthorized, "unauthorized", "Se requiere autenticación")
+		return
+	}
+	if !requireScope(w, who, scopeReadUsage) {
+		return
+	}
+	userID := who.UserID
+
+	query := r.URL.Query()
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -defaultUsageDays)
+	for _, param := range []struct {
+		name   string
+		target *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if value := query.Get(param.name); value != "" {
+			date, err := parseDateFilter(value)
+			if err != nil {
+				sendError(http.StatusBadRequest, "invalid_date", fmt.Sprintf("El parámetro '%s' debe ser una fecha (YYYY-MM-DD o RFC 3339)", param.name))
+				return
+			}
+			*param.target = date.UTC()
+		}
+	}
+	// Una fecha sin hora en "to" incluye el día completo
+	if value := query.Get("to"); len(value) == len("2006-01-02") {
+		to = to.AddDate(0, 0, 1)
+	}
+
+	groupBy := []string{"day"}
+	if value := query.Get("group_by"); value != "" {
+		groupBy = strings.Split(value, ",")
+	}
+	var columns, groups []string
+	seen := map[string]bool{}
+	for _, group := range groupBy {
+		group = strings.TrimSpace(group)
+		expr, ok := usageGroups[group]
+		if !ok || seen[group] {
+			sendError(http.StatusBadRequest, "invalid_usage_options", "'group_by' admite day, tool y key sin repetir")
+			return
+		}
+		seen[group] = true
+		columns = append(columns, expr)
+		groups = append(groups, group)
+	}
+
+	conditions := []string{"c.user_id = ?", "c.created_at >= ?"}
+	args := []interface{}{userID, from.Format("2006-01-02 15:04:05")}
+	// Sin "to" se incluye todo hasta ahora, también lo registrado en este mismo segundo
+	if query.Get("to") != "" {
+		conditions = append(conditions, "c.created_at < ?")
+		args = append(args, to.Format("2006-01-02 15:04:05"))
+	}
+	if tool := query.Get("tool"); tool != "" {
+		conditions = append(conditions, "c.tool = ?")
+		args = append(args, tool)
+	}
+	if keyID := query.Get("key_id"); keyID != "" {
+		conditions = append(conditions, "c.api_key_id = ?")
+		args = append(args, keyID)
+	}
+
+	// Incluir lo que aún esté en la cola de escritura
+	if usage != nil {
+		usage.flush()
+	}
+
+	rows, err := db.Query(
+		"SELECT "+strings.Join(columns, ", ")+", MAX(k.name), MAX(k.key_prefix), COUNT(*), "+
+			"SUM(CASE WHEN c.status >= 400 THEN 1 ELSE 0 END), COALESCE(SUM(c.bytes_in), 0), "+
+			"COALESCE(SUM(c.bytes_out), 0), COALESCE(AVG(c.latency_ms), 0) "+
+			"FROM tool_calls c LEFT JOIN api_keys k ON k.id = c.api_key_id "+
+			"WHERE "+strings.Join(conditions, " AND ")+
+			" GROUP BY "+strings.Join(columns, ", ")+
+			" ORDER BY "+strings.Join(columns, ", "),
+		args...,
+	)
+	if err != nil {
+		log.Printf("Error al consultar el uso: %v", err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al obtener el uso")
+		return
+	}
+	defer rows.Close()
+
+	entries := []map[string]interface{}{}
+	totals := map[string]interface{}{"calls": int64(0), "errors": int64(0), "bytes_in": int64(0), "bytes_out": int64(0)}
+	var totalLatency float64
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		var keyName, keyPrefix sql.NullString
+		var calls, errorCount, bytesIn, bytesOut int64
+		var latency float64
+
+		dest := make([]interface{}, 0, len(columns)+7)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		dest = append(dest, &keyName, &keyPrefix, &calls, &errorCount, &bytesIn, &bytesOut, &latency)
+		if err := rows.Scan(dest...); err != nil {
+			log.Printf("Error al leer el uso: %v", err)
+			continue
+		}
+
+		entry := map[string]interface{}{
+			"calls":          calls,
+			"errors":         errorCount,
+			"bytes_in":       bytesIn,
+			"bytes_out":      bytesOut,
+			"avg_latency_ms": int64(latency + 0.5),
+		}
+		for i, group := range groups {
+			switch group {
+			case "key":
+				entry["key_id"] = values[i].String
+				if seen["key"] && keyName.Valid {
+					entry["key_name"] = keyName.String
+					entry["key_prefix"] = keyPrefix.String
+				}
+			default:
+				entry[group] = values[i].String
+			}
+		}
+		entries = append(entries, entry)
+
+		totals["calls"] = totals["calls"].(int64) + calls
+		totals["errors"] = totals["errors"].(int64) + errorCount
+		totals["bytes_in"] = totals["bytes_in"].(int64) + bytesIn
+		totals["bytes_out"] = totals["bytes_out"].(int64) + bytesOut
+		totalLatency += latency * float64(calls)
+	}
+	if calls := totals["calls"].(int64); calls > 0 {
+		totals["avg_latency_ms"] = int64(totalLatency/float64(calls) + 0.5)
+	} else {
+		totals["avg_latency_ms"] = int64(0)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"from":     from.Format(time.RFC3339),
+		"to":       to.Format(time.RFC3339),
+		"group_by": groups,
+		"totals":   totals,
+		"usage":    entries,
+	})
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"toolbox/tools"
+)
+
+const (
+	// maxArtifactsPerName es el número de capturas que se conservan por nombre de referencia
+	maxArtifactsPerName = 10
+	// maxUnnamedArtifacts es el número de capturas sin nombre que se conservan por usuario
+	maxUnnamedArtifacts = 50
+)
+
+// saveArtifact guarda una captura y devuelve su identificador
+func saveArtifact(userID int64, name, pageURL string, img []byte) (string, error) {
+	random, err := generateRandomString(16)
+	if err != nil {
+		return "", err
+	}
+	artifactID := "art_" + random
+
+	var width, height int
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(img)); err == nil {
+		width, height = cfg.Width, cfg.Height
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO screenshot_artifacts (id, user_id, name, url, image, width, height) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		artifactID, userID, name, pageURL, img, width, height,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	// Conservar solo las capturas más recientes de cada nombre y, sin nombre,
+	// las más recientes del usuario
+	limit := maxArtifactsPerName
+	if name == "" {
+		limit = maxUnnamedArtifacts
+	}
+	if _, err := db.Exec(`DELETE FROM screenshot_artifacts WHERE user_id = ? AND name = ? AND id NOT IN (
+		SELECT id FROM screenshot_artifacts WHERE user_id = ? AND name = ? ORDER BY created_at DESC, rowid DESC LIMIT ?)`,
+		userID, name, userID, name, limit); err != nil {
+		log.Printf("Error al purgar capturas antiguas: %v", err)
+	}
+	return artifactID, nil
+}
+
+// handleVisualDiff captura una URL y la compara con una imagen de referencia:
+// una imagen subida (baseline_image), una captura anterior (baseline_artifact_id)
+// o la última captura guardada con el mismo nombre (name)
+func handleVisualDiff(w http.ResponseWriter, userID int64, payload map[string]interface{}) {
+	sendError := func(statusCode int, code, message string) {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   message,
+			"code":    code,
+		})
+	}
+
+	urlStr, _ := payload["url"].(string)
+	if urlStr == "" {
+		sendError(http.StatusBadRequest, "missing_url", "Se requiere el parámetro 'url' en el payload")
+		return
+	}
+	if parsed, err := url.ParseRequestURI(urlStr); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		sendError(http.StatusBadRequest, "invalid_url", "La URL proporcionada no es válida")
+		return
+	}
+
+	ignore, err := tools.ParseIgnoreRegions(payload)
+	if err != nil {
+		sendError(http.StatusBadRequest, toolErrorCode(err, "invalid_ignore_regions"), err.Error())
+		return
+	}
+
+	threshold := 0.0
+	if v, ok := payload["threshold"]; ok && v != nil {
+		t, ok := v.(float64)
+		if !ok || t <= 0 || t > 1 {
+			sendError(http.StatusBadRequest, "invalid_threshold", "El campo 'threshold' debe ser un número entre 0 y 1")
+			return
+		}
+		threshold = t
+	}
+
+	includeDiffImage := true
+	if v, ok := payload["include_diff_image"].(bool); ok {
+		includeDiffImage = v
+	}
+
+	name, _ := payload["name"].(string)
+	name = strings.TrimSpace(name)
+	baselineImage, _ := payload["baseline_image"].(string)
+	baselineArtifactID, _ := payload["baseline_artifact_id"].(string)
+
+	// Resolver la imagen de referencia antes de capturar
+	var baseline []byte
+	switch {
+	case baselineImage != "":
+		baseline, err = tools.DecodeBase64Image(baselineImage)
+		if err != nil {
+			sendError(http.StatusBadRequest, toolErrorCode(err, "invalid_baseline_image"), err.Error())
+			return
+		}
+	case baselineArtifactID != "":
+		err = db.QueryRow("SELECT image FROM screenshot_artifacts WHERE id = ? AND user_id = ?", baselineArtifactID, userID).Scan(&baseline)
+		if err == sql.ErrNoRows {
+			sendError(http.StatusNotFound, "baseline_not_found", "No existe la captura de referencia indicada")
+			return
+		}
+	case name != "":
+		err = db.QueryRow("SELECT id, image FROM screenshot_artifacts WHERE user_id = ? AND name = ? ORDER BY created_at DESC, rowid DESC LIMIT 1", userID, name).
+			Scan(&baselineArtifactID, &baseline)
+		if err == sql.ErrNoRows {
+			// Primera ejecución con este nombre: la captura pasa a ser la referencia
+			err = nil
+		}
+	default:
+		sendError(http.StatusBadRequest, "missing_baseline", "Se requiere 'baseline_image', 'baseline_artifact_id' o 'name'")
+		return
+	}
+	if err != nil {
+		log.Printf("Error al obtener la captura de referencia: %v", err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al obtener la captura de referencia")
+		return
+	}
+
+	// Respetar robots.txt si lo pide la petición o la API key
+	if tools.RespectRobots(payload) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := tools.Robots.Check(ctx, urlStr); err != nil {
+			sendError(toolErrorStatus(err, http.StatusBadGateway), toolErrorCode(err, "robots_check_failed"), err.Error())
+			return
+		}
+	}
+
+	fullPage := true
+	if v, ok := payload["full_page"].(bool); ok {
+		fullPage = v
+	}
+	current, err := tools.ShotScrapperPNG(urlStr, fullPage)
+	if err != nil {
+		sendError(http.StatusInternalServerError, "screenshot_failed", "Error al tomar la captura de pantalla: "+err.Error())
+		return
+	}
+
+	artifactID, err := saveArtifact(userID, name, urlStr, current)
+	if err != nil {
+		log.Printf("Error al guardar la captura: %v", err)
+		sendError(http.StatusInternalServerError, "database_error", "Error al guardar la captura")
+		return
+	}
+
+	if baseline == nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":          true,
+			"baseline_created": true,
+			"artifact_id":      artifactID,
+			"artifact_url":     "/api/artifacts/" + artifactID,
+		})
+		return
+	}
+
+	result, err := tools.CompareImages(baseline, current, threshold, ignore)
+	if err != nil {
+		sendError(http.StatusUnprocessableEntity, toolErrorCode(err, "visual_diff_failed"), err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"success":           true,
+		"mismatch_percent":  result.MismatchPercent,
+		"mismatched_pixels": result.MismatchedPixels,
+		"total_pixels":      result.TotalPixels,
+		"baseline_size":     result.BaselineSize,
+		"current_size":      result.CurrentSize,
+		"size_changed":      result.SizeChanged,
+		"regions":           result.Regions,
+		"artifact_id":       artifactID,
+		"artifact_url":      "/api/artifacts/" + artifactID,
+	}
+	if baselineArtifactID != "" {
+		response["baseline_artifact_id"] = baselineArtifactID
+	}
+	if includeDiffImage {
+		response["diff_image"] = base64.StdEncoding.EncodeToString(result.DiffImage)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleArtifacts devuelve la imagen PNG de una captura guardada (GET /api/artifacts/{id})
+func handleArtifacts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	who, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Se requiere autenticación", http.StatusUnauthorized)
+		return
+	}
+	// Las capturas guardadas pertenecen a visual_diff
+	if !requireScope(w, who, "tool:visual_diff") {
+		return
+	}
+	userID := who.UserID
+
+	artifactID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/artifacts"), "/")
+	var img []byte
+	err = db.QueryRow("SELECT image FROM screenshot_artifacts WHERE id = ? AND user_id = ?", artifactID, userID).Scan(&img)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Captura no encontrada", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error al obtener la captura %s: %v", artifactID, err)
+		http.Error(w, "Error al obtener la captura", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(img))
+	w.Write(img)
+}
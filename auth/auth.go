@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"fmt"
@@ -27,12 +28,30 @@ type APIKey struct {
 	ID         string    `json:"id"`
 	UserID     int       `json:"user_id"`
 	Name       string    `json:"name"`
-	Key        string    `json:"key,omitempty"` // Solo se muestra una vez al crear/regenerar
+	Prefix     string    `json:"prefix"` // La clave completa solo se devuelve al crearla
 	CreatedAt  time.Time `json:"created_at"`
 	LastUsedAt time.Time `json:"last_used_at,omitempty"`
 	Revoked    bool      `json:"revoked"`
 }
 
+// APIKeyPrefixLength es el número de caracteres de la clave que se guardan en
+// claro para poder identificarla (p. ej. "tbx_AbCdEf")
+const APIKeyPrefixLength = 10
+
+// HashAPIKey devuelve el hash SHA-256 (hex) con el que se almacena una clave API
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix devuelve el prefijo visible de una clave API
+func APIKeyPrefix(key string) string {
+	if len(key) > APIKeyPrefixLength {
+		return key[:APIKeyPrefixLength]
+	}
+	return key
+}
+
 // Configuración de autenticación
 type Config struct {
 	JWTSecret string
@@ -299,13 +318,14 @@ func CreateAPIKey(userID int, name string) (string, error) {
 	// Generar la clave API en formato tbx_<random_chars>
 	key := fmt.Sprintf("tbx_%s", hex.EncodeToString(tokenBytes)[:16])
 
-	// Almacenar en la base de datos
+	// Almacenar solo el hash y el prefijo visible
 	_, err = DB.Exec(
-		"INSERT INTO api_keys (id, user_id, name, key) VALUES (?, ?, ?, ?)",
+		"INSERT INTO api_keys (id, user_id, name, key_hash, key_prefix) VALUES (?, ?, ?, ?, ?)",
 		keyID,
 		userID,
 		name,
-		key,
+		HashAPIKey(key),
+		APIKeyPrefix(key),
 	)
 
 	if err != nil {
@@ -323,7 +343,7 @@ func GetAPIKeys(userID int) ([]APIKey, error) {
 			id,
 			user_id,
 			name,
-			key,
+			key_prefix,
 			created_at,
 			last_used_at,
 			revoked
@@ -342,13 +362,12 @@ func GetAPIKeys(userID int) ([]APIKey, error) {
 	for rows.Next() {
 		var key APIKey
 		var lastUsedAt sql.NullTime
-		var keyString sql.NullString
 
 		err := rows.Scan(
 			&key.ID,
 			&key.UserID,
 			&key.Name,
-			&keyString,
+			&key.Prefix,
 			&key.CreatedAt,
 			&lastUsedAt,
 			&key.Revoked,
@@ -363,11 +382,6 @@ func GetAPIKeys(userID int) ([]APIKey, error) {
 			key.LastUsedAt = lastUsedAt.Time
 		}
 
-		// Si keyString es válido, establecerlo en la estructura
-		if keyString.Valid {
-			key.Key = keyString.String
-		}
-
 		keys = append(keys, key)
 	}
 
@@ -378,18 +392,22 @@ func GetAPIKeys(userID int) ([]APIKey, error) {
 	return keys, nil
 }
 
-// RevokeAPIKey elimina una clave API
+// RevokeAPIKey revoca una clave API; la fila se conserva como historial
 func RevokeAPIKey(userID int, keyID string) error {
-	// Eliminar la clave API
-	result, err := DB.Exec("DELETE FROM api_keys WHERE id = ? AND user_id = ?", keyID, userID)
+	// Revocar la clave API
+	result, err := DB.Exec(
+		"UPDATE api_keys SET revoked = 1, revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ? AND (revoked = 0 OR revoked IS NULL)",
+		keyID,
+		userID,
+	)
 	if err != nil {
-		return fmt.Errorf("error al eliminar la clave API: %v", err)
+		return fmt.Errorf("error al revocar la clave API: %v", err)
 	}
 
-	// Verificar que se eliminó alguna fila
+	// Verificar que se revocó alguna fila
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("error al verificar eliminación de clave API: %v", err)
+		return fmt.Errorf("error al verificar la revocación de la clave API: %v", err)
 	}
 
 	if rowsAffected == 0 {
@@ -0,0 +1,271 @@
+// Package billing integra Stripe: sesiones de Checkout y del Customer Portal,
+// y webhooks que trasladan las suscripciones a los planes de los usuarios.
+package billing
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAPIBase es la URL de la API de Stripe
+const DefaultAPIBase = "https://api.stripe.com"
+
+// FreePlan es el plan que se asigna cuando no hay una suscripción activa
+const FreePlan = "free"
+
+var (
+	// ErrNotConfigured indica que faltan las claves de Stripe
+	ErrNotConfigured = errors.New("la facturación con Stripe no está configurada")
+	// ErrUnknownPlan indica que el plan no tiene un precio de Stripe asociado
+	ErrUnknownPlan = errors.New("el plan no se puede contratar")
+	// ErrNoCustomer indica que el usuario todavía no es cliente de Stripe
+	ErrNoCustomer = errors.New("el usuario no tiene un cliente de Stripe")
+)
+
+// Config contiene la configuración de Stripe
+type Config struct {
+	SecretKey       string
+	WebhookSecret   string
+	APIBase         string
+	APIVersion      string
+	SuccessURL      string
+	CancelURL       string
+	PortalReturnURL string
+	Prices          map[string]string // ID de precio de Stripe -> plan
+}
+
+// LoadConfig lee la configuración del entorno: STRIPE_SECRET_KEY,
+// STRIPE_WEBHOOK_SECRET, STRIPE_API_BASE, STRIPE_API_VERSION,
+// STRIPE_PRICE_PRO, STRIPE_PRICE_TEAM, BILLING_SUCCESS_URL,
+// BILLING_CANCEL_URL y BILLING_PORTAL_RETURN_URL
+func LoadConfig() Config {
+	config := Config{
+		SecretKey:       os.Getenv("STRIPE_SECRET_KEY"),
+		WebhookSecret:   os.Getenv("STRIPE_WEBHOOK_SECRET"),
+		APIBase:         os.Getenv("STRIPE_API_BASE"),
+		APIVersion:      os.Getenv("STRIPE_API_VERSION"),
+		SuccessURL:      os.Getenv("BILLING_SUCCESS_URL"),
+		CancelURL:       os.Getenv("BILLING_CANCEL_URL"),
+		PortalReturnURL: os.Getenv("BILLING_PORTAL_RETURN_URL"),
+		Prices:          map[string]string{},
+	}
+	if config.APIBase == "" {
+		config.APIBase = DefaultAPIBase
+	}
+	for _, plan := range []string{"pro", "team"} {
+		if price := os.Getenv("STRIPE_PRICE_" + strings.ToUpper(plan)); price != "" {
+			config.Prices[price] = plan
+		}
+	}
+	return config
+}
+
+// Livemode indica si la clave secreta es de producción; los eventos del otro
+// entorno se ignoran
+func (c Config) Livemode() bool {
+	return strings.HasPrefix(c.SecretKey, "sk_live_") || strings.HasPrefix(c.SecretKey, "rk_live_")
+}
+
+// priceForPlan devuelve el precio de Stripe de un plan
+func (c Config) priceForPlan(plan string) (string, bool) {
+	for price, p := range c.Prices {
+		if p == plan {
+			return price, true
+		}
+	}
+	return "", false
+}
+
+// Client habla con la API de Stripe y guarda el estado de facturación en la base de datos
+type Client struct {
+	config Config
+	db     *sql.DB
+	http   *http.Client
+}
+
+// NewClient crea un cliente de facturación
+func NewClient(db *sql.DB, config Config) *Client {
+	if config.APIBase == "" {
+		config.APIBase = DefaultAPIBase
+	}
+	return &Client{
+		config: config,
+		db:     db,
+		http:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Enabled indica si hay una clave secreta configurada
+func (c *Client) Enabled() bool {
+	return c.config.SecretKey != ""
+}
+
+// StripeError es un error devuelto por la API de Stripe
+type StripeError struct {
+	Status  int    `json:"-"`
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *StripeError) Error() string {
+	return fmt.Sprintf("error de Stripe (%d %s): %s", e.Status, e.Type, e.Message)
+}
+
+// request envía una petición a la API de Stripe y decodifica la respuesta en out
+func (c *Client) request(method, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	if !c.Enabled() {
+		return ErrNotConfigured
+	}
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(c.config.APIBase, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.SecretKey)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if c.config.APIVersion != "" {
+		req.Header.Set("Stripe-Version", c.config.APIVersion)
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("error al conectar con Stripe: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("error al leer la respuesta de Stripe: %v", err)
+	}
+	if resp.StatusCode >= 300 {
+		var envelope struct {
+			Error StripeError `json:"error"`
+		}
+		json.Unmarshal(data, &envelope)
+		envelope.Error.Status = resp.StatusCode
+		return &envelope.Error
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("respuesta de Stripe no válida: %v", err)
+	}
+	return nil
+}
+
+// customerID devuelve el cliente de Stripe del usuario, o "" si no tiene
+func (c *Client) customerID(userID int64) (string, error) {
+	var customer sql.NullString
+	if err := c.db.QueryRow("SELECT stripe_customer_id FROM users WHERE id = ?", userID).Scan(&customer); err != nil {
+		return "", fmt.Errorf("error al obtener el cliente de Stripe: %v", err)
+	}
+	return customer.String, nil
+}
+
+// ensureCustomer devuelve el cliente de Stripe del usuario, creándolo si no existe
+func (c *Client) ensureCustomer(userID int64, email string) (string, error) {
+	customer, err := c.customerID(userID)
+	if err != nil || customer != "" {
+		return customer, err
+	}
+
+	form := url.Values{}
+	form.Set("email", email)
+	form.Set("metadata[user_id]", strconv.FormatInt(userID, 10))
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	// La clave de idempotencia evita clientes duplicados si dos peticiones llegan a la vez
+	if err := c.request(http.MethodPost, "/v1/customers", form, fmt.Sprintf("customer-%d", userID), &created); err != nil {
+		return "", err
+	}
+
+	if _, err := c.db.Exec("UPDATE users SET stripe_customer_id = ? WHERE id = ? AND stripe_customer_id IS NULL", created.ID, userID); err != nil {
+		return "", fmt.Errorf("error al guardar el cliente de Stripe: %v", err)
+	}
+	return c.customerID(userID)
+}
+
+// CreateCheckoutSession crea una sesión de Checkout para suscribir al usuario
+// al plan y devuelve su URL
+func (c *Client) CreateCheckoutSession(userID int64, email, plan string) (string, error) {
+	if !c.Enabled() {
+		return "", ErrNotConfigured
+	}
+	price, ok := c.config.priceForPlan(plan)
+	if !ok {
+		return "", ErrUnknownPlan
+	}
+
+	customer, err := c.ensureCustomer(userID, email)
+	if err != nil {
+		return "", err
+	}
+
+	id := strconv.FormatInt(userID, 10)
+	form := url.Values{}
+	form.Set("mode", "subscription")
+	form.Set("customer", customer)
+	form.Set("client_reference_id", id)
+	form.Set("line_items[0][price]", price)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("success_url", c.config.SuccessURL)
+	form.Set("cancel_url", c.config.CancelURL)
+	form.Set("metadata[user_id]", id)
+	form.Set("subscription_data[metadata][user_id]", id)
+
+	var session struct {
+		URL string `json:"url"`
+	}
+	if err := c.request(http.MethodPost, "/v1/checkout/sessions", form, "", &session); err != nil {
+		return "", err
+	}
+	return session.URL, nil
+}
+
+// CreatePortalSession crea una sesión del Customer Portal para que el usuario
+// gestione su suscripción y devuelve su URL
+func (c *Client) CreatePortalSession(userID int64) (string, error) {
+	if !c.Enabled() {
+		return "", ErrNotConfigured
+	}
+	customer, err := c.customerID(userID)
+	if err != nil {
+		return "", err
+	}
+	if customer == "" {
+		return "", ErrNoCustomer
+	}
+
+	form := url.Values{}
+	form.Set("customer", customer)
+	if c.config.PortalReturnURL != "" {
+		form.Set("return_url", c.config.PortalReturnURL)
+	}
+
+	var session struct {
+		URL string `json:"url"`
+	}
+	if err := c.request(http.MethodPost, "/v1/billing_portal/sessions", form, "", &session); err != nil {
+		return "", err
+	}
+	return session.URL, nil
+}
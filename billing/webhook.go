@@ -0,0 +1,335 @@
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureTolerance es la antigüedad máxima de un webhook firmado
+const SignatureTolerance = 5 * time.Minute
+
+// ErrInvalidSignature indica que la firma del webhook no es válida o ha caducado
+var ErrInvalidSignature = errors.New("firma de webhook no válida")
+
+// Event es un evento de webhook de Stripe
+type Event struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Created  int64  `json:"created"`
+	Livemode bool   `json:"livemode"`
+	Data     struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// VerifySignature comprueba el encabezado Stripe-Signature ("t=...,v1=...")
+// de un webhook: HMAC-SHA256 de "t.payload" con el secreto del endpoint
+func VerifySignature(payload []byte, header, secret string, now time.Time) error {
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(timestamp, 0)); age > SignatureTolerance || age < -SignatureTolerance {
+		return fmt.Errorf("%w: marca de tiempo fuera de tolerancia", ErrInvalidSignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, signature := range signatures {
+		if decoded, err := hex.DecodeString(signature); err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// ConstructEvent verifica la firma de un webhook y decodifica el evento
+func (c *Client) ConstructEvent(payload []byte, header string) (*Event, error) {
+	if c.config.WebhookSecret == "" {
+		return nil, ErrNotConfigured
+	}
+	if err := VerifySignature(payload, header, c.config.WebhookSecret, time.Now()); err != nil {
+		return nil, err
+	}
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("evento de Stripe no válido: %v", err)
+	}
+	if event.ID == "" || event.Type == "" {
+		return nil, errors.New("evento de Stripe sin id o tipo")
+	}
+	return &event, nil
+}
+
+// subscription es la parte de una suscripción de Stripe que se usa aquí
+type subscription struct {
+	ID                string            `json:"id"`
+	Customer          string            `json:"customer"`
+	Status            string            `json:"status"`
+	CancelAtPeriodEnd bool              `json:"cancel_at_period_end"`
+	CurrentPeriodEnd  int64             `json:"current_period_end"`
+	Livemode          bool              `json:"livemode"`
+	Metadata          map[string]string `json:"metadata"`
+	Items             struct {
+		Data []struct {
+			CurrentPeriodEnd int64 `json:"current_period_end"`
+			Price            struct {
+				ID string `json:"id"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+// checkoutSession es la parte de una sesión de Checkout que se usa aquí
+type checkoutSession struct {
+	ID                string            `json:"id"`
+	Mode              string            `json:"mode"`
+	Customer          string            `json:"customer"`
+	Subscription      string            `json:"subscription"`
+	ClientReferenceID string            `json:"client_reference_id"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+// invoice es la parte de una factura que se usa aquí; las versiones recientes
+// de la API mueven la suscripción a parent.subscription_details
+type invoice struct {
+	ID           string `json:"id"`
+	Customer     string `json:"customer"`
+	Subscription string `json:"subscription"`
+	Parent       struct {
+		SubscriptionDetails struct {
+			Subscription string `json:"subscription"`
+		} `json:"subscription_details"`
+	} `json:"parent"`
+}
+
+// HandleEvent aplica un evento de webhook. Cada evento se aplica una sola vez:
+// queda registrado en stripe_events en la misma transacción que sus cambios,
+// así que si falla Stripe puede reintentarlo.
+func (c *Client) HandleEvent(event *Event) error {
+	if event.Livemode != c.config.Livemode() {
+		log.Printf("Evento de Stripe %s de otro entorno (livemode=%v), se ignora", event.ID, event.Livemode)
+		return nil
+	}
+
+	var processed bool
+	if err := c.db.QueryRow("SELECT EXISTS(SELECT 1 FROM stripe_events WHERE id = ?)", event.ID).Scan(&processed); err != nil {
+		return fmt.Errorf("error al consultar eventos de Stripe: %v", err)
+	}
+	if processed {
+		return nil
+	}
+
+	// La suscripción de un Checkout se consulta antes de abrir la transacción
+	var session checkoutSession
+	var checkoutSub *subscription
+	if event.Type == "checkout.session.completed" {
+		if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+			return fmt.Errorf("sesión de Checkout no válida: %v", err)
+		}
+		if session.Mode == "subscription" && session.Subscription != "" {
+			checkoutSub = &subscription{}
+			if err := c.request(http.MethodGet, "/v1/subscriptions/"+url.PathEscape(session.Subscription), nil, "", checkoutSub); err != nil {
+				return err
+			}
+		}
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO stripe_events (id, type) VALUES (?, ?) ON CONFLICT(id) DO NOTHING", event.ID, event.Type)
+	if err != nil {
+		return fmt.Errorf("error al registrar el evento de Stripe: %v", err)
+	}
+	// Otra entrega del mismo evento se procesó mientras tanto
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	switch event.Type {
+	case "checkout.session.completed":
+		if err := c.linkCustomer(tx, session); err != nil {
+			return err
+		}
+		if checkoutSub != nil {
+			if err := c.applySubscription(tx, checkoutSub, event.Created); err != nil {
+				return err
+			}
+		}
+	case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+		var sub subscription
+		if err := json.Unmarshal(event.Data.Object, &sub); err != nil {
+			return fmt.Errorf("suscripción no válida: %v", err)
+		}
+		if err := c.applySubscription(tx, &sub, event.Created); err != nil {
+			return err
+		}
+	case "invoice.payment_failed":
+		var inv invoice
+		if err := json.Unmarshal(event.Data.Object, &inv); err != nil {
+			return fmt.Errorf("factura no válida: %v", err)
+		}
+		subID := inv.Subscription
+		if subID == "" {
+			subID = inv.Parent.SubscriptionDetails.Subscription
+		}
+		if _, err := tx.Exec("UPDATE subscriptions SET payment_failed_at = CURRENT_TIMESTAMP WHERE id = ?", subID); err != nil {
+			return fmt.Errorf("error al registrar el pago fallido: %v", err)
+		}
+		log.Printf("Pago fallido de la factura %s (suscripción %s, cliente %s)", inv.ID, subID, inv.Customer)
+	default:
+		log.Printf("Evento de Stripe no gestionado: %s", event.Type)
+	}
+
+	return tx.Commit()
+}
+
+// linkCustomer asocia el cliente de una sesión de Checkout al usuario que la inició
+func (c *Client) linkCustomer(tx *sql.Tx, session checkoutSession) error {
+	userID := session.ClientReferenceID
+	if userID == "" {
+		userID = session.Metadata["user_id"]
+	}
+	if userID == "" || session.Customer == "" {
+		return nil
+	}
+	_, err := tx.Exec(
+		"UPDATE users SET stripe_customer_id = ? WHERE id = ? AND (stripe_customer_id IS NULL OR stripe_customer_id = ?)",
+		session.Customer, userID, session.Customer,
+	)
+	if err != nil {
+		return fmt.Errorf("error al asociar el cliente de Stripe: %v", err)
+	}
+	return nil
+}
+
+// subscriptionUser busca el usuario de una suscripción por su cliente o, si
+// todavía no está asociado, por metadata.user_id
+func subscriptionUser(tx *sql.Tx, sub *subscription) (int64, bool, error) {
+	var userID int64
+	err := tx.QueryRow("SELECT id FROM users WHERE stripe_customer_id = ?", sub.Customer).Scan(&userID)
+	if err == nil {
+		return userID, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+
+	id, err := strconv.ParseInt(sub.Metadata["user_id"], 10, 64)
+	if err != nil {
+		return 0, false, nil
+	}
+	result, err := tx.Exec("UPDATE users SET stripe_customer_id = ? WHERE id = ? AND stripe_customer_id IS NULL", sub.Customer, id)
+	if err != nil {
+		return 0, false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, false, nil
+	}
+	return id, true, nil
+}
+
+// applySubscription guarda el estado de una suscripción y actualiza el plan del
+// usuario. Los eventos más antiguos que el último aplicado se descartan, ya
+// que Stripe no garantiza el orden de entrega.
+func (c *Client) applySubscription(tx *sql.Tx, sub *subscription, eventCreated int64) error {
+	userID, ok, err := subscriptionUser(tx, sub)
+	if err != nil {
+		return fmt.Errorf("error al buscar el usuario de la suscripción: %v", err)
+	}
+	if !ok {
+		log.Printf("Suscripción %s de un cliente desconocido (%s), se ignora", sub.ID, sub.Customer)
+		return nil
+	}
+
+	var lastEvent int64
+	err = tx.QueryRow("SELECT event_created FROM subscriptions WHERE id = ?", sub.ID).Scan(&lastEvent)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error al consultar la suscripción: %v", err)
+	}
+	if err == nil && lastEvent > eventCreated {
+		return nil
+	}
+
+	var priceID string
+	periodEnd := sub.CurrentPeriodEnd
+	if len(sub.Items.Data) > 0 {
+		priceID = sub.Items.Data[0].Price.ID
+		if periodEnd == 0 {
+			periodEnd = sub.Items.Data[0].CurrentPeriodEnd
+		}
+	}
+	plan, known := c.config.Prices[priceID]
+	if !known {
+		log.Printf("Precio de Stripe %s sin plan asociado (suscripción %s)", priceID, sub.ID)
+	}
+	var periodEndValue interface{}
+	if periodEnd > 0 {
+		periodEndValue = time.Unix(periodEnd, 0).UTC().Format("2006-01-02 15:04:05")
+	}
+
+	_, err = tx.Exec(`INSERT INTO subscriptions
+		(id, user_id, customer_id, price_id, plan, status, current_period_end, cancel_at_period_end, livemode, event_created, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET
+			user_id = excluded.user_id, customer_id = excluded.customer_id, price_id = excluded.price_id,
+			plan = excluded.plan, status = excluded.status, current_period_end = excluded.current_period_end,
+			cancel_at_period_end = excluded.cancel_at_period_end, livemode = excluded.livemode,
+			event_created = excluded.event_created, updated_at = CURRENT_TIMESTAMP,
+			payment_failed_at = CASE WHEN excluded.status = 'active' THEN NULL ELSE payment_failed_at END`,
+		sub.ID, userID, sub.Customer, priceID, plan, sub.Status, periodEndValue, sub.CancelAtPeriodEnd, sub.Livemode, eventCreated,
+	)
+	if err != nil {
+		return fmt.Errorf("error al guardar la suscripción: %v", err)
+	}
+
+	return syncUserPlan(tx, userID)
+}
+
+// syncUserPlan asigna al usuario el plan de su suscripción activa más
+// reciente, o el plan gratuito si no tiene ninguna. past_due conserva el plan
+// mientras Stripe reintenta el cobro.
+func syncUserPlan(tx *sql.Tx, userID int64) error {
+	plan := FreePlan
+	err := tx.QueryRow(`SELECT plan FROM subscriptions
+		WHERE user_id = ? AND plan != '' AND status IN ('active', 'trialing', 'past_due')
+		ORDER BY event_created DESC LIMIT 1`, userID,
+	).Scan(&plan)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error al consultar las suscripciones activas: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE users SET plan = ? WHERE id = ?", plan, userID); err != nil {
+		return fmt.Errorf("error al actualizar el plan del usuario: %v", err)
+	}
+	return nil
+}
@@ -50,6 +50,10 @@ func NewInMemoryDB() (*DBWrapper, error) {
 		return nil, fmt.Errorf("error al crear base de datos en memoria: %v", err)
 	}
 
+	// Cada conexión a ":memory:" abre una base distinta; los trabajos en segundo
+	// plano deben ver las mismas tablas, así que se usa una única conexión
+	db.SetMaxOpenConns(1)
+
 	// Configurar la base de datos para mejor rendimiento
 	if _, err := db.Exec(`
 		PRAGMA journal_mode = MEMORY;
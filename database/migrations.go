@@ -3,6 +3,8 @@ package database
 import (
 	"database/sql"
 	"fmt"
+
+	"toolbox/auth"
 )
 
 // RunMigrations ejecuta todas las migraciones necesarias en la base de datos
@@ -29,6 +31,7 @@ func RunMigrations(db *sql.DB) error {
 	migrations := []struct {
 		version int
 		sql     string
+		fn      func(tx *sql.Tx) error // paso opcional en Go tras el SQL
 	}{
 		{
 			version: 1,
@@ -108,6 +111,310 @@ func RunMigrations(db *sql.DB) error {
 			PRAGMA foreign_keys=on;
 			`,
 		},
+		{
+			version: 3,
+			sql: `
+			-- Permite que una API key imponga el cumplimiento de robots.txt
+			ALTER TABLE api_keys ADD COLUMN respect_robots BOOLEAN DEFAULT FALSE;
+			`,
+		},
+		{
+			version: 4,
+			sql: `
+			-- Trabajos asíncronos (p. ej. crawl) con su progreso y resultado
+			CREATE TABLE IF NOT EXISTS jobs (
+				id TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL,
+				tool TEXT NOT NULL,
+				status TEXT NOT NULL DEFAULT 'queued',
+				params TEXT,
+				progress TEXT,
+				result TEXT,
+				error TEXT,
+				error_code TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				finished_at TIMESTAMP,
+				-- Instancia que ejecuta el trabajo y su último latido, para que al
+				-- reiniciar solo se den por interrumpidos los trabajos propios o abandonados
+				owner TEXT,
+				heartbeat_at TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON jobs(user_id);
+			`,
+		},
+		{
+			version: 5,
+			sql: `
+			-- Monitores de cambios en páginas y sus instantáneas
+			CREATE TABLE IF NOT EXISTS monitors (
+				id TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL,
+				url TEXT NOT NULL,
+				selector TEXT,
+				format TEXT NOT NULL DEFAULT 'text',
+				interval_minutes INTEGER NOT NULL DEFAULT 60,
+				threshold REAL NOT NULL DEFAULT 0,
+				webhook_url TEXT,
+				notify_email BOOLEAN DEFAULT FALSE,
+				respect_robots BOOLEAN DEFAULT FALSE,
+				fetch_options TEXT NOT NULL DEFAULT '{}', -- headers, cookies, auth, timeout y redirecciones en JSON
+				active BOOLEAN DEFAULT TRUE,
+				last_checked_at TIMESTAMP,
+				last_changed_at TIMESTAMP,
+				last_error TEXT,
+				next_check_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);
+
+			CREATE TABLE IF NOT EXISTS monitor_snapshots (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				monitor_id TEXT NOT NULL,
+				content TEXT NOT NULL,
+				content_hash TEXT NOT NULL,
+				diff TEXT,
+				change_percent REAL,
+				notified BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (monitor_id) REFERENCES monitors(id) ON DELETE CASCADE
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_monitors_user_id ON monitors(user_id);
+			CREATE INDEX IF NOT EXISTS idx_monitors_next_check ON monitors(active, next_check_at);
+			CREATE INDEX IF NOT EXISTS idx_monitor_snapshots_monitor ON monitor_snapshots(monitor_id, id);
+			`,
+		},
+		{
+			version: 6,
+			sql: `
+			-- Capturas guardadas para usarlas como referencia en visual_diff
+			CREATE TABLE IF NOT EXISTS screenshot_artifacts (
+				id TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL,
+				name TEXT,
+				url TEXT NOT NULL,
+				image BLOB NOT NULL,
+				width INTEGER,
+				height INTEGER,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_screenshot_artifacts_user_name ON screenshot_artifacts(user_id, name, created_at);
+			`,
+		},
+		{
+			version: 7,
+			sql: `
+			-- Colecciones de documentos con índice de texto completo (FTS5, BM25)
+			CREATE TABLE IF NOT EXISTS collections (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (user_id, name),
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);
+
+			CREATE TABLE IF NOT EXISTS collection_documents (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				collection_id INTEGER NOT NULL,
+				url TEXT NOT NULL,
+				domain TEXT NOT NULL,
+				title TEXT,
+				content TEXT NOT NULL,
+				fetched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (collection_id, url),
+				FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_collection_documents_domain ON collection_documents(collection_id, domain);
+
+			CREATE VIRTUAL TABLE IF NOT EXISTS collection_fts USING fts5(
+				title, content,
+				content='collection_documents', content_rowid='id',
+				tokenize='unicode61 remove_diacritics 2'
+			);
+
+			CREATE TRIGGER IF NOT EXISTS collection_documents_ai AFTER INSERT ON collection_documents BEGIN
+				INSERT INTO collection_fts(rowid, title, content) VALUES (new.id, new.title, new.content);
+			END;
+			CREATE TRIGGER IF NOT EXISTS collection_documents_ad AFTER DELETE ON collection_documents BEGIN
+				INSERT INTO collection_fts(collection_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+			END;
+			CREATE TRIGGER IF NOT EXISTS collection_documents_au AFTER UPDATE ON collection_documents BEGIN
+				INSERT INTO collection_fts(collection_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+				INSERT INTO collection_fts(rowid, title, content) VALUES (new.id, new.title, new.content);
+			END;
+			`,
+		},
+		{
+			version: 8,
+			sql: `
+			-- Proveedor de búsqueda por defecto de cada API key
+			ALTER TABLE api_keys ADD COLUMN search_provider TEXT;
+			`,
+		},
+		{
+			version: 9,
+			sql: `
+			-- Las claves se guardan como hash SHA-256 con un prefijo visible;
+			-- key_hash recibe la clave en claro y fn la reemplaza por su hash
+			CREATE TABLE IF NOT EXISTS new_api_keys (
+				id TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				key_hash TEXT NOT NULL UNIQUE,
+				key_prefix TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				last_used_at TIMESTAMP,
+				revoked BOOLEAN DEFAULT FALSE,
+				respect_robots BOOLEAN DEFAULT FALSE,
+				search_provider TEXT,
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);
+
+			INSERT INTO new_api_keys (id, user_id, name, key_hash, key_prefix, created_at, last_used_at, revoked, respect_robots, search_provider)
+			SELECT id, user_id, name, key, substr(key, 1, ` + fmt.Sprint(auth.APIKeyPrefixLength) + `), created_at, last_used_at, revoked, respect_robots, search_provider
+			FROM api_keys;
+
+			DROP TABLE IF EXISTS api_keys;
+			ALTER TABLE new_api_keys RENAME TO api_keys;
+
+			CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+			`,
+			fn: hashExistingAPIKeys,
+		},
+		{
+			version: 10,
+			sql: `
+			-- Permisos de la API key separados por espacios (NULL = acceso completo)
+			ALTER TABLE api_keys ADD COLUMN scopes TEXT;
+			`,
+		},
+		{
+			version: 11,
+			sql: `
+			-- Descripción, caducidad, revocación sin borrado y rotación de claves
+			ALTER TABLE api_keys ADD COLUMN description TEXT;
+			ALTER TABLE api_keys ADD COLUMN expires_at TIMESTAMP;
+			ALTER TABLE api_keys ADD COLUMN revoked_at TIMESTAMP;
+			ALTER TABLE api_keys ADD COLUMN replaced_by TEXT;
+			`,
+		},
+		{
+			version: 12,
+			sql: `
+			-- Listas de IPs/CIDR y orígenes permitidos, separadas por espacios (NULL = sin restricción)
+			ALTER TABLE api_keys ADD COLUMN allowed_ips TEXT;
+			ALTER TABLE api_keys ADD COLUMN allowed_origins TEXT;
+			`,
+		},
+		{
+			version: 13,
+			sql: `
+			-- Cubos del limitador de peticiones cuando RATE_LIMIT_BACKEND=sqlite
+			CREATE TABLE IF NOT EXISTS rate_limits (
+				key TEXT PRIMARY KEY,
+				tokens REAL NOT NULL,
+				updated_at REAL NOT NULL
+			);
+			`,
+		},
+		{
+			version: 14,
+			sql: `
+			-- Registro de cada llamada a /api/tool para medir el uso
+			CREATE TABLE IF NOT EXISTS tool_calls (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				api_key_id TEXT,
+				tool TEXT NOT NULL,
+				status INTEGER NOT NULL,
+				error_code TEXT,
+				latency_ms INTEGER NOT NULL DEFAULT 0,
+				bytes_in INTEGER NOT NULL DEFAULT 0,
+				bytes_out INTEGER NOT NULL DEFAULT 0,
+				upstream_host TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_tool_calls_user_created ON tool_calls(user_id, created_at);
+			CREATE INDEX IF NOT EXISTS idx_tool_calls_key_created ON tool_calls(api_key_id, created_at);
+			`,
+		},
+		{
+			version: 15,
+			sql: `
+			-- Planes con cuotas mensuales (0 = ilimitado) y límites de opciones
+			CREATE TABLE IF NOT EXISTS plans (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				monthly_calls INTEGER NOT NULL DEFAULT 0,
+				tool_quotas TEXT NOT NULL DEFAULT '{}',
+				max_concurrency INTEGER NOT NULL DEFAULT 0,
+				max_timeout INTEGER NOT NULL DEFAULT 120,
+				max_crawl_pages INTEGER NOT NULL DEFAULT 0,
+				allow_full_page BOOLEAN NOT NULL DEFAULT FALSE
+			);
+
+			INSERT OR IGNORE INTO plans (id, name, monthly_calls, tool_quotas, max_concurrency, max_timeout, max_crawl_pages, allow_full_page) VALUES
+				('free', 'Free', 1000, '{"screenshot": 50, "visual_diff": 50, "crawl": 10, "research": 50}', 2, 30, 50, FALSE),
+				('pro', 'Pro', 50000, '{"screenshot": 5000, "visual_diff": 5000, "crawl": 500, "research": 2000}', 10, 120, 500, TRUE),
+				('team', 'Team', 250000, '{}', 25, 120, 0, TRUE);
+
+			-- Plan de cada usuario y periodo de cuota en curso
+			ALTER TABLE users ADD COLUMN plan TEXT NOT NULL DEFAULT 'free';
+			ALTER TABLE users ADD COLUMN quota_period_start TIMESTAMP;
+			ALTER TABLE users ADD COLUMN quota_period_end TIMESTAMP;
+
+			-- Llamadas consumidas por herramienta en el periodo en curso
+			CREATE TABLE IF NOT EXISTS quota_usage (
+				user_id INTEGER NOT NULL,
+				tool TEXT NOT NULL,
+				calls INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (user_id, tool),
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);
+			`,
+		},
+		{
+			version: 16,
+			sql: `
+			-- Cliente de Stripe de cada usuario
+			ALTER TABLE users ADD COLUMN stripe_customer_id TEXT;
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_users_stripe_customer ON users(stripe_customer_id);
+
+			-- Suscripciones de Stripe y el plan al que corresponden
+			CREATE TABLE IF NOT EXISTS subscriptions (
+				id TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL,
+				customer_id TEXT NOT NULL,
+				price_id TEXT,
+				plan TEXT,
+				status TEXT NOT NULL,
+				current_period_end TIMESTAMP,
+				cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+				livemode BOOLEAN NOT NULL DEFAULT FALSE,
+				payment_failed_at TIMESTAMP,
+				event_created INTEGER NOT NULL DEFAULT 0,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_subscriptions_user ON subscriptions(user_id);
+
+			-- Eventos de webhook ya procesados, para no aplicarlos dos veces
+			CREATE TABLE IF NOT EXISTS stripe_events (
+				id TEXT PRIMARY KEY,
+				type TEXT NOT NULL,
+				processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			`,
+		},
 		// Agregar más migraciones aquí según sea necesario
 	}
 
@@ -124,6 +431,11 @@ func RunMigrations(db *sql.DB) error {
 			if _, err := tx.Exec(migration.sql); err != nil {
 				return fmt.Errorf("error al ejecutar migración %d: %v", migration.version, err)
 			}
+			if migration.fn != nil {
+				if err := migration.fn(tx); err != nil {
+					return fmt.Errorf("error al ejecutar migración %d: %v", migration.version, err)
+				}
+			}
 
 			// Registrar migración
 			if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", migration.version); err != nil {
@@ -134,3 +446,31 @@ func RunMigrations(db *sql.DB) error {
 
 	return tx.Commit()
 }
+
+// hashExistingAPIKeys reemplaza las claves en claro copiadas a key_hash por su hash
+func hashExistingAPIKeys(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, key_hash FROM api_keys")
+	if err != nil {
+		return err
+	}
+	plain := map[string]string{}
+	for rows.Next() {
+		var id, key string
+		if err := rows.Scan(&id, &key); err != nil {
+			rows.Close()
+			return err
+		}
+		plain[id] = key
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, key := range plain {
+		if _, err := tx.Exec("UPDATE api_keys SET key_hash = ? WHERE id = ?", auth.HashAPIKey(key), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
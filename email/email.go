@@ -2,7 +2,9 @@ package email
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"html"
 	"log"
 	"os"
 	"time"
@@ -19,23 +21,56 @@ type Config struct {
 	From     string
 }
 
-// SendMagicLink envía un correo con un enlace mágico usando Amazon SES
-func SendMagicLink(email, token, host string) error {
-	// Configuración específica para Amazon SES
-	config := Config{
+// loadConfig lee la configuración SMTP (Amazon SES) del entorno
+func loadConfig() Config {
+	return Config{
 		Host:     os.Getenv("SMTP_HOST"),     // Usar SMTP_HOST del entorno
 		Port:     587,                        // Puerto STARTTLS
 		Username: os.Getenv("SMTP_USERNAME"), // IAM SMTP username
 		Password: os.Getenv("SMTP_PASSWORD"), // IAM SMTP password
 		From:     os.Getenv("SMTP_FROM"),     // Email verificado en SES
 	}
+}
+
+// complete indica si están todos los valores necesarios para enviar correo
+func (c Config) complete() bool {
+	return c.Host != "" && c.Username != "" && c.Password != "" && c.From != ""
+}
+
+// sendMail envía un correo HTML a través del servidor SMTP configurado
+func sendMail(config Config, to, subject, body string) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", config.From)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/html", body)
+
+	d := gomail.NewDialer(config.Host, config.Port, config.Username, config.Password)
+	d.TLSConfig = &tls.Config{ServerName: config.Host}
+	d.SSL = false               // Usar STARTTLS
+	d.LocalName = "toolbox-api" // HELO/EHLO identity
+
+	log.Printf("Iniciando envío de correo a %s a través de %s:%d", to, config.Host, config.Port)
+
+	if err := d.DialAndSend(m); err != nil {
+		errMsg := fmt.Sprintf("Error al enviar correo a %s: %v", to, err)
+		log.Printf("%s. Detalles: Host=%s, Username=%s, From=%s",
+			errMsg, config.Host, config.Username, config.From)
+		return errors.New(errMsg)
+	}
+	return nil
+}
+
+// SendMagicLink envía un correo con un enlace mágico usando Amazon SES
+func SendMagicLink(email, token, host string) error {
+	config := loadConfig()
 
 	log.Printf("Configurando envío de correo a: %s", email)
 	log.Printf("Configuración SMTP - Host: %s, Usuario: %s, From: %s",
 		config.Host, config.Username, config.From)
 
 	// Validar configuración pero no fallar en desarrollo
-	if config.Host == "" || config.Username == "" || config.Password == "" || config.From == "" {
+	if !config.complete() {
 		errMsg := "Configuración SMTP incompleta. Verifica las variables de entorno SMTP_*"
 		magicLink := fmt.Sprintf("http://%s/api/auth/validate?token=%s", host, token)
 		log.Printf("%s. Enlace mágico para %s: %s", errMsg, email, magicLink)
@@ -57,16 +92,10 @@ func SendMagicLink(email, token, host string) error {
 				config.From = os.Getenv("SMTP_FROM")
 			}
 		} else {
-			return fmt.Errorf(errMsg)
+			return errors.New(errMsg)
 		}
 	}
 
-	// Crear mensaje
-	m := gomail.NewMessage()
-	m.SetHeader("From", config.From)
-	m.SetHeader("To", email)
-	m.SetHeader("Subject", "Tu enlace de inicio de sesión")
-
 	// Cuerpo del correo con estilos
 	magicLink := fmt.Sprintf("http://%s/api/auth/validate?token=%s", host, token)
 	appName := os.Getenv("APP_NAME")
@@ -160,35 +189,47 @@ func SendMagicLink(email, token, host string) error {
 	</html>
 	`, appName, host, appName, appName, magicLink, magicLink, time.Now().Year(), appName)
 
-	m.SetBody("text/html", body)
+	if err := sendMail(config, email, "Tu enlace de inicio de sesión", body); err != nil {
+		return err
+	}
 
-	// Configurar cliente SMTP para Amazon SES
-	log.Printf("Configuración del cliente SMTP con autenticación")
-	d := gomail.NewDialer(config.Host, config.Port, config.Username, config.Password)
+	log.Printf("Correo enviado exitosamente a %s", email)
+	return nil
+}
 
-	// Configuración de depuración
-	d.TLSConfig = &tls.Config{
-		InsecureSkipVerify: true, // Solo para depuración, NO usar en producción
-		ServerName:         config.Host,
+// SendMonitorChange notifica por correo que una página monitorizada ha cambiado
+func SendMonitorChange(to, monitorURL, diff string, changePercent float64) error {
+	config := loadConfig()
+	if !config.complete() {
+		return fmt.Errorf("configuración SMTP incompleta. Verifica las variables de entorno SMTP_*")
 	}
 
-	// Log de configuración
-	log.Printf("Configurando dialer SMTP - Host: %s, Port: %d, Username: %s",
-		config.Host, config.Port, config.Username)
-
-	d.SSL = false               // Usar STARTTLS
-	d.LocalName = "toolbox-api" // HELO/EHLO identity
+	appName := os.Getenv("APP_NAME")
+	if appName == "" {
+		appName = "Toolbox API"
+	}
 
-	// Enviar correo
-	log.Printf("Iniciando envío de correo a %s a través de %s:%d", email, config.Host, config.Port)
+	// Limitar el diff para no enviar correos enormes
+	if len(diff) > 20000 {
+		diff = diff[:20000] + "\n[...]"
+	}
 
-	if err := d.DialAndSend(m); err != nil {
-		errMsg := fmt.Sprintf("Error al enviar correo a %s: %v", email, err)
-		log.Printf("%s. Detalles: Host=%s, Username=%s, From=%s",
-			errMsg, config.Host, config.Username, config.From)
-		return fmt.Errorf(errMsg)
+	body := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<head><meta charset="UTF-8"><title>Cambios detectados - %s</title></head>
+	<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; color: #333; max-width: 700px; margin: 0 auto; padding: 20px;">
+	    <h2>Cambios detectados</h2>
+	    <p>La página <a href="%s">%s</a> ha cambiado un %.1f%% desde la última comprobación.</p>
+	    <pre style="background-color: #f3f4f6; padding: 10px; border-radius: 4px; white-space: pre-wrap; word-break: break-all;">%s</pre>
+	    <p style="color: #6b7280; font-size: 14px;">© %d %s. Este es un correo automático, por favor no respondas a este mensaje.</p>
+	</body>
+	</html>
+	`, appName, html.EscapeString(monitorURL), html.EscapeString(monitorURL), changePercent, html.EscapeString(diff), time.Now().Year(), appName)
+	if err := sendMail(config, to, fmt.Sprintf("Cambios detectados en %s", monitorURL), body); err != nil {
+		return fmt.Errorf("error al enviar notificación de cambios a %s: %v", to, err)
 	}
 
-	log.Printf("Correo enviado exitosamente a %s", email)
+	log.Printf("Notificación de cambios enviada a %s (%s)", to, monitorURL)
 	return nil
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
@@ -128,6 +129,7 @@ func main() {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
+			w.Header().Set("Access-Control-Expose-Headers", "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After, X-Quota-Limit, X-Quota-Remaining, X-Quota-Reset")
 
 			// Manejar solicitudes preflight
 			if r.Method == "OPTIONS" {
@@ -145,6 +147,12 @@ func main() {
 	// Configurar rutas de la API
 	api.SetupRoutes(mux, DB)
 
+	// Iniciar el planificador de monitores de cambios
+	api.StartMonitorScheduler(context.Background())
+
+	// Iniciar la renovación de los periodos de cuota mensual
+	api.StartQuotaScheduler(context.Background())
+
 	// Ruta de health check
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		// Verificar conexión a la base de datos
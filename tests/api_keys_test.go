@@ -0,0 +1,411 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"toolbox/auth"
+	"toolbox/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeysHashedAtRest(t *testing.T) {
+	mux, _ := setupTestAPI(t)
+
+	jwtToken, err := auth.GenerateJWT("test@example.com")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/keys", nil)
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var created struct {
+		ID     string `json:"id"`
+		Key    string `json:"key"`
+		Prefix string `json:"prefix"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	assert.Contains(t, created.Key, "tbx_")
+	assert.Equal(t, created.Key[:auth.APIKeyPrefixLength], created.Prefix)
+
+	// En la base de datos solo quedan el hash y el prefijo
+	var keyHash, keyPrefix string
+	err = auth.DB.QueryRow("SELECT key_hash, key_prefix FROM api_keys WHERE id = ?", created.ID).Scan(&keyHash, &keyPrefix)
+	assert.NoError(t, err)
+	assert.Equal(t, auth.HashAPIKey(created.Key), keyHash)
+	assert.NotContains(t, keyHash, created.Key)
+	assert.Equal(t, created.Prefix, keyPrefix)
+
+	// El listado nunca devuelve la clave completa
+	req = httptest.NewRequest("GET", "/api/keys", nil)
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), created.Key)
+
+	var listed struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&listed))
+	found := false
+	for _, key := range listed.Keys {
+		assert.NotContains(t, key, "key")
+		if key["id"] == created.ID {
+			found = true
+			assert.Equal(t, created.Prefix, key["prefix"])
+		}
+	}
+	assert.True(t, found)
+
+	// La clave sigue autenticando y una clave desconocida no
+	code, _ := callTool(t, mux, created.Key, "webfetch", map[string]interface{}{"url": "no-es-una-url"})
+	assert.NotEqual(t, http.StatusUnauthorized, code)
+	code, _ = callTool(t, mux, "tbx_desconocida0000", "webfetch", map[string]interface{}{"url": "no-es-una-url"})
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestAPIKeyHashMigration(t *testing.T) {
+	memoryDB, err := database.NewInMemoryDB()
+	if err != nil {
+		t.Fatal("Error al configurar la base de datos en memoria")
+	}
+	defer memoryDB.Close()
+
+	// Esquema anterior a la migración 9, con la clave guardada en claro
+	_, err = memoryDB.DB.Exec(`
+		CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP);
+		INSERT INTO schema_migrations (version) VALUES (1), (2), (3), (4), (5), (6), (7), (8);
+		CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT UNIQUE NOT NULL, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP);
+		CREATE TABLE api_keys (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			key TEXT NOT NULL UNIQUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMP,
+			revoked BOOLEAN DEFAULT FALSE,
+			respect_robots BOOLEAN DEFAULT FALSE,
+			search_provider TEXT
+		);
+		INSERT INTO users (email) VALUES ('legacy@example.com');
+		INSERT INTO api_keys (id, user_id, name, key, respect_robots, search_provider)
+		VALUES ('k1', 1, 'antigua', 'tbx_LegacyKey123456', 1, 'brave');
+	`)
+	assert.NoError(t, err)
+
+	assert.NoError(t, database.RunMigrations(memoryDB.DB))
+
+	var keyHash, keyPrefix, provider string
+	var respectRobots bool
+	err = memoryDB.DB.QueryRow("SELECT key_hash, key_prefix, respect_robots, search_provider FROM api_keys WHERE id = 'k1'").
+		Scan(&keyHash, &keyPrefix, &respectRobots, &provider)
+	assert.NoError(t, err)
+	assert.Equal(t, auth.HashAPIKey("tbx_LegacyKey123456"), keyHash)
+	assert.Equal(t, "tbx_Legacy", keyPrefix)
+	assert.True(t, respectRobots)
+	assert.Equal(t, "brave", provider)
+}
+
+// createKey crea una API key con el token indicado (JWT o API key) y devuelve la respuesta
+func createKey(t *testing.T, mux *http.ServeMux, token, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest("POST", "/api/keys", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	return rr.Code, response
+}
+
+func TestScopedAPIKeys(t *testing.T) {
+	mux, fullKey := setupTestAPI(t)
+
+	jwtToken, err := auth.GenerateJWT("test@example.com")
+	assert.NoError(t, err)
+
+	code, response := createKey(t, mux, jwtToken, `{"scopes": ["tool:nada"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_scope", response["code"])
+
+	code, response = createKey(t, mux, jwtToken, `{"scopes": ["tool:search", "tool:search"]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{"tool:search"}, response["scopes"])
+	searchKey := response["key"].(string)
+
+	// La clave de solo búsqueda no puede usar otras herramientas
+	code, response = callTool(t, mux, searchKey, "webfetch", map[string]interface{}{"url": "no-es-una-url"})
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "insufficient_scope", response["code"])
+	assert.Equal(t, "tool:webfetch", response["scope"])
+
+	code, response = callTool(t, mux, searchKey, "search", map[string]interface{}{})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "missing_query", response["code"])
+
+	// Ni gestionar claves
+	req := httptest.NewRequest("GET", "/api/keys", nil)
+	req.Header.Set("Authorization", "Bearer "+searchKey)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	code, _ = createKey(t, mux, searchKey, `{}`)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// Ni acceder a los recursos de otras herramientas
+	for _, path := range []string{"/api/monitors", "/api/collections", "/api/jobs", "/api/artifacts/x"} {
+		code, _ = keyRequest(t, mux, "GET", path, searchKey, "")
+		assert.Equal(t, http.StatusForbidden, code, path)
+	}
+
+	// Una clave con keys:manage solo concede los permisos que tiene
+	code, response = createKey(t, mux, jwtToken, `{"scopes": ["keys:manage", "tool:feed"]}`)
+	assert.Equal(t, http.StatusOK, code)
+	managerKey := response["key"].(string)
+
+	code, response = createKey(t, mux, managerKey, `{"scopes": ["tool:webfetch"]}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "insufficient_scope", response["code"])
+
+	code, response = createKey(t, mux, managerKey, `{"scopes": ["tool:feed"]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{"tool:feed"}, response["scopes"])
+
+	// Las claves sin permisos explícitos conservan el acceso completo
+	code, _ = callTool(t, mux, fullKey, "webfetch", map[string]interface{}{"url": "no-es-una-url"})
+	assert.NotEqual(t, http.StatusForbidden, code)
+	code, _ = createKey(t, mux, fullKey, `{}`)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+// bodyTokenRequest envía una petición autenticada solo con el campo "token" del cuerpo
+func bodyTokenRequest(mux *http.ServeMux, method, path, token, body string) *httptest.ResponseRecorder {
+	if body == "" {
+		body = `{"token": "` + token + `"}`
+	} else {
+		body = `{"token": "` + token + `", ` + strings.TrimPrefix(body, "{")
+	}
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestScopedAPIKeyBodyToken(t *testing.T) {
+	mux, _ := setupTestAPI(t)
+
+	jwtToken, err := auth.GenerateJWT("test@example.com")
+	assert.NoError(t, err)
+	code, response := createKey(t, mux, jwtToken, `{"scopes": ["tool:search"]}`)
+	assert.Equal(t, http.StatusOK, code)
+	searchKey := response["key"].(string)
+	searchKeyID := response["id"].(string)
+
+	// Los permisos se comprueban contra la clave del cuerpo aunque no haya Authorization
+	for _, tc := range []struct {
+		method, path, body string
+	}{
+		{"POST", "/api/keys", `{"name": "escalada"}`},
+		{"PATCH", "/api/keys/" + searchKeyID, `{"name": "renombrada"}`},
+		{"POST", "/api/keys/" + searchKeyID + "/rotate", `{"grace_period_minutes": 0}`},
+		{"DELETE", "/api/keys/" + searchKeyID, ""},
+		{"POST", "/api/billing/checkout", `{"plan": "pro"}`},
+	} {
+		rr := bodyTokenRequest(mux, tc.method, tc.path, searchKey, tc.body)
+		assert.Equal(t, http.StatusForbidden, rr.Code, "%s %s", tc.method, tc.path)
+	}
+
+	rr := bodyTokenRequest(mux, "POST", "/api/tool", searchKey, `{"tool": "webfetch", "payload": {"url": "no-es-una-url"}}`)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, "insufficient_scope", response["code"])
+
+	// La clave sigue activa y no se creó ninguna otra
+	keys := listedKeys(t, mux, jwtToken, "")
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "active", keys[searchKeyID]["status"])
+}
+
+// keyRequest envía una petición autenticada a las rutas de claves y decodifica la respuesta
+func keyRequest(t *testing.T, mux *http.ServeMux, method, path, token, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	return rr.Code, response
+}
+
+// listedKeys devuelve las claves del listado indexadas por ID
+func listedKeys(t *testing.T, mux *http.ServeMux, token, query string) map[string]map[string]interface{} {
+	code, response := keyRequest(t, mux, "GET", "/api/keys"+query, token, "")
+	assert.Equal(t, http.StatusOK, code)
+	keys := map[string]map[string]interface{}{}
+	list, _ := response["keys"].([]interface{})
+	for _, item := range list {
+		key := item.(map[string]interface{})
+		keys[key["id"].(string)] = key
+	}
+	return keys
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	mux, _ := setupTestAPI(t)
+
+	jwtToken, err := auth.GenerateJWT("test@example.com")
+	assert.NoError(t, err)
+
+	// Nombre, descripción y caducidad indicados por el usuario
+	code, response := createKey(t, mux, jwtToken, `{"expires_at": "2001-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_key_options", response["code"])
+
+	expiresAt := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second).Format(time.RFC3339)
+	code, response = createKey(t, mux, jwtToken, `{"name": "integración CI", "description": "solo búsquedas", "expires_at": "`+expiresAt+`"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "integración CI", response["name"])
+	keyID := response["id"].(string)
+	oldKey := response["key"].(string)
+
+	listed := listedKeys(t, mux, jwtToken, "")
+	assert.Equal(t, "solo búsquedas", listed[keyID]["description"])
+	assert.Equal(t, expiresAt, listed[keyID]["expires_at"])
+	assert.Equal(t, "active", listed[keyID]["status"])
+
+	// PATCH renombra sin tocar la descripción
+	code, response = keyRequest(t, mux, "PATCH", "/api/keys/"+keyID, jwtToken, `{"name": "ci"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ci", response["name"])
+	assert.Equal(t, "solo búsquedas", response["description"])
+
+	code, response = keyRequest(t, mux, "PATCH", "/api/keys/"+keyID, jwtToken, `{"name": "  "}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_key_options", response["code"])
+
+	// La rotación emite una clave nueva y la anterior sigue valiendo durante la gracia
+	code, response = keyRequest(t, mux, "POST", "/api/keys/"+keyID+"/rotate", jwtToken, `{"grace_period_minutes": 30}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ci", response["name"])
+	assert.Equal(t, keyID, response["replaces"])
+	newID := response["id"].(string)
+	newKey := response["key"].(string)
+	assert.NotEqual(t, oldKey, newKey)
+	assert.NotEmpty(t, response["previous_expires_at"])
+
+	code, _ = callTool(t, mux, oldKey, "webfetch", map[string]interface{}{"url": "no-es-una-url"})
+	assert.NotEqual(t, http.StatusUnauthorized, code)
+	code, _ = callTool(t, mux, newKey, "webfetch", map[string]interface{}{"url": "no-es-una-url"})
+	assert.NotEqual(t, http.StatusUnauthorized, code)
+
+	// Al acabar la gracia la clave anterior caduca
+	_, err = auth.DB.Exec("UPDATE api_keys SET expires_at = datetime('now', '-1 minute') WHERE id = ?", keyID)
+	assert.NoError(t, err)
+	code, _ = callTool(t, mux, oldKey, "webfetch", map[string]interface{}{"url": "no-es-una-url"})
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	listed = listedKeys(t, mux, jwtToken, "")
+	assert.Equal(t, "expired", listed[keyID]["status"])
+	assert.Equal(t, newID, listed[keyID]["replaced_by"])
+
+	code, response = keyRequest(t, mux, "POST", "/api/keys/"+keyID+"/rotate", jwtToken, "")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "key_inactive", response["code"])
+
+	// DELETE revoca sin borrar: la clave deja de funcionar pero queda en el historial
+	code, response = keyRequest(t, mux, "DELETE", "/api/keys/"+newID, jwtToken, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, response["revoked"])
+
+	code, _ = callTool(t, mux, newKey, "webfetch", map[string]interface{}{"url": "no-es-una-url"})
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	assert.NotContains(t, listedKeys(t, mux, jwtToken, ""), newID)
+	history := listedKeys(t, mux, jwtToken, "?include_revoked=true")
+	assert.Equal(t, "revoked", history[newID]["status"])
+	assert.NotEmpty(t, history[newID]["revoked_at"])
+}
+
+// callToolFrom llama a una herramienta simulando la IP y los encabezados del cliente
+func callToolFrom(t *testing.T, mux *http.ServeMux, apiKey, remoteAddr string, headers map[string]string) (int, map[string]interface{}) {
+	req := httptest.NewRequest("POST", "/api/tool", strings.NewReader(`{"tool": "webfetch", "payload": {"url": "no-es-una-url"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	return rr.Code, response
+}
+
+func TestAPIKeyRestrictions(t *testing.T) {
+	mux, _ := setupTestAPI(t)
+
+	jwtToken, err := auth.GenerateJWT("test@example.com")
+	assert.NoError(t, err)
+
+	code, response := createKey(t, mux, jwtToken, `{"allowed_ips": ["300.1.1.1"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_key_options", response["code"])
+
+	code, response = createKey(t, mux, jwtToken, `{"allowed_origins": ["https://ejemplo.com/ruta"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_key_options", response["code"])
+
+	// Restricción por IP/CIDR
+	code, response = createKey(t, mux, jwtToken, `{"allowed_ips": ["10.1.2.3/16", "2001:db8::1"]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{"10.1.0.0/16", "2001:db8::1"}, response["allowed_ips"])
+	ipKey := response["key"].(string)
+
+	code, _ = callToolFrom(t, mux, ipKey, "10.1.200.7:5000", nil)
+	assert.NotEqual(t, http.StatusForbidden, code)
+	code, _ = callToolFrom(t, mux, ipKey, "[2001:db8::1]:5000", nil)
+	assert.NotEqual(t, http.StatusForbidden, code)
+	code, response = callToolFrom(t, mux, ipKey, "192.0.2.1:5000", nil)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "key_restricted", response["code"])
+
+	// Restricción por origen (Origin o, en su defecto, Referer)
+	code, response = createKey(t, mux, jwtToken, `{"allowed_origins": ["https://app.ejemplo.com", "*.widgets.net"]}`)
+	assert.Equal(t, http.StatusOK, code)
+	originKey := response["key"].(string)
+	originKeyID := response["id"].(string)
+
+	code, _ = callToolFrom(t, mux, originKey, "192.0.2.1:5000", map[string]string{"Origin": "https://app.ejemplo.com"})
+	assert.NotEqual(t, http.StatusForbidden, code)
+	code, _ = callToolFrom(t, mux, originKey, "192.0.2.1:5000", map[string]string{"Referer": "https://tienda.widgets.net/producto/1"})
+	assert.NotEqual(t, http.StatusForbidden, code)
+	code, _ = callToolFrom(t, mux, originKey, "192.0.2.1:5000", map[string]string{"Origin": "http://app.ejemplo.com"})
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = callToolFrom(t, mux, originKey, "192.0.2.1:5000", map[string]string{"Origin": "https://widgets.net.evil.com"})
+	assert.Equal(t, http.StatusForbidden, code)
+	code, response = callToolFrom(t, mux, originKey, "192.0.2.1:5000", nil)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "key_restricted", response["code"])
+
+	// PATCH con lista vacía elimina la restricción
+	code, response = keyRequest(t, mux, "PATCH", "/api/keys/"+originKeyID, jwtToken, `{"allowed_origins": []}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{}, response["allowed_origins"])
+	code, _ = callToolFrom(t, mux, originKey, "192.0.2.1:5000", nil)
+	assert.NotEqual(t, http.StatusForbidden, code)
+}
@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"toolbox/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testWebhookSecret = "whsec_test_secret"
+
+// stripeStub simula la API de Stripe con las respuestas que usa la facturación
+func stripeStub(t *testing.T, customers *int32) *httptest.Server {
+	subscription, err := os.ReadFile("testdata/stripe/subscription.json")
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer sk_test_123", r.Header.Get("Authorization"))
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/customers":
+			atomic.AddInt32(customers, 1)
+			assert.Equal(t, "customer-1", r.Header.Get("Idempotency-Key"))
+			assert.Equal(t, "test@example.com", r.PostForm.Get("email"))
+			w.Write([]byte(`{"id": "cus_TEST123", "object": "customer"}`))
+		case "POST /v1/checkout/sessions":
+			assert.Equal(t, "subscription", r.PostForm.Get("mode"))
+			assert.Equal(t, "cus_TEST123", r.PostForm.Get("customer"))
+			assert.Equal(t, "price_pro", r.PostForm.Get("line_items[0][price]"))
+			assert.Equal(t, "1", r.PostForm.Get("client_reference_id"))
+			w.Write([]byte(`{"id": "cs_test_a1b2c3", "url": "https://checkout.stripe.com/c/pay/cs_test_a1b2c3"}`))
+		case "POST /v1/billing_portal/sessions":
+			assert.Equal(t, "cus_TEST123", r.PostForm.Get("customer"))
+			w.Write([]byte(`{"id": "bps_123", "url": "https://billing.stripe.com/p/session/test_123"}`))
+		case "GET /v1/subscriptions/sub_TEST123":
+			w.Write(subscription)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"type": "invalid_request_error", "message": "Unrecognized request URL"}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// signStripePayload genera un encabezado Stripe-Signature como el de la Stripe CLI
+func signStripePayload(payload []byte, secret string, timestamp time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s", timestamp.Unix(), payload)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp.Unix(), hex.EncodeToString(mac.Sum(nil)))
+}
+
+// sendWebhook envía un evento firmado a /api/billing/webhook
+func sendWebhook(mux *http.ServeMux, payload []byte, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/billing/webhook", strings.NewReader(string(payload)))
+	req.Header.Set("Stripe-Signature", signature)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+// sendFixture envía firmado uno de los eventos de testdata/stripe
+func sendFixture(t *testing.T, mux *http.ServeMux, name string) *httptest.ResponseRecorder {
+	payload, err := os.ReadFile("testdata/stripe/" + name + ".json")
+	assert.NoError(t, err)
+	return sendWebhook(mux, payload, signStripePayload(payload, testWebhookSecret, time.Now()))
+}
+
+// billingRequest llama a un endpoint de facturación con el token indicado
+func billingRequest(t *testing.T, mux *http.ServeMux, token, path, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	return rr.Code, response
+}
+
+func userPlan(t *testing.T) string {
+	var plan string
+	assert.NoError(t, auth.DB.QueryRow("SELECT plan FROM users WHERE email = 'test@example.com'").Scan(&plan))
+	return plan
+}
+
+func setupBillingTest(t *testing.T) (*http.ServeMux, string, *int32) {
+	var customers int32
+	stub := stripeStub(t, &customers)
+	t.Setenv("STRIPE_SECRET_KEY", "sk_test_123")
+	t.Setenv("STRIPE_WEBHOOK_SECRET", testWebhookSecret)
+	t.Setenv("STRIPE_API_BASE", stub.URL)
+	t.Setenv("STRIPE_PRICE_PRO", "price_pro")
+	t.Setenv("STRIPE_PRICE_TEAM", "price_team")
+
+	mux, apiKey := setupTestAPI(t)
+	return mux, apiKey, &customers
+}
+
+func TestBillingSessions(t *testing.T) {
+	mux, apiKey, customers := setupBillingTest(t)
+
+	code, response := billingRequest(t, mux, apiKey, "/api/billing/portal", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "no_subscription", response["code"])
+
+	// El cliente de Stripe se crea una sola vez
+	for i := 0; i < 2; i++ {
+		code, response = billingRequest(t, mux, apiKey, "/api/billing/checkout", `{"plan": "pro"}`)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "https://checkout.stripe.com/c/pay/cs_test_a1b2c3", response["url"])
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(customers))
+
+	code, response = billingRequest(t, mux, apiKey, "/api/billing/checkout", `{"plan": "free"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_plan", response["code"])
+
+	code, response = billingRequest(t, mux, apiKey, "/api/billing/portal", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "https://billing.stripe.com/p/session/test_123", response["url"])
+
+	// Una clave sin billing:manage no puede gestionar la facturación
+	jwtToken, err := auth.GenerateJWT("test@example.com")
+	assert.NoError(t, err)
+	_, response = createKey(t, mux, jwtToken, `{"scopes": ["read:usage"]}`)
+	code, response = billingRequest(t, mux, response["key"].(string), "/api/billing/checkout", `{"plan": "pro"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "insufficient_scope", response["code"])
+}
+
+func TestBillingDisabled(t *testing.T) {
+	t.Setenv("STRIPE_SECRET_KEY", "")
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "")
+	mux, apiKey := setupTestAPI(t)
+
+	code, response := billingRequest(t, mux, apiKey, "/api/billing/checkout", `{"plan": "pro"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "billing_disabled", response["code"])
+
+	rr := sendFixture(t, mux, "checkout_session_completed")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+func TestBillingWebhooks(t *testing.T) {
+	mux, _, _ := setupBillingTest(t)
+
+	payload, err := os.ReadFile("testdata/stripe/checkout_session_completed.json")
+	assert.NoError(t, err)
+
+	// Firmas no válidas o caducadas
+	assert.Equal(t, http.StatusBadRequest, sendWebhook(mux, payload, signStripePayload(payload, "whsec_otro", time.Now())).Code)
+	assert.Equal(t, http.StatusBadRequest, sendWebhook(mux, payload, signStripePayload(payload, testWebhookSecret, time.Now().Add(-time.Hour))).Code)
+	assert.Equal(t, http.StatusBadRequest, sendWebhook(mux, payload, "").Code)
+	assert.Equal(t, "free", userPlan(t))
+
+	// Checkout completado: se asocia el cliente y se aplica el plan de la suscripción
+	assert.Equal(t, http.StatusOK, sendFixture(t, mux, "checkout_session_completed").Code)
+	assert.Equal(t, "pro", userPlan(t))
+	var customer string
+	assert.NoError(t, auth.DB.QueryRow("SELECT stripe_customer_id FROM users WHERE email = 'test@example.com'").Scan(&customer))
+	assert.Equal(t, "cus_TEST123", customer)
+
+	// Cambio de plan desde el portal
+	assert.Equal(t, http.StatusOK, sendFixture(t, mux, "customer_subscription_updated").Code)
+	assert.Equal(t, "team", userPlan(t))
+
+	// Un evento repetido no se vuelve a aplicar
+	_, err = auth.DB.Exec("UPDATE users SET plan = 'free'")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, sendFixture(t, mux, "customer_subscription_updated").Code)
+	assert.Equal(t, "free", userPlan(t))
+	_, err = auth.DB.Exec("UPDATE users SET plan = 'team'")
+	assert.NoError(t, err)
+
+	// Pago fallido: se registra sin cambiar el plan
+	assert.Equal(t, http.StatusOK, sendFixture(t, mux, "invoice_payment_failed").Code)
+	var failed bool
+	assert.NoError(t, auth.DB.QueryRow("SELECT payment_failed_at IS NOT NULL FROM subscriptions WHERE id = 'sub_TEST123'").Scan(&failed))
+	assert.True(t, failed)
+	assert.Equal(t, "team", userPlan(t))
+
+	// Cancelación: vuelve al plan gratuito
+	assert.Equal(t, http.StatusOK, sendFixture(t, mux, "customer_subscription_deleted").Code)
+	assert.Equal(t, "free", userPlan(t))
+
+	// Un evento anterior que llega tarde no reactiva la suscripción
+	var stale map[string]interface{}
+	payload, err = os.ReadFile("testdata/stripe/customer_subscription_updated.json")
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(payload, &stale))
+	stale["id"] = "evt_1PsubscriptionUpdatedLate"
+	stale["created"] = 1700000150
+	payload, err = json.Marshal(stale)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, sendWebhook(mux, payload, signStripePayload(payload, testWebhookSecret, time.Now())).Code)
+	assert.Equal(t, "free", userPlan(t))
+
+	var events int
+	assert.NoError(t, auth.DB.QueryRow("SELECT COUNT(*) FROM stripe_events").Scan(&events))
+	assert.Equal(t, 5, events)
+}
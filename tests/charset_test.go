@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestWebFetchCharsetTranscoding(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	shiftJIS, err := japanese.ShiftJIS.NewEncoder().String(`<html><head><meta charset="Shift_JIS"><title>日本語のページ</title></head><body><p>こんにちは世界</p></body></html>`)
+	assert.NoError(t, err)
+	windows1252, err := charmap.Windows1252.NewEncoder().String(`<html><head><title>Café</title></head><body><p>Señor “Niño”</p></body></html>`)
+	assert.NoError(t, err)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sjis":
+			// Sin charset en el encabezado: se detecta por <meta charset>
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(shiftJIS))
+		case "/cp1252":
+			w.Header().Set("Content-Type", "text/html; charset=windows-1252")
+			w.Write([]byte(windows1252))
+		}
+	}))
+	defer testServer.Close()
+
+	tests := []struct {
+		path    string
+		charset string
+		source  string
+		title   string
+		body    string
+	}{
+		{"/sjis", "shift_jis", "meta", "日本語のページ", "こんにちは世界"},
+		{"/cp1252", "windows-1252", "header", "Café", "Señor “Niño”"},
+	}
+
+	for _, tc := range tests {
+		code, response := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+			"url":    testServer.URL + tc.path,
+			"format": "text",
+		})
+
+		assert.Equal(t, http.StatusOK, code, "Código de estado incorrecto para %s", tc.path)
+		output, _ := response["output"].(string)
+		assert.Contains(t, output, tc.body)
+
+		metadata, _ := response["metadata"].(map[string]interface{})
+		assert.Equal(t, tc.charset, metadata["charset"])
+		assert.Equal(t, tc.source, metadata["charset_source"])
+		assert.Equal(t, tc.title, metadata["title"])
+	}
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"toolbox/tools"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebFetchChunks(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	long := strings.Repeat("Lorem ipsum dolor sit amet, consectetur adipiscing elit. ", 40)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><body>
+			<h1>Guía</h1><p>Introducción breve con acentos: canción, año.</p>
+			<h2>Instalación</h2><p>` + long + `</p>
+			<h2>Uso</h2><p>Ejemplo final.</p>
+		</body></html>`))
+	}))
+	defer testServer.Close()
+
+	code, response := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url":           testServer.URL,
+		"format":        "markdown",
+		"chunks":        true,
+		"chunk_size":    64,
+		"chunk_overlap": 8,
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	output := []rune(response["output"].(string))
+	metadata := response["metadata"].(map[string]interface{})
+	assert.Greater(t, metadata["token_estimate"], float64(0))
+
+	chunks := response["chunks"].([]interface{})
+	assert.Greater(t, len(chunks), 3)
+	assert.Equal(t, float64(len(chunks)), metadata["chunk_count"])
+
+	var paths []string
+	for _, c := range chunks {
+		chunk := c.(map[string]interface{})
+		assert.LessOrEqual(t, chunk["tokens"], float64(64))
+
+		// Las posiciones son en caracteres sobre output
+		start, end := int(chunk["start"].(float64)), int(chunk["end"].(float64))
+		assert.Equal(t, string(output[start:end]), chunk["text"])
+
+		var path []string
+		for _, p := range chunk["heading_path"].([]interface{}) {
+			path = append(path, p.(string))
+		}
+		paths = append(paths, strings.Join(path, " > "))
+	}
+	assert.Equal(t, "Guía", paths[0])
+	assert.Contains(t, paths, "Guía > Instalación")
+	assert.Equal(t, "Guía > Uso", paths[len(paths)-1])
+
+	// Opciones inválidas
+	code, response = callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url":           testServer.URL,
+		"chunks":        true,
+		"chunk_size":    64,
+		"chunk_overlap": 40,
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_chunk_options", response["code"])
+}
+
+func TestChunkContentOverlap(t *testing.T) {
+	content := strings.Repeat("uno dos tres cuatro cinco seis siete ocho. ", 30)
+	chunks := tools.ChunkContent(content, &tools.ChunkOptions{Enabled: true, Size: 40, Overlap: 10})
+	assert.Greater(t, len(chunks), 1)
+	for i := 1; i < len(chunks); i++ {
+		// Cada fragmento empieza antes de que termine el anterior
+		assert.Less(t, chunks[i].Start, chunks[i-1].End)
+		assert.LessOrEqual(t, chunks[i].Tokens, 40)
+	}
+}
+
+func TestChunkContentLongWords(t *testing.T) {
+	// Una URL, un bloque base64 y texto CJK sin espacios superan el tamaño
+	content := "Enlace: https://example.com/" + strings.Repeat("a1b2/c3d4-", 300) +
+		"\n\n" + strings.Repeat("QUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVo=", 100) +
+		"\n\n" + strings.Repeat("東京都の天気は晴れです", 100)
+	chunks := tools.ChunkContent(content, &tools.ChunkOptions{Enabled: true, Size: 40})
+	assert.Greater(t, len(chunks), 10)
+
+	var rebuilt strings.Builder
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, chunk.Tokens, 40)
+		assert.NotEmpty(t, strings.TrimSpace(chunk.Text))
+		rebuilt.WriteString(chunk.Text)
+	}
+	// Los cortes no pierden caracteres
+	assert.Equal(t, strings.Join(strings.Fields(content), ""), strings.Join(strings.Fields(rebuilt.String()), ""))
+}
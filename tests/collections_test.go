@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"toolbox/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectionSearch(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	pages := map[string]string{
+		"/go":     `<html><head><title>Concurrencia en Go</title></head><body><p>Las goroutines y los canales simplifican la concurrencia.</p></body></html>`,
+		"/rust":   `<html><head><title>Rust</title></head><body><p>El sistema de ownership evita condiciones de carrera sin recolector.</p></body></html>`,
+		"/python": `<html><head><title>Python</title></head><body><p>El GIL limita la concurrencia de hilos en CPython.</p></body></html>`,
+	}
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(pages[r.URL.Path]))
+	}))
+	defer testServer.Close()
+
+	for path := range pages {
+		code, response := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+			"url":        testServer.URL + path,
+			"format":     "text",
+			"collection": "lenguajes",
+		})
+		assert.Equal(t, http.StatusOK, code)
+		saved := response["metadata"].(map[string]interface{})["collection"].(map[string]interface{})
+		assert.Equal(t, "lenguajes", saved["name"])
+	}
+
+	// Volver a guardar la misma URL reemplaza el documento
+	code, _ := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url":        testServer.URL + "/go",
+		"format":     "text",
+		"collection": "lenguajes",
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	// El título pesa más que el cuerpo en el ranking BM25
+	code, response := callTool(t, mux, apiKey, "collection_search", map[string]interface{}{
+		"collection": "lenguajes",
+		"query":      "concurrencia",
+	})
+	assert.Equal(t, http.StatusOK, code)
+	results := response["results"].([]interface{})
+	if assert.Len(t, results, 2) {
+		first := results[0].(map[string]interface{})
+		assert.Equal(t, testServer.URL+"/go", first["url"])
+		assert.Contains(t, first["snippet"], "**concurrencia**")
+		assert.Greater(t, first["score"], results[1].(map[string]interface{})["score"])
+	}
+
+	// Los operadores de FTS5 en la consulta no provocan errores
+	code, response = callTool(t, mux, apiKey, "collection_search", map[string]interface{}{
+		"collection": "lenguajes",
+		"query":      `"ownership" carrera*`,
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), response["count"])
+
+	// Filtros por dominio y fecha
+	code, response = callTool(t, mux, apiKey, "collection_search", map[string]interface{}{
+		"collection": "lenguajes",
+		"query":      "concurrencia",
+		"domain":     "example.com",
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(0), response["count"])
+
+	code, response = callTool(t, mux, apiKey, "collection_search", map[string]interface{}{
+		"collection": "lenguajes",
+		"query":      "concurrencia",
+		"since":      "2999-01-01",
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(0), response["count"])
+
+	code, response = callTool(t, mux, apiKey, "collection_search", map[string]interface{}{
+		"collection": "inexistente",
+		"query":      "go",
+	})
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "collection_not_found", response["code"])
+}
+
+func TestCollectionLimits(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if r.URL.Path == "/grande" {
+			w.Write([]byte(strings.Repeat("a", 2*1024*1024)))
+			return
+		}
+		w.Write([]byte("contenido de " + r.URL.Path))
+	}))
+	defer testServer.Close()
+
+	save := func(path string) map[string]interface{} {
+		code, response := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+			"url":        testServer.URL + path,
+			"collection": "limites",
+		})
+		assert.Equal(t, http.StatusOK, code)
+		return response
+	}
+
+	// Los documentos demasiado grandes no se guardan
+	response := save("/grande")
+	assert.Equal(t, "collection_document_too_large", response["warning"].(map[string]interface{})["code"])
+
+	// Llenar la colección hasta el máximo de documentos
+	save("/primero")
+	_, err := auth.DB.Exec(`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 999)
+		INSERT INTO collection_documents (collection_id, url, domain, title, content)
+		SELECT (SELECT id FROM collections WHERE name = 'limites'), 'http://relleno/' || i, 'relleno', '', 'relleno' FROM n`)
+	assert.NoError(t, err)
+
+	response = save("/nuevo")
+	assert.Equal(t, "collection_full", response["warning"].(map[string]interface{})["code"])
+
+	// Reemplazar un documento existente sigue permitido
+	response = save("/primero")
+	assert.Nil(t, response["warning"])
+	assert.NotNil(t, response["metadata"].(map[string]interface{})["collection"])
+}
+
+func TestCollectionDatabaseError(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	// Un error de base de datos no se presenta como colección inexistente
+	_, err := auth.DB.Exec("DROP TABLE collections")
+	assert.NoError(t, err)
+
+	code, response := callTool(t, mux, apiKey, "collection_search", map[string]interface{}{
+		"collection": "lenguajes",
+		"query":      "go",
+	})
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Equal(t, "database_error", response["code"])
+}
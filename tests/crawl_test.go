@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"toolbox/api"
+	"toolbox/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlJob(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><head><title>Inicio</title></head><body>
+				<a href="/docs/a">A</a> <a href="/docs/b#seccion">B</a> <a href="/blog/x">X</a>
+				<a href="https://example.com/">fuera</a> <a href="/logo.png">logo</a></body></html>`))
+		case "/docs/a":
+			w.Write([]byte(`<html><body><h1>A</h1><a href="/docs/c">C</a></body></html>`))
+		default:
+			w.Write([]byte(`<html><body><p>` + r.URL.Path + `</p></body></html>`))
+		}
+	}))
+	defer testServer.Close()
+
+	code, response := callTool(t, mux, apiKey, "crawl", map[string]interface{}{
+		"url":       testServer.URL + "/",
+		"max_depth": 1,
+		"exclude":   []string{"/blog/"},
+		"format":    "text",
+	})
+	assert.Equal(t, http.StatusAccepted, code)
+	jobID, _ := response["job_id"].(string)
+	assert.NotEmpty(t, jobID)
+
+	job := waitForJob(t, mux, apiKey, jobID)
+	assert.Equal(t, "completed", job["status"])
+	result := job["result"].(map[string]interface{})
+	pages := result["pages"].([]interface{})
+
+	// Semilla + /docs/a + /docs/b; /docs/c supera la profundidad, /blog está excluido
+	// y los enlaces externos o a imágenes no se siguen
+	var urls []string
+	for _, p := range pages {
+		urls = append(urls, p.(map[string]interface{})["url"].(string))
+	}
+	assert.ElementsMatch(t, []string{
+		testServer.URL + "/",
+		testServer.URL + "/docs/a",
+		testServer.URL + "/docs/b",
+	}, urls)
+	assert.Equal(t, "Inicio", pages[0].(map[string]interface{})["title"])
+
+	// Opciones inválidas se rechazan antes de crear el trabajo
+	code, response = callTool(t, mux, apiKey, "crawl", map[string]interface{}{
+		"url":     testServer.URL,
+		"include": []string{"("},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_crawl_options", response["code"])
+}
+
+func TestCrawlRequestOptions(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	// Solo responde a peticiones con el encabezado y la cookie indicados
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("sesion")
+		if r.Header.Get("X-Token") != "secreto" || err != nil || cookie.Value != "abc" {
+			http.Error(w, "prohibido", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<html><body><a href="/interior">Interior</a></body></html>`))
+			return
+		}
+		w.Write([]byte(`<html><body><p>Interior</p></body></html>`))
+	}))
+	defer testServer.Close()
+
+	code, response := callTool(t, mux, apiKey, "crawl", map[string]interface{}{
+		"url":     testServer.URL + "/",
+		"headers": map[string]string{"X-Token": "secreto"},
+		"cookies": map[string]string{"sesion": "abc"},
+	})
+	assert.Equal(t, http.StatusAccepted, code)
+
+	jobID := response["job_id"].(string)
+	job := waitForJob(t, mux, apiKey, jobID)
+	assert.Equal(t, "completed", job["status"])
+	pages := job["result"].(map[string]interface{})["pages"].([]interface{})
+	if assert.Len(t, pages, 2) {
+		for _, p := range pages {
+			page := p.(map[string]interface{})
+			assert.Equal(t, float64(http.StatusOK), page["status_code"], page["url"])
+			assert.Empty(t, page["error"])
+		}
+	}
+
+	// Los encabezados y cookies no se guardan con el trabajo
+	var params string
+	assert.NoError(t, auth.DB.QueryRow("SELECT params FROM jobs WHERE id = ?", jobID).Scan(&params))
+	assert.Contains(t, params, testServer.URL)
+	assert.NotContains(t, params, "secreto")
+	assert.NotContains(t, params, "abc")
+
+	// El rastreo solo admite GET
+	code, response = callTool(t, mux, apiKey, "crawl", map[string]interface{}{
+		"url":    testServer.URL + "/",
+		"method": "POST",
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_method", response["code"])
+}
+
+func TestInterruptedJobsOnRestart(t *testing.T) {
+	setupTestAPI(t)
+
+	// Trabajos en curso de otra máquina: uno con latido reciente, otro abandonado
+	// y uno anterior a los latidos
+	_, err := auth.DB.Exec(`INSERT INTO jobs (id, user_id, tool, status, owner, heartbeat_at) VALUES
+		('job_vivo', 1, 'crawl', 'running', 'otra-maquina', CURRENT_TIMESTAMP),
+		('job_abandonado', 1, 'crawl', 'running', 'otra-maquina', datetime('now', '-10 minutes')),
+		('job_antiguo', 1, 'crawl', 'queued', NULL, NULL)`)
+	assert.NoError(t, err)
+
+	// Reiniciar el servidor
+	api.SetupRoutes(http.NewServeMux(), auth.DB)
+
+	for id, expected := range map[string]string{
+		"job_vivo":       "running",
+		"job_abandonado": "failed",
+		"job_antiguo":    "failed",
+	} {
+		var status string
+		assert.NoError(t, auth.DB.QueryRow("SELECT status FROM jobs WHERE id = ?", id).Scan(&status))
+		assert.Equal(t, expected, status, id)
+	}
+}
+
+// waitForJob consulta el estado del trabajo hasta que termina
+func waitForJob(t *testing.T, mux http.Handler, apiKey, jobID string) map[string]interface{} {
+	var job map[string]interface{}
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest("GET", "/api/jobs/"+jobID, nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var status struct {
+			Job map[string]interface{} `json:"job"`
+		}
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&status))
+		job = status.Job
+		if job["status"] == "completed" || job["status"] == "failed" {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return job
+}
@@ -0,0 +1,263 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"toolbox/api"
+	"toolbox/auth"
+	"toolbox/database"
+	"toolbox/tools"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupTestAPI crea una base de datos en memoria, registra las rutas y devuelve
+// el enrutador junto con una API key válida para un usuario de prueba
+func setupTestAPI(t *testing.T) (*http.ServeMux, string) {
+	memoryDB, err := database.NewInMemoryDB()
+	if err != nil {
+		t.Fatal("Error al configurar la base de datos en memoria")
+	}
+	t.Cleanup(func() { memoryDB.Close() })
+
+	if err := database.RunMigrations(memoryDB.DB); err != nil {
+		t.Fatal("Error al ejecutar las migraciones:", err)
+	}
+
+	mux := http.NewServeMux()
+	api.SetupRoutes(mux, memoryDB.DB)
+
+	userID, err := getUserIDByEmail(memoryDB.DB, "test@example.com")
+	if err != nil {
+		t.Fatal("Error al crear usuario de prueba:", err)
+	}
+
+	apiKey, err := auth.CreateAPIKey(userID, "test-key")
+	if err != nil {
+		t.Fatal("Error al crear API key:", err)
+	}
+
+	return mux, apiKey
+}
+
+// callTool ejecuta una herramienta a través de /api/tool y devuelve la respuesta decodificada
+func callTool(t *testing.T, mux *http.ServeMux, apiKey, tool string, payload map[string]interface{}) (int, map[string]interface{}) {
+	body, err := json.Marshal(map[string]interface{}{
+		"tool":    tool,
+		"payload": payload,
+	})
+	assert.NoError(t, err, "Error al serializar el payload")
+
+	req := httptest.NewRequest("POST", "/api/tool", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response), "Error decodificando respuesta")
+	return rr.Code, response
+}
+
+// buildZip genera un archivo ZIP en memoria con los archivos indicados
+func buildZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWebFetchDOCX(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	docx := buildZip(t, map[string]string{
+		"word/document.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+	<w:body>
+		<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Informe anual</w:t></w:r></w:p>
+		<w:p><w:r><w:t>Primer párrafo.</w:t></w:r></w:p>
+		<w:tbl>
+			<w:tr><w:tc><w:p><w:r><w:t>Mes</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Ventas</w:t></w:r></w:p></w:tc></w:tr>
+			<w:tr><w:tc><w:p><w:r><w:t>Enero</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>100</w:t></w:r></w:p></w:tc></w:tr>
+		</w:tbl>
+	</w:body>
+</w:document>`,
+		"docProps/app.xml": `<Properties><Pages>3</Pages></Properties>`,
+	})
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+		w.Write(docx)
+	}))
+	defer testServer.Close()
+
+	code, response := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url":    testServer.URL + "/informe.docx",
+		"format": "markdown",
+	})
+
+	assert.Equal(t, http.StatusOK, code, "Código de estado incorrecto")
+	output, _ := response["output"].(string)
+	assert.Contains(t, output, "# Informe anual")
+	assert.Contains(t, output, "Primer párrafo.")
+	assert.Contains(t, output, "| Mes | Ventas |")
+	assert.Contains(t, output, "| Enero | 100 |")
+
+	metadata, _ := response["metadata"].(map[string]interface{})
+	assert.Equal(t, "docx", metadata["document_type"])
+	assert.Equal(t, float64(3), metadata["pages"])
+}
+
+func TestWebFetchXLSX(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	xlsx := buildZip(t, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+	<sheets><sheet name="Precios" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":       `<sst><si><t>Producto</t></si><si><t>Precio</t></si><si><t>Café</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>
+	<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+	<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2"><v>3.5</v></c></row>
+</sheetData></worksheet>`,
+	})
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Content-Type genérico: el tipo se detecta por la extensión
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(xlsx)
+	}))
+	defer testServer.Close()
+
+	code, response := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url":    testServer.URL + "/precios.xlsx",
+		"format": "markdown",
+	})
+
+	assert.Equal(t, http.StatusOK, code, "Código de estado incorrecto")
+	output, _ := response["output"].(string)
+	assert.Contains(t, output, "## Precios")
+	assert.Contains(t, output, "| Producto | Precio |")
+	assert.Contains(t, output, "| Café | 3.5 |")
+
+	metadata, _ := response["metadata"].(map[string]interface{})
+	assert.Equal(t, "xlsx", metadata["document_type"])
+	assert.Equal(t, float64(1), metadata["sheets"])
+}
+
+// xlsxWithSheet genera un libro de Excel con una sola hoja
+func xlsxWithSheet(t *testing.T, sheetData string) []byte {
+	return buildZip(t, map[string]string{
+		"xl/workbook.xml":            `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Hoja" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml":   `<worksheet><sheetData>` + sheetData + `</sheetData></worksheet>`,
+	})
+}
+
+// columnName convierte un índice de columna (0 para A) en su nombre
+func columnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+func TestXLSXSparseColumns(t *testing.T) {
+	// Cada fila tiene un valor en A y otro en la última columna (XFD): solo se
+	// generan las columnas usadas
+	var rows strings.Builder
+	for i := 1; i <= 2000; i++ {
+		fmt.Fprintf(&rows, `<row r="%d"><c r="A%d"><v>%d</v></c><c r="XFD%d"><v>fin</v></c></row>`, i, i, i, i)
+	}
+	doc, err := tools.ExtractDocument(tools.DocumentXLSX, xlsxWithSheet(t, rows.String()))
+	assert.NoError(t, err)
+	assert.Contains(t, doc.Markdown, "| 1 | fin |")
+	assert.Contains(t, doc.Markdown, "| 2000 | fin |")
+	assert.Less(t, len(doc.Markdown), 100000)
+	assert.Nil(t, doc.Metadata["truncated_sheets"])
+
+	// Valores en diagonal: filas × columnas crece cuadráticamente y la hoja se corta
+	rows.Reset()
+	for i := 0; i < 1500; i++ {
+		ref := fmt.Sprintf("%s%d", columnName(i), i+1)
+		fmt.Fprintf(&rows, `<row r="%d"><c r="%s"><v>%d</v></c></row>`, i+1, ref, i)
+	}
+	doc, err = tools.ExtractDocument(tools.DocumentXLSX, xlsxWithSheet(t, rows.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Hoja"}, doc.Metadata["truncated_sheets"])
+	assert.Less(t, len(doc.Text), 4000000)
+}
+
+func TestWebFetchDocumentFixtures(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	testServer := httptest.NewServer(http.FileServer(http.Dir("testdata/documents")))
+	defer testServer.Close()
+
+	tests := []struct {
+		file     string
+		markdown []string
+		metadata map[string]interface{}
+	}{
+		{
+			file:     "informe.pdf",
+			markdown: []string{"Informe trimestral de ventas", "Segunda pagina con conclusiones"},
+			metadata: map[string]interface{}{"document_type": "pdf", "pages": float64(2), "title": "Informe de ventas", "author": "Equipo Toolbox"},
+		},
+		{
+			// Las diapositivas siguen el orden de presentation.xml, no el de los archivos
+			file:     "presentacion.pptx",
+			markdown: []string{"## Diapositiva 1\n\nPortada de la presentación", "## Diapositiva 2\n\nResultados", "| Región | Total |", "| Norte | 42 |"},
+			metadata: map[string]interface{}{"document_type": "pptx", "slides": float64(2)},
+		},
+		{
+			// Los capítulos siguen el orden del spine
+			file:     "libro.epub",
+			markdown: []string{"# Capítulo uno\n\nHabía una vez un _faro_.\n\n# Capítulo dos"},
+			metadata: map[string]interface{}{"document_type": "epub", "chapters": float64(2), "title": "Cuentos breves", "author": "Ana Autora", "language": "es"},
+		},
+		{
+			file:     "documento.odt",
+			markdown: []string{"# Acta de la reunión", "Asistentes:  cinco.", "- Aprobar el presupuesto", "| Tarea | Responsable |", "| Informe | Luis |"},
+			metadata: map[string]interface{}{"document_type": "odt", "pages": float64(2), "title": "Acta", "author": "Marta"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			code, response := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+				"url":    testServer.URL + "/" + tt.file,
+				"format": "markdown",
+			})
+			assert.Equal(t, http.StatusOK, code)
+
+			output, _ := response["output"].(string)
+			for _, expected := range tt.markdown {
+				assert.Contains(t, output, expected)
+			}
+			metadata, _ := response["metadata"].(map[string]interface{})
+			for key, expected := range tt.metadata {
+				assert.Equal(t, expected, metadata[key], key)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedTool(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>Blog</title>
+				<link rel="alternate" type="application/atom+xml" title="Atom" href="/atom.xml">
+				</head><body>Blog</body></html>`))
+		case "/rss.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+<channel><title>RSS de prueba</title><link>/</link>
+<item><title>Nuevo</title><link>/posts/nuevo</link><pubDate>Mon, 10 Jun 2024 08:00:00 GMT</pubDate>
+  <dc:creator>Ana</dc:creator><description>Resumen</description><content:encoded><![CDATA[<p>Completo</p>]]></content:encoded>
+  <enclosure url="/audio.mp3" type="audio/mpeg" length="1234"/></item>
+<item><title>Viejo</title><link>/posts/viejo</link><pubDate>Tue, 2 Jan 2018 10:00:00 +0000</pubDate></item>
+</channel></rss>`))
+		case "/atom.xml":
+			w.Header().Set("Content-Type", "application/atom+xml")
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Atom de prueba</title><author><name>Equipo</name></author>
+<entry><id>urn:1</id><title>Entrada</title><link href="/posts/entrada"/><updated>2024-05-01T10:00:00Z</updated>
+  <summary>Breve</summary></entry>
+</feed>`))
+		case "/feed.json":
+			w.Header().Set("Content-Type", "application/feed+json")
+			w.Write([]byte(`{"version":"https://jsonfeed.org/version/1.1","title":"JSON de prueba",
+				"items":[{"id":"1","url":"/posts/json","title":"JSON","content_text":"Texto","date_published":"2024-04-01T00:00:00Z","authors":[{"name":"Luis"}]}]}`))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><h1>Artículo</h1><p>Cuerpo completo</p></body></html>`))
+		}
+	}))
+	defer testServer.Close()
+
+	// RSS 2.0 con filtro since y contenido completo
+	code, response := callTool(t, mux, apiKey, "feed", map[string]interface{}{
+		"url":          testServer.URL + "/rss.xml",
+		"since":        "2024-01-01",
+		"full_content": true,
+	})
+	assert.Equal(t, http.StatusOK, code)
+	feed := response["feed"].(map[string]interface{})
+	assert.Equal(t, "rss", feed["type"])
+	items := feed["items"].([]interface{})
+	if assert.Len(t, items, 1) {
+		item := items[0].(map[string]interface{})
+		assert.Equal(t, "Nuevo", item["title"])
+		assert.Equal(t, testServer.URL+"/posts/nuevo", item["link"])
+		assert.Equal(t, "2024-06-10T08:00:00Z", item["published"])
+		assert.Equal(t, "Ana", item["author"])
+		assert.Equal(t, "<p>Completo</p>", item["content"])
+		assert.Len(t, item["enclosures"], 1)
+		assert.Contains(t, item["full_content"], "Cuerpo completo")
+	}
+
+	// JSON Feed
+	code, response = callTool(t, mux, apiKey, "feed", map[string]interface{}{
+		"url": testServer.URL + "/feed.json",
+	})
+	assert.Equal(t, http.StatusOK, code)
+	feed = response["feed"].(map[string]interface{})
+	assert.Equal(t, "json", feed["type"])
+	item := feed["items"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Luis", item["author"])
+	assert.Equal(t, "Texto", item["content"])
+
+	// webfetch anuncia los feeds de la página y su URL sirve directamente para feed
+	code, response = callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url": testServer.URL + "/",
+	})
+	assert.Equal(t, http.StatusOK, code)
+	feeds := response["metadata"].(map[string]interface{})["feeds"].([]interface{})
+	feedURL := feeds[0].(map[string]interface{})["url"].(string)
+	assert.Equal(t, testServer.URL+"/atom.xml", feedURL)
+
+	code, response = callTool(t, mux, apiKey, "feed", map[string]interface{}{"url": feedURL})
+	assert.Equal(t, http.StatusOK, code)
+	feed = response["feed"].(map[string]interface{})
+	assert.Equal(t, "atom", feed["type"])
+	item = feed["items"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Equipo", item["author"])
+	assert.Equal(t, "2024-05-01T10:00:00Z", item["updated"])
+
+	// Una página HTML sin feeds anunciados
+	code, response = callTool(t, mux, apiKey, "feed", map[string]interface{}{
+		"url": testServer.URL + "/posts/otro",
+	})
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "feed_not_found", response["code"])
+}
+
+func TestFeedRespectRobotsRedirects(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	privateHits := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /privado/\n"))
+		case "/feed.xml":
+			http.Redirect(w, r, "/privado/feed.xml", http.StatusFound)
+		case "/privado/feed.xml":
+			privateHits++
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<rss version="2.0"><channel><title>Privado</title></channel></rss>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer testServer.Close()
+
+	// La redirección hacia una ruta prohibida por robots.txt no se sigue
+	code, response := callTool(t, mux, apiKey, "feed", map[string]interface{}{
+		"url":            testServer.URL + "/feed.xml",
+		"respect_robots": true,
+	})
+	assert.NotEqual(t, http.StatusOK, code)
+	assert.Contains(t, response["error"], "robots.txt")
+	assert.Equal(t, 0, privateHits)
+
+	// Sin respect_robots se sigue la redirección
+	code, _ = callTool(t, mux, apiKey, "feed", map[string]interface{}{
+		"url": testServer.URL + "/feed.xml",
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, privateHits)
+}
+
+func TestFeedDiscoverySkipsInvalidCandidates(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			// Página de WordPress: la API REST se anuncia antes que el feed
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head>
+				<link rel="alternate" type="application/json" href="/wp-json/wp/v2/pages/2">
+				<link rel="alternate" type="application/rss+xml" href="/roto.xml">
+				<link rel="alternate" type="application/rss+xml" href="/feed/">
+				</head><body>Blog</body></html>`))
+		case "/wp-json/wp/v2/pages/2":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":2,"title":{"rendered":"Inicio"}}`))
+		case "/roto.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<html><body>No es un feed</body></html>`))
+		case "/feed/":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<rss version="2.0"><channel><title>Blog</title>
+<item><title>Hola</title><link>/hola</link></item></channel></rss>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer testServer.Close()
+
+	code, response := callTool(t, mux, apiKey, "feed", map[string]interface{}{
+		"url": testServer.URL + "/",
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, testServer.URL+"/feed/", response["feed_url"])
+	feed := response["feed"].(map[string]interface{})
+	assert.Equal(t, "rss", feed["type"])
+	assert.Len(t, feed["items"], 1)
+
+	// webfetch tampoco anuncia la API REST como feed
+	code, response = callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url": testServer.URL + "/",
+	})
+	assert.Equal(t, http.StatusOK, code)
+	feeds := response["metadata"].(map[string]interface{})["feeds"].([]interface{})
+	assert.Len(t, feeds, 2)
+}
@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"toolbox/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitorDetectsChanges(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	var mu sync.Mutex
+	price := "10 €"
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><nav>Menú</nav><div id="precio">Precio: ` + price + `</div></body></html>`))
+	}))
+	defer page.Close()
+
+	webhooks := make(chan map[string]interface{}, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&event)
+		webhooks <- event
+	}))
+	defer hook.Close()
+
+	call := func(method, path string, body interface{}) (int, map[string]interface{}) {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		var response map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response
+	}
+
+	code, response := call("POST", "/api/monitors", map[string]interface{}{
+		"url":         page.URL,
+		"selector":    "#precio",
+		"webhook_url": hook.URL,
+	})
+	assert.Equal(t, http.StatusCreated, code)
+	monitorID := response["monitor"].(map[string]interface{})["id"].(string)
+
+	// La primera comprobación guarda la referencia
+	code, response = call("POST", "/api/monitors/"+monitorID+"/check", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, response["check"].(map[string]interface{})["baseline"])
+
+	// Sin cambios en el selector no hay diff
+	code, response = call("POST", "/api/monitors/"+monitorID+"/check", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, false, response["check"].(map[string]interface{})["changed"])
+
+	mu.Lock()
+	price = "12 €"
+	mu.Unlock()
+
+	code, response = call("POST", "/api/monitors/"+monitorID+"/check", nil)
+	assert.Equal(t, http.StatusOK, code)
+	check := response["check"].(map[string]interface{})
+	assert.Equal(t, true, check["changed"])
+	assert.Equal(t, true, check["notified"])
+	assert.Contains(t, check["diff"], "+Precio: 12 €")
+
+	event := <-webhooks
+	assert.Equal(t, "monitor.changed", event["event"])
+	assert.Equal(t, monitorID, event["monitor_id"])
+
+	// El detalle incluye las instantáneas con su diff
+	code, response = call("GET", "/api/monitors/"+monitorID, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response["snapshots"], 2)
+
+	// Validaciones al crear
+	code, response = call("POST", "/api/monitors", map[string]interface{}{
+		"url":              page.URL,
+		"interval_minutes": 1,
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_interval", response["code"])
+}
+
+func TestMonitorChecksConsumeQuota(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><p>Hola</p></body></html>`))
+	}))
+	defer page.Close()
+
+	// Cada comprobación cuenta como una llamada a webfetch
+	_, err := auth.DB.Exec(`UPDATE plans SET tool_quotas = '{"webfetch": 1}' WHERE id = 'free'`)
+	assert.NoError(t, err)
+
+	call := func(method, path string, body interface{}) (int, map[string]interface{}) {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		var response map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response
+	}
+
+	code, response := call("POST", "/api/monitors", map[string]interface{}{"url": page.URL})
+	assert.Equal(t, http.StatusCreated, code)
+	monitorID := response["monitor"].(map[string]interface{})["id"].(string)
+
+	code, _ = call("POST", "/api/monitors/"+monitorID+"/check", nil)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, response = call("POST", "/api/monitors/"+monitorID+"/check", nil)
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.Equal(t, "quota_exceeded", response["code"])
+
+	var calls int
+	assert.NoError(t, auth.DB.QueryRow("SELECT calls FROM quota_usage WHERE tool = 'webfetch'").Scan(&calls))
+	assert.Equal(t, 1, calls)
+}
+
+func TestMonitorRequestOptions(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	// La página muestra el encabezado recibido
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><p>Token: ` + r.Header.Get("X-Token") + `</p></body></html>`))
+	}))
+	defer page.Close()
+
+	call := func(method, path string, body interface{}) (int, map[string]interface{}) {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		var response map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response
+	}
+
+	code, response := call("POST", "/api/monitors", map[string]interface{}{
+		"url":     page.URL,
+		"headers": map[string]string{"X-Token": "secreto"},
+	})
+	assert.Equal(t, http.StatusCreated, code)
+	monitorID := response["monitor"].(map[string]interface{})["id"].(string)
+
+	code, _ = call("POST", "/api/monitors/"+monitorID+"/check", nil)
+	assert.Equal(t, http.StatusOK, code)
+
+	var content string
+	assert.NoError(t, auth.DB.QueryRow("SELECT content FROM monitor_snapshots WHERE monitor_id = ?", monitorID).Scan(&content))
+	assert.Contains(t, content, "Token: secreto")
+
+	// Las opciones se validan como en webfetch
+	code, response = call("POST", "/api/monitors", map[string]interface{}{
+		"url":     page.URL,
+		"headers": map[string]string{"Host": "otro"},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "forbidden_header", response["code"])
+
+	// El plan limita el timeout
+	code, response = call("POST", "/api/monitors", map[string]interface{}{
+		"url":     page.URL,
+		"timeout": 60,
+	})
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "plan_limit_exceeded", response["code"])
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"toolbox/auth"
+	"toolbox/tools"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanQuotas(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	// Plan gratuito con una cuota de 2 llamadas a webfetch
+	_, err := auth.DB.Exec(`UPDATE plans SET tool_quotas = '{"webfetch": 2}' WHERE id = 'free'`)
+	assert.NoError(t, err)
+
+	for i, remaining := range []string{"1", "0"} {
+		rr := toolRequest(mux, apiKey, "webfetch")
+		assert.NotEqual(t, http.StatusTooManyRequests, rr.Code, "llamada %d", i)
+		assert.Equal(t, "2", rr.Header().Get("X-Quota-Limit"))
+		assert.Equal(t, remaining, rr.Header().Get("X-Quota-Remaining"))
+		assert.NotEmpty(t, rr.Header().Get("X-Quota-Reset"))
+	}
+
+	rr := toolRequest(mux, apiKey, "webfetch")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	var response map[string]interface{}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, "quota_exceeded", response["code"])
+
+	// Otras herramientas solo cuentan contra la cuota mensual total
+	rr = toolRequest(mux, apiKey, "sitemap")
+	assert.NotEqual(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1000", rr.Header().Get("X-Quota-Limit"))
+	assert.Equal(t, "997", rr.Header().Get("X-Quota-Remaining"))
+
+	// Consumo del periodo en /api/plan
+	req := httptest.NewRequest("GET", "/api/plan", nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	planRR := httptest.NewRecorder()
+	mux.ServeHTTP(planRR, req)
+	assert.Equal(t, http.StatusOK, planRR.Code)
+	assert.NoError(t, json.NewDecoder(planRR.Body).Decode(&response))
+	assert.Equal(t, "free", response["plan"].(map[string]interface{})["id"])
+	assert.Equal(t, float64(3), response["calls"])
+
+	// Al terminar el periodo la cuota se reinicia
+	_, err = auth.DB.Exec("UPDATE users SET quota_period_end = datetime('now', '-1 minute')")
+	assert.NoError(t, err)
+	rr = toolRequest(mux, apiKey, "webfetch")
+	assert.NotEqual(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("X-Quota-Remaining"))
+
+	// Un plan superior tiene sus propios límites
+	_, err = auth.DB.Exec("UPDATE users SET plan = 'team'")
+	assert.NoError(t, err)
+	rr = toolRequest(mux, apiKey, "webfetch")
+	assert.Equal(t, "250000", rr.Header().Get("X-Quota-Limit"))
+}
+
+func TestPlanOptionLimits(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	tests := []struct {
+		name    string
+		tool    string
+		payload map[string]interface{}
+	}{
+		{"timeout", "webfetch", map[string]interface{}{"url": "http://example.com", "timeout": 60}},
+		{"página completa", "screenshot", map[string]interface{}{"url": "http://example.com", "full_page": true}},
+		{"páginas de rastreo", "crawl", map[string]interface{}{"url": "http://example.com", "max_pages": 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := callTool(t, mux, apiKey, tt.tool, tt.payload)
+			assert.Equal(t, http.StatusForbidden, code)
+			assert.Equal(t, "plan_limit_exceeded", response["code"])
+		})
+	}
+
+	// Las opciones rechazadas no consumen cuota
+	var calls int
+	assert.NoError(t, auth.DB.QueryRow("SELECT COALESCE(SUM(calls), 0) FROM quota_usage").Scan(&calls))
+	assert.Equal(t, 0, calls)
+}
+
+func TestPlanQuotaConcurrent(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	_, err := auth.DB.Exec(`UPDATE plans SET tool_quotas = '{"webfetch": 5}', max_concurrency = 0 WHERE id = 'free'`)
+	assert.NoError(t, err)
+
+	// Las peticiones simultáneas no pueden sobrepasar la cuota
+	var wg sync.WaitGroup
+	var admitted int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if toolRequest(mux, apiKey, "webfetch").Code != http.StatusTooManyRequests {
+				atomic.AddInt32(&admitted, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(5), admitted)
+
+	var calls int
+	assert.NoError(t, auth.DB.QueryRow("SELECT calls FROM quota_usage WHERE tool = 'webfetch'").Scan(&calls))
+	assert.Equal(t, 5, calls)
+}
+
+func TestUnknownToolConsumesNothing(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	rr := toolRequest(mux, apiKey, "inventada")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Empty(t, rr.Header().Get("RateLimit-Remaining"))
+	assert.Empty(t, rr.Header().Get("X-Quota-Remaining"))
+
+	var calls int
+	assert.NoError(t, auth.DB.QueryRow("SELECT COUNT(*) FROM quota_usage").Scan(&calls))
+	assert.Equal(t, 0, calls)
+}
+
+func TestScreenshotFullPageDefault(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	var captured []bool
+	previous := tools.CaptureScreenshot
+	tools.CaptureScreenshot = func(_ string, _ int, fullPage bool) ([]byte, error) {
+		captured = append(captured, fullPage)
+		return []byte("imagen"), nil
+	}
+	defer func() { tools.CaptureScreenshot = previous }()
+
+	screenshot := func(payload string) int {
+		req := httptest.NewRequest("POST", "/api/tool", strings.NewReader(`{"tool": "screenshot", "payload": `+payload+`}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// El plan Free no permite la página completa: por defecto se captura el viewport
+	assert.Equal(t, http.StatusOK, screenshot(`{"url": "http://example.com"}`))
+
+	// En los planes que la permiten se mantiene la página completa por defecto
+	_, err := auth.DB.Exec("UPDATE users SET plan = 'pro'")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, screenshot(`{"url": "http://example.com"}`))
+	assert.Equal(t, http.StatusOK, screenshot(`{"url": "http://example.com", "full_page": false}`))
+
+	assert.Equal(t, []bool{false, true, false}, captured)
+}
+
+func TestPlanConcurrencyCountsJobs(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	_, err := auth.DB.Exec(`UPDATE plans SET max_concurrency = 1 WHERE id = 'free'`)
+	assert.NoError(t, err)
+
+	// El servidor retiene el rastreo hasta que se cierra unblock
+	unblock := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		<-unblock
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><p>Hola</p></body></html>`))
+	}))
+	defer testServer.Close()
+
+	code, response := callTool(t, mux, apiKey, "crawl", map[string]interface{}{
+		"url":       testServer.URL + "/",
+		"max_depth": 0,
+	})
+	assert.Equal(t, http.StatusAccepted, code)
+	jobID, _ := response["job_id"].(string)
+
+	// El trabajo en curso ocupa el único hueco del plan
+	rr := toolRequest(mux, apiKey, "webfetch")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Contains(t, rr.Body.String(), "concurrency_limit_exceeded")
+
+	close(unblock)
+	job := waitForJob(t, mux, apiKey, jobID)
+	assert.Equal(t, "completed", job["status"])
+
+	rr = toolRequest(mux, apiKey, "webfetch")
+	assert.NotEqual(t, http.StatusTooManyRequests, rr.Code)
+}
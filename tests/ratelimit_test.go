@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"toolbox/api"
+	"toolbox/auth"
+	"toolbox/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// toolRequest envía una llamada a /api/tool y devuelve la respuesta sin decodificar
+func toolRequest(mux *http.ServeMux, apiKey, tool string) *httptest.ResponseRecorder {
+	body := `{"tool": "` + tool + `", "payload": {"url": "no-es-una-url"}}`
+	req := httptest.NewRequest("POST", "/api/tool", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func testToolRateLimit(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	for i := 0; i < 3; i++ {
+		rr := toolRequest(mux, apiKey, "webfetch")
+		assert.NotEqual(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "3", rr.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, strconv.Itoa(2-i), rr.Header().Get("RateLimit-Remaining"))
+	}
+
+	rr := toolRequest(mux, apiKey, "webfetch")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+
+	var response map[string]interface{}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, "rate_limited", response["code"])
+	assert.Greater(t, response["retry_after"], float64(0))
+}
+
+func TestToolRateLimit(t *testing.T) {
+	t.Setenv("RATE_LIMIT_KEY_PER_MINUTE", "3")
+
+	t.Run("memory", testToolRateLimit)
+	t.Run("sqlite", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_BACKEND", "sqlite")
+		testToolRateLimit(t)
+	})
+}
+
+func TestToolRateLimitCosts(t *testing.T) {
+	t.Setenv("RATE_LIMIT_KEY_PER_MINUTE", "6")
+	mux, apiKey := setupTestAPI(t)
+
+	// screenshot cuesta 5 fichas: la segunda llamada ya no cabe
+	rr := toolRequest(mux, apiKey, "screenshot")
+	assert.NotEqual(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+
+	rr = toolRequest(mux, apiKey, "screenshot")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+
+	// Una herramienta de coste 1 todavía cabe
+	rr = toolRequest(mux, apiKey, "webfetch")
+	assert.NotEqual(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+}
+
+func TestMagicLinkRateLimit(t *testing.T) {
+	t.Setenv("ENV", "development")
+	t.Setenv("RATE_LIMIT_MAGIC_LINK_PER_HOUR", "2")
+	mux, _ := setupTestAPI(t)
+
+	request := func(email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/auth/request-magic-link", strings.NewReader(`{"email": "`+email+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusOK, request("uno@example.com").Code)
+	assert.Equal(t, http.StatusOK, request("uno@example.com").Code)
+
+	rr := request("uno@example.com")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+
+	// El límite por IP también se aplica a otros correos
+	assert.Equal(t, http.StatusTooManyRequests, request("dos@example.com").Code)
+}
+
+func TestSQLiteRateLimitConcurrency(t *testing.T) {
+	t.Setenv("RATE_LIMIT_BACKEND", "sqlite")
+	t.Setenv("RATE_LIMIT_KEY_PER_MINUTE", "20")
+	t.Setenv("RATE_LIMIT_USER_PER_MINUTE", "0")
+	t.Setenv("RATE_LIMIT_IP_PER_MINUTE", "0")
+
+	// Base de datos en archivo con WAL, como en producción
+	fileDB, err := database.Init(filepath.Join(t.TempDir(), "toolbox.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fileDB.Close() })
+	if err := database.RunMigrations(fileDB); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	api.SetupRoutes(mux, fileDB)
+	userID, err := getUserIDByEmail(fileDB, "test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey, err := auth.CreateAPIKey(userID, "test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Las peticiones simultáneas no pueden saltarse el límite
+	var wg sync.WaitGroup
+	codes := make([]int, 40)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = toolRequest(mux, apiKey, "webfetch").Code
+		}(i)
+	}
+	wg.Wait()
+
+	limited := 0
+	for _, code := range codes {
+		assert.NotEqual(t, http.StatusServiceUnavailable, code)
+		if code == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	assert.Equal(t, 20, limited)
+
+	// Si el limitador falla, la petición se rechaza en lugar de pasar sin límite
+	_, err = fileDB.Exec("DROP TABLE rate_limits")
+	assert.NoError(t, err)
+	rr := toolRequest(mux, apiKey, "webfetch")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "rate_limiter_unavailable")
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebFetchRedirectChain(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><head><title>Destino</title></head><body>ok</body></html>"))
+		}
+	}))
+	defer testServer.Close()
+
+	// Seguir redirecciones y reportar la cadena
+	code, response := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url": testServer.URL + "/a",
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	metadata, _ := response["metadata"].(map[string]interface{})
+	assert.Equal(t, testServer.URL+"/final", metadata["final_url"])
+	chain, _ := metadata["redirect_chain"].([]interface{})
+	if assert.Len(t, chain, 2) {
+		first := chain[0].(map[string]interface{})
+		assert.Equal(t, testServer.URL+"/a", first["url"])
+		assert.Equal(t, float64(http.StatusMovedPermanently), first["status_code"])
+		assert.Equal(t, "/b", first["location"])
+		second := chain[1].(map[string]interface{})
+		assert.Equal(t, float64(http.StatusFound), second["status_code"])
+		assert.Equal(t, "/final", second["location"])
+	}
+
+	// Sin seguir redirecciones se devuelve la respuesta 3xx
+	code, response = callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url":              testServer.URL + "/a",
+		"follow_redirects": false,
+	})
+	assert.Equal(t, http.StatusOK, code)
+	metadata, _ = response["metadata"].(map[string]interface{})
+	assert.Equal(t, float64(http.StatusMovedPermanently), metadata["status_code"])
+	assert.Equal(t, testServer.URL+"/a", metadata["final_url"])
+	chain, _ = metadata["redirect_chain"].([]interface{})
+	assert.Len(t, chain, 1)
+
+	// Límite de redirecciones
+	code, response = callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url":           testServer.URL + "/loop",
+		"max_redirects": 3,
+	})
+	assert.Equal(t, http.StatusBadGateway, code)
+	assert.Equal(t, "too_many_redirects", response["code"])
+}
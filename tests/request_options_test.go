@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebFetchRequestOptions(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	// Servidor que devuelve en JSON lo que recibió
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		session, _ := r.Cookie("session")
+		user, pass, _ := r.BasicAuth()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"method":       r.Method,
+			"body":         string(body),
+			"content_type": r.Header.Get("Content-Type"),
+			"custom":       r.Header.Get("X-Custom"),
+			"user_agent":   r.Header.Get("User-Agent"),
+			"cookie":       session.Value,
+			"user":         user,
+			"pass":         pass,
+		})
+	}))
+	defer testServer.Close()
+
+	code, response := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url":        testServer.URL,
+		"method":     "post",
+		"headers":    map[string]interface{}{"X-Custom": "valor"},
+		"body":       map[string]interface{}{"hola": "mundo"},
+		"cookies":    map[string]interface{}{"session": "abc123"},
+		"auth":       map[string]interface{}{"type": "basic", "username": "ana", "password": "secreta"},
+		"user_agent": "ToolboxBot/1.0",
+	})
+	assert.Equal(t, http.StatusOK, code, "Código de estado incorrecto")
+
+	var echoed map[string]string
+	output, _ := response["output"].(string)
+	assert.NoError(t, json.Unmarshal([]byte(output), &echoed))
+	assert.Equal(t, "POST", echoed["method"])
+	assert.Equal(t, `{"hola":"mundo"}`, echoed["body"])
+	assert.Equal(t, "application/json", echoed["content_type"])
+	assert.Equal(t, "valor", echoed["custom"])
+	assert.Equal(t, "ToolboxBot/1.0", echoed["user_agent"])
+	assert.Equal(t, "abc123", echoed["cookie"])
+	assert.Equal(t, "ana", echoed["user"])
+	assert.Equal(t, "secreta", echoed["pass"])
+
+	metadata, _ := response["metadata"].(map[string]interface{})
+	assert.Equal(t, "POST", metadata["method"])
+
+	// Los encabezados de la lista de denegación se rechazan
+	code, response = callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url":     testServer.URL,
+		"headers": map[string]interface{}{"X-Forwarded-For": "10.0.0.1"},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "forbidden_header", response["code"])
+
+	// GET no admite cuerpo
+	code, response = callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url":  testServer.URL,
+		"body": "texto",
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_body", response["code"])
+}
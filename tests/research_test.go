@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"toolbox/tools"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResearchTool(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	long := strings.Repeat("Texto de relleno sobre el tema investigado. ", 400)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/search":
+			// Resultados: uno envuelto en la redirección de DuckDuckGo, un duplicado con
+			// parámetros de seguimiento y otro que declara como canónica la primera página
+			links := []string{
+				"//duckduckgo.com/l/?uddg=" + url.QueryEscape(server.URL+"/a"),
+				server.URL + "/a/?utm_source=ddg#intro",
+				server.URL + "/b",
+				server.URL + "/c",
+			}
+			var html strings.Builder
+			html.WriteString("<html><body>")
+			for i, link := range links {
+				fmt.Fprintf(&html, `<div class="result"><h2 class="result__title"><a href="%s">Resultado %d</a></h2><a class="result__snippet">Resumen %d</a></div>`, link, i, i)
+			}
+			html.WriteString("</body></html>")
+			w.Write([]byte(html.String()))
+		case "/a":
+			w.Write([]byte(`<html><head><title>Página A</title></head><body><nav>Menú</nav><article><h1>Artículo A</h1><p>` + long + `</p></article><footer>Pie</footer></body></html>`))
+		case "/b":
+			w.Write([]byte(`<html><head><title>Página B</title></head><body><main><p>Contenido breve de B.</p></main></body></html>`))
+		case "/c":
+			w.Write([]byte(`<html><head><title>Copia</title><link rel="canonical" href="/a"></head><body><p>Copia de A.</p></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	previous := tools.DuckDuckGoHTMLURL
+	tools.DuckDuckGoHTMLURL = server.URL + "/search"
+	defer func() { tools.DuckDuckGoHTMLURL = previous }()
+
+	code, response := callTool(t, mux, apiKey, "research", map[string]interface{}{
+		"query":        "tema",
+		"token_budget": 1000,
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	metadata := response["metadata"].(map[string]interface{})
+	assert.Equal(t, float64(2), metadata["duplicates"])
+	assert.LessOrEqual(t, metadata["tokens"], float64(1000))
+
+	sources := response["sources"].([]interface{})
+	if assert.Len(t, sources, 2) {
+		a := sources[0].(map[string]interface{})
+		assert.Equal(t, float64(1), a["citation"])
+		assert.Equal(t, server.URL+"/a", a["url"])
+		assert.Equal(t, true, a["truncated"])
+		assert.Contains(t, a["content"], "Artículo A")
+		assert.NotContains(t, a["content"], "Menú")
+
+		b := sources[1].(map[string]interface{})
+		assert.Equal(t, false, b["truncated"])
+		assert.Contains(t, b["content"], "Contenido breve de B.")
+	}
+
+	// El presupuesto incluye encabezados y la lista de fuentes
+	output := response["output"].(string)
+	assert.Equal(t, float64(tools.EstimateTokens(output)), metadata["tokens"])
+	assert.Contains(t, output, "## [1] Resultado 0")
+	assert.Contains(t, output, "[2] Resultado 2 - "+server.URL+"/b")
+
+	code, response = callTool(t, mux, apiKey, "research", map[string]interface{}{"query": "tema", "max_results": 50})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_research_options", response["code"])
+}
+
+func TestResearchBackfillsDuplicates(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/search":
+			// /copia redirige a /a, así que solo se descubre el duplicado al descargarla
+			var html strings.Builder
+			html.WriteString("<html><body>")
+			for i, path := range []string{"/a", "/copia", "/b"} {
+				fmt.Fprintf(&html, `<div class="result"><h2 class="result__title"><a href="%s">Resultado %d</a></h2><a class="result__snippet">Resumen %d</a></div>`, server.URL+path, i, i)
+			}
+			html.WriteString("</body></html>")
+			w.Write([]byte(html.String()))
+		case "/copia":
+			http.Redirect(w, r, "/a", http.StatusFound)
+		case "/a", "/b":
+			w.Write([]byte(`<html><body><main><p>Contenido de ` + r.URL.Path + `.</p></main></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	previous := tools.DuckDuckGoHTMLURL
+	tools.DuckDuckGoHTMLURL = server.URL + "/search"
+	defer func() { tools.DuckDuckGoHTMLURL = previous }()
+
+	code, response := callTool(t, mux, apiKey, "research", map[string]interface{}{
+		"query":       "tema",
+		"max_results": 2,
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), response["metadata"].(map[string]interface{})["duplicates"])
+
+	// El hueco del duplicado se rellena con el siguiente resultado
+	sources := response["sources"].([]interface{})
+	if assert.Len(t, sources, 2) {
+		assert.Equal(t, server.URL+"/a", sources[0].(map[string]interface{})["url"])
+		assert.Equal(t, server.URL+"/b", sources[1].(map[string]interface{})["url"])
+	}
+}
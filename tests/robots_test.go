@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"toolbox/auth"
+	"toolbox/tools"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebFetchRespectRobots(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /privado\nAllow: /privado/publico\n"))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>ok</body></html>"))
+		}
+	}))
+	defer testServer.Close()
+
+	// Sin respect_robots no se consulta robots.txt
+	code, _ := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url": testServer.URL + "/privado/pagina",
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	// Con respect_robots la ruta prohibida se bloquea
+	code, response := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url":            testServer.URL + "/privado/pagina",
+		"respect_robots": true,
+	})
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "blocked_by_robots", response["code"])
+
+	// La regla Allow más específica gana
+	code, _ = callTool(t, mux, apiKey, "webfetch", map[string]interface{}{
+		"url":            testServer.URL + "/privado/publico/pagina",
+		"respect_robots": true,
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	// Una API key creada con respect_robots lo impone aunque el payload no lo pida
+	jwtToken, err := auth.GenerateJWT("test@example.com")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/keys", bytes.NewBufferString(`{"respect_robots": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var created struct {
+		Key           string `json:"key"`
+		RespectRobots bool   `json:"respect_robots"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	assert.True(t, created.RespectRobots)
+
+	code, response = callTool(t, mux, created.Key, "webfetch", map[string]interface{}{
+		"url": testServer.URL + "/privado/pagina",
+	})
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "blocked_by_robots", response["code"])
+}
+
+func TestRobotsGroupMatching(t *testing.T) {
+	const agent = "ToolboxBot/1.0 (+https://toolbox-api.fly.dev)"
+
+	tests := []struct {
+		name    string
+		robots  string
+		path    string
+		allowed bool
+	}{
+		{"un prefijo del token no coincide", "User-agent: Toolbox\nDisallow: /\n", "/", true},
+		{"sin distinguir mayúsculas", "User-agent: TOOLBOXBOT\nDisallow: /privado\n", "/privado", false},
+		{"versión en robots.txt", "User-agent: toolboxbot/2.0\nDisallow: /privado\n", "/privado", false},
+		{"user-agent vacío", "User-agent:\nDisallow: /\n\nUser-agent: *\nAllow: /\n", "/", true},
+		{"grupo comodín", "User-agent: otrobot\nAllow: /\n\nUser-agent: *\nDisallow: /\n", "/", false},
+		{"el grupo propio tiene prioridad", "User-agent: *\nDisallow: /\n\nUser-agent: toolboxbot\nAllow: /\n", "/", true},
+		{"grupos combinados (a)", "User-agent: toolboxbot\nDisallow: /a\n\nUser-agent: toolboxbot\nDisallow: /b\n", "/a", false},
+		{"grupos combinados (b)", "User-agent: toolboxbot\nDisallow: /a\n\nUser-agent: toolboxbot\nDisallow: /b\n", "/b", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, tools.ParseRobotsTxt(tt.robots).Allowed(agent, tt.path))
+		})
+	}
+}
+
+func TestRobotsFailureCaching(t *testing.T) {
+	var mu sync.Mutex
+	status, fetches := http.StatusServiceUnavailable, 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		w.WriteHeader(status)
+		w.Write([]byte("User-agent: *\nDisallow: /privado\n"))
+	}))
+	defer testServer.Close()
+
+	checker := tools.NewRobotsChecker("ToolboxBot/1.0")
+
+	// Un contexto cancelado por el llamante no deja el host bloqueado en la caché
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, checker.Check(ctx, testServer.URL+"/pagina"))
+	mu.Lock()
+	status = http.StatusOK
+	mu.Unlock()
+	assert.NoError(t, checker.Check(context.Background(), testServer.URL+"/pagina"))
+
+	// Un 5xx prohíbe el acceso y se guarda poco tiempo, sin repetir la descarga en cada petición
+	other := tools.NewRobotsChecker("ToolboxBot/1.0")
+	mu.Lock()
+	status, fetches = http.StatusServiceUnavailable, 0
+	mu.Unlock()
+	for i := 0; i < 3; i++ {
+		err := other.Check(context.Background(), testServer.URL+"/pagina")
+		if assert.Error(t, err) {
+			assert.Equal(t, "blocked_by_robots", err.(*tools.ToolError).Code)
+		}
+	}
+	mu.Lock()
+	assert.Equal(t, 1, fetches)
+	mu.Unlock()
+}
@@ -0,0 +1,308 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"toolbox/auth"
+	"toolbox/tools"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchProviderFallback(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ddg":
+			// DuckDuckGo no disponible
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/lite":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<table>
+				<tr><td><a rel="nofollow" href="https://lite.example/uno" class="result-link">Uno lite</a></td></tr>
+				<tr><td class="result-snippet">Fragmento uno</td></tr>
+			</table>`))
+		case "/searxng/search":
+			assert.Equal(t, "json", r.URL.Query().Get("format"))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"results": []map[string]string{
+					{"title": "Resultado SearXNG", "url": "https://searx.example/a", "content": "Contenido " + r.URL.Query().Get("q")},
+				},
+			})
+		}
+	}))
+	defer server.Close()
+
+	previousHTML, previousLite := tools.DuckDuckGoHTMLURL, tools.DuckDuckGoLiteURL
+	tools.DuckDuckGoHTMLURL, tools.DuckDuckGoLiteURL = server.URL+"/ddg", server.URL+"/ddg"
+	defer func() { tools.DuckDuckGoHTMLURL, tools.DuckDuckGoLiteURL = previousHTML, previousLite }()
+	t.Setenv("SEARXNG_URL", server.URL+"/searxng")
+	t.Setenv("SEARCH_PROVIDERS", "duckduckgo,duckduckgo_lite,searxng,brave")
+	t.Setenv("BRAVE_SEARCH_API_KEY", "")
+
+	// DuckDuckGo falla y se usa SearXNG como respaldo
+	code, response := callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "golang"})
+	assert.Equal(t, http.StatusOK, code)
+	metadata := response["metadata"].(map[string]interface{})
+	assert.Equal(t, "searxng", metadata["source"])
+	assert.Len(t, metadata["attempts"], 3)
+	results := metadata["results"].([]interface{})
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "https://searx.example/a", results[0].(map[string]interface{})["url"])
+	}
+
+	// Sin respaldo, el error del proveedor elegido se devuelve tal cual
+	code, response = callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "golang", "provider": "duckduckgo", "fallback": false})
+	assert.Equal(t, http.StatusBadGateway, code)
+	assert.Equal(t, "search_failed", response["code"])
+
+	code, response = callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "golang", "provider": "brave", "fallback": false})
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "provider_not_configured", response["code"])
+
+	code, response = callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "golang", "provider": "altavista"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_provider", response["code"])
+
+	// Una API key puede fijar su proveedor por defecto
+	tools.DuckDuckGoLiteURL = server.URL + "/lite"
+	jwtToken, err := auth.GenerateJWT("test@example.com")
+	assert.NoError(t, err)
+	req := httptest.NewRequest("POST", "/api/keys", bytes.NewBufferString(`{"search_provider": "duckduckgo_lite"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var created struct {
+		Key string `json:"key"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+
+	code, response = callTool(t, mux, created.Key, "search", map[string]interface{}{"query": "golang"})
+	assert.Equal(t, http.StatusOK, code)
+	metadata = response["metadata"].(map[string]interface{})
+	assert.Equal(t, "duckduckgo_lite", metadata["source"])
+	assert.Contains(t, response["output"], "[Uno lite](https://lite.example/uno)")
+}
+
+func TestDuckDuckGoSearchOptions(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	var lastQuery url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		lastQuery = r.Form
+		offset := r.Form.Get("s")
+		if offset == "" {
+			offset = "0"
+		}
+		// Dos resultados por página y un formulario "Next" con el estado de la paginación
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body>
+			<div class="result"><h2 class="result__title"><a href="https://example.com/%[1]s-a">Resultado %[1]s-a</a></h2></div>
+			<div class="result result--ad"><h2 class="result__title"><a href="https://ads.example/">Anuncio</a></h2></div>
+			<div class="result"><h2 class="result__title"><a href="https://example.com/%[1]s-b">Resultado %[1]s-b</a></h2></div>
+			<div class="nav-link"><form action="/html/" method="post">
+				<input type="submit" class="btn" value="Next">
+				<input type="hidden" name="q" value="%[2]s">
+				<input type="hidden" name="s" value="%[3]d">
+				<input type="hidden" name="kl" value="%[4]s">
+			</form></div>
+		</body></html>`, offset, r.Form.Get("q"), atoi(offset)+2, r.Form.Get("kl"))
+	}))
+	defer server.Close()
+
+	previous := tools.DuckDuckGoHTMLURL
+	tools.DuckDuckGoHTMLURL = server.URL + "/html/"
+	defer func() { tools.DuckDuckGoHTMLURL = previous }()
+
+	code, response := callTool(t, mux, apiKey, "search", map[string]interface{}{
+		"query":        "golang",
+		"provider":     "duckduckgo",
+		"max_results":  3,
+		"region":       "es-es",
+		"safe_search":  "strict",
+		"time_range":   "week",
+		"site":         "example.com",
+		"exclude_site": []interface{}{"ads.example"},
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	// max_results > resultados por página: se sigue el formulario "Next"
+	metadata := response["metadata"].(map[string]interface{})
+	var urls []string
+	for _, r := range metadata["results"].([]interface{}) {
+		urls = append(urls, r.(map[string]interface{})["url"].(string))
+	}
+	assert.Equal(t, []string{"https://example.com/0-a", "https://example.com/0-b", "https://example.com/2-a"}, urls)
+	assert.Equal(t, "2", lastQuery.Get("s"))
+	assert.Equal(t, "es-es", lastQuery.Get("kl"))
+
+	options := metadata["options"].(map[string]interface{})
+	assert.Equal(t, "golang site:example.com -site:ads.example", options["query"])
+	assert.Equal(t, "es-es", options["region"])
+	assert.Equal(t, "strict", options["safe_search"])
+	assert.Equal(t, "week", options["time_range"])
+
+	// Página 3: se avanza dos veces con el formulario
+	code, response = callTool(t, mux, apiKey, "search", map[string]interface{}{
+		"query":       "golang",
+		"provider":    "duckduckgo",
+		"max_results": 2,
+		"page":        3,
+	})
+	assert.Equal(t, http.StatusOK, code)
+	first := response["metadata"].(map[string]interface{})["results"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "https://example.com/4-a", first["url"])
+
+	// Con offset se pide directamente a DuckDuckGo
+	callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "golang", "provider": "duckduckgo", "max_results": 2, "offset": 30, "safe_search": "off", "time_range": "day"})
+	assert.Equal(t, "30", lastQuery.Get("s"))
+	assert.Equal(t, "-2", lastQuery.Get("kp"))
+	assert.Equal(t, "d", lastQuery.Get("df"))
+
+	code, response = callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "golang", "time_range": "decade"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_search_options", response["code"])
+
+	// page y offset tienen un máximo para no encadenar peticiones sin fin
+	for _, payload := range []map[string]interface{}{
+		{"query": "golang", "page": 11},
+		{"query": "golang", "offset": 201},
+		{"query": "golang", "page": 1e9},
+	} {
+		code, response = callTool(t, mux, apiKey, "search", payload)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "invalid_search_options", response["code"])
+	}
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func TestSearchVerticals(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<script>DDG.deep.initialize('/d.js?q=x&vqd="4-12345"');</script>`))
+		case "/news.js":
+			assert.Equal(t, "4-12345", q.Get("vqd"))
+			assert.Equal(t, "w", q.Get("df"))
+			json.NewEncoder(w).Encode(map[string]interface{}{"results": []map[string]interface{}{
+				{"title": "Noticia", "url": "https://news.example/1", "source": "Diario", "date": 1700000000, "excerpt": "Resumen", "image": "https://news.example/1.jpg"},
+			}})
+		case "/i.js":
+			json.NewEncoder(w).Encode(map[string]interface{}{"results": []map[string]interface{}{
+				{"title": "Gato", "image": "https://img.example/gato.jpg", "thumbnail": "https://tse.example/gato.jpg", "width": 800, "height": 600, "url": "https://img.example/pagina", "source": "Bing"},
+			}})
+		case "/searxng/search":
+			assert.Equal(t, "videos", q.Get("categories"))
+			json.NewEncoder(w).Encode(map[string]interface{}{"results": []map[string]interface{}{
+				{"title": "Vídeo", "url": "https://video.example/v", "content": "Descripción", "length": "3:21", "author": "Canal", "publishedDate": "2024-01-02T03:04:05", "thumbnail": "https://video.example/t.jpg"},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	previous := tools.DuckDuckGoURL
+	tools.DuckDuckGoURL = server.URL + "/"
+	defer func() { tools.DuckDuckGoURL = previous }()
+	t.Setenv("SEARXNG_URL", server.URL+"/searxng")
+
+	code, response := callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "elecciones", "provider": "duckduckgo", "search_type": "news", "time_range": "week"})
+	assert.Equal(t, http.StatusOK, code)
+	metadata := response["metadata"].(map[string]interface{})
+	assert.Equal(t, "news", metadata["search_type"])
+	news := metadata["results"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Diario", news["source"])
+	assert.Equal(t, "2023-11-14T22:13:20Z", news["published"])
+	assert.Equal(t, "https://news.example/1.jpg", news["thumbnail"])
+
+	code, response = callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "gatos", "provider": "duckduckgo", "search_type": "images"})
+	assert.Equal(t, http.StatusOK, code)
+	image := response["metadata"].(map[string]interface{})["results"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "https://img.example/gato.jpg", image["image_url"])
+	assert.Equal(t, "https://img.example/pagina", image["source_page"])
+	assert.Equal(t, float64(800), image["width"])
+	assert.Equal(t, float64(600), image["height"])
+	assert.Contains(t, response["output"], "800x600")
+
+	code, response = callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "tutorial", "provider": "searxng", "search_type": "videos"})
+	assert.Equal(t, http.StatusOK, code)
+	video := response["metadata"].(map[string]interface{})["results"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "3:21", video["duration"])
+	assert.Equal(t, "2024-01-02T03:04:05Z", video["published"])
+
+	// DuckDuckGo Lite no tiene verticales
+	code, response = callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "x", "provider": "duckduckgo_lite", "search_type": "news", "fallback": false})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "unsupported_search_type", response["code"])
+}
+
+func TestSearchResultDecoding(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Query().Get("q") {
+		case "golang":
+			w.Write([]byte(`<html><body>
+				<div class="result"><h2 class="result__title"><a href="//duckduckgo.com/l/?uddg=https%3A%2F%2Fwww.go.dev%2Fdoc%2F&amp;rut=abc">Go docs</a></h2></div>
+				<div class="result"><h2 class="result__title"><a href="//duckduckgo.com/l/?uddg=https%3A%2F%2Fgo.dev%2Fdoc%3Futm_source%3Dddg">Go docs (copia)</a></h2></div>
+				<div class="result"><h2 class="result__title"><a href="https://pkg.go.dev/">Paquetes</a></h2></div>
+			</body></html>`))
+		case "bloqueada":
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`<html><body><div class="anomaly-modal__title">Unfortunately, bots use DuckDuckGo too.</div>
+				<form id="challenge-form" action="//duckduckgo.com/anomaly.js"></form></body></html>`))
+		default:
+			w.Write([]byte(`<html><body><div class="no-results">No results.</div></body></html>`))
+		}
+	}))
+	defer server.Close()
+
+	previous := tools.DuckDuckGoHTMLURL
+	tools.DuckDuckGoHTMLURL = server.URL + "/html/"
+	defer func() { tools.DuckDuckGoHTMLURL = previous }()
+
+	code, response := callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "golang", "provider": "duckduckgo", "fallback": false})
+	assert.Equal(t, http.StatusOK, code)
+	metadata := response["metadata"].(map[string]interface{})
+	assert.Equal(t, float64(2), metadata["result_count"])
+	assert.Equal(t, float64(1), metadata["duplicates_removed"])
+	results := metadata["results"].([]interface{})
+	first := results[0].(map[string]interface{})
+	assert.Equal(t, "https://www.go.dev/doc/", first["url"])
+	assert.Equal(t, "go.dev", first["display_domain"])
+	assert.Equal(t, "https://external-content.duckduckgo.com/ip3/www.go.dev.ico", first["favicon"])
+	assert.Equal(t, "pkg.go.dev", results[1].(map[string]interface{})["display_domain"])
+
+	// Sin resultados: lista vacía explícita, sin elemento de relleno
+	code, response = callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "zzzz", "provider": "duckduckgo", "fallback": false})
+	assert.Equal(t, http.StatusOK, code)
+	metadata = response["metadata"].(map[string]interface{})
+	assert.Equal(t, float64(0), metadata["result_count"])
+	assert.Equal(t, []interface{}{}, metadata["results"])
+
+	// La verificación anti-bots se distingue de un fallo genérico
+	code, response = callTool(t, mux, apiKey, "search", map[string]interface{}{"query": "bloqueada", "provider": "duckduckgo", "fallback": false})
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "search_blocked", response["code"])
+}
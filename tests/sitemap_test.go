@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSitemapTool(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	var serverURL string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nAllow: /\nSitemap: " + serverURL + "/sitemap_index.xml\n"))
+		case "/sitemap_index.xml":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>` + serverURL + `/sitemap-blog.xml.gz</loc></sitemap>
+  <sitemap><loc>` + serverURL + `/sitemap-docs.xml</loc></sitemap>
+</sitemapindex>`))
+		case "/sitemap-blog.xml.gz":
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write([]byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>` + serverURL + `/blog/viejo</loc><lastmod>2020-01-01</lastmod></url>
+  <url><loc>` + serverURL + `/blog/nuevo</loc><lastmod>2024-05-10T08:00:00+00:00</lastmod><changefreq>weekly</changefreq><priority>0.8</priority></url>
+</urlset>`))
+			gz.Close()
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(buf.Bytes())
+		case "/sitemap-docs.xml":
+			w.Write([]byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>` + serverURL + `/docs/inicio</loc><lastmod>2024-06-01</lastmod></url>
+</urlset>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer testServer.Close()
+	serverURL = testServer.URL
+
+	// Descubrimiento vía robots.txt, expansión del índice y descompresión gzip
+	code, response := callTool(t, mux, apiKey, "sitemap", map[string]interface{}{
+		"url": serverURL,
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(3), response["count"])
+	assert.Len(t, response["sitemaps"], 3)
+
+	// Filtros por fecha y ruta
+	code, response = callTool(t, mux, apiKey, "sitemap", map[string]interface{}{
+		"url":         serverURL,
+		"since":       "2024-01-01",
+		"path_prefix": "/blog",
+	})
+	assert.Equal(t, http.StatusOK, code)
+	urls := response["urls"].([]interface{})
+	if assert.Len(t, urls, 1) {
+		entry := urls[0].(map[string]interface{})
+		assert.Equal(t, serverURL+"/blog/nuevo", entry["loc"])
+		assert.Equal(t, "weekly", entry["changefreq"])
+		assert.Equal(t, 0.8, entry["priority"])
+	}
+
+	// Sin robots.txt ni /sitemap.xml no hay sitemaps
+	emptyServer := httptest.NewServer(http.NotFoundHandler())
+	defer emptyServer.Close()
+	code, response = callTool(t, mux, apiKey, "sitemap", map[string]interface{}{
+		"url": emptyServer.URL,
+	})
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "sitemap_not_found", response["code"])
+}
+
+func TestSitemapRespectRobotsRedirects(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	var serverURL string
+	privateHits := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /privado/\nSitemap: " + serverURL + "/sitemap.xml\n"))
+		case "/sitemap.xml":
+			http.Redirect(w, r, "/privado/sitemap.xml", http.StatusFound)
+		case "/privado/sitemap.xml":
+			privateHits++
+			w.Write([]byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>` + serverURL + `/privado/a</loc></url>
+</urlset>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer testServer.Close()
+	serverURL = testServer.URL
+
+	// La redirección hacia una ruta prohibida por robots.txt no se sigue
+	code, response := callTool(t, mux, apiKey, "sitemap", map[string]interface{}{
+		"url":            serverURL,
+		"respect_robots": true,
+	})
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "sitemap_not_found", response["code"])
+	assert.Contains(t, response["error"], "robots.txt")
+	assert.Equal(t, 0, privateHits)
+
+	// Sin respect_robots se sigue la redirección
+	code, response = callTool(t, mux, apiKey, "sitemap", map[string]interface{}{
+		"url": serverURL,
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), response["count"])
+}
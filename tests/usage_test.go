@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"toolbox/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getUsage consulta /api/usage con el token indicado
+func getUsage(t *testing.T, mux *http.ServeMux, token, query string) (int, map[string]interface{}) {
+	req := httptest.NewRequest("GET", "/api/usage"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	return rr.Code, response
+}
+
+func TestUsageMetering(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body><p>hola</p></body></html>"))
+	}))
+	defer testServer.Close()
+
+	code, _ := callTool(t, mux, apiKey, "webfetch", map[string]interface{}{"url": testServer.URL, "format": "text"})
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = callTool(t, mux, apiKey, "webfetch", map[string]interface{}{"url": testServer.URL, "format": "text"})
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = callTool(t, mux, apiKey, "search", map[string]interface{}{})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Una clave sin read:usage no puede consultar el uso
+	jwtToken, err := auth.GenerateJWT("test@example.com")
+	assert.NoError(t, err)
+	code, response := createKey(t, mux, jwtToken, `{"scopes": ["tool:webfetch"]}`)
+	assert.Equal(t, http.StatusOK, code)
+	code, response = getUsage(t, mux, response["key"].(string), "")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "insufficient_scope", response["code"])
+
+	code, response = getUsage(t, mux, apiKey, "?group_by=tool,key")
+	assert.Equal(t, http.StatusOK, code)
+
+	totals := response["totals"].(map[string]interface{})
+	assert.Equal(t, float64(3), totals["calls"])
+	assert.Equal(t, float64(1), totals["errors"])
+	assert.Greater(t, totals["bytes_in"], float64(0))
+	assert.Greater(t, totals["bytes_out"], float64(0))
+
+	entries := response["usage"].([]interface{})
+	assert.Len(t, entries, 2)
+	byTool := map[string]map[string]interface{}{}
+	for _, item := range entries {
+		entry := item.(map[string]interface{})
+		byTool[entry["tool"].(string)] = entry
+		assert.Equal(t, "test-key", entry["key_name"])
+	}
+	assert.Equal(t, float64(2), byTool["webfetch"]["calls"])
+	assert.Equal(t, float64(0), byTool["webfetch"]["errors"])
+	assert.Equal(t, float64(1), byTool["search"]["errors"])
+
+	// Cada llamada queda registrada con su estado, código de error y host consultado
+	var status int
+	var errorCode string
+	err = auth.DB.QueryRow("SELECT status, error_code FROM tool_calls WHERE tool = 'search'").Scan(&status, &errorCode)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "missing_query", errorCode)
+
+	var host string
+	err = auth.DB.QueryRow("SELECT upstream_host FROM tool_calls WHERE tool = 'webfetch' LIMIT 1").Scan(&host)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", host)
+
+	// Agrupación por día y filtros
+	code, response = getUsage(t, mux, apiKey, "?tool=webfetch")
+	assert.Equal(t, http.StatusOK, code)
+	entries = response["usage"].([]interface{})
+	assert.Len(t, entries, 1)
+	assert.NotEmpty(t, entries[0].(map[string]interface{})["day"])
+	assert.Equal(t, float64(2), entries[0].(map[string]interface{})["calls"])
+
+	code, response = getUsage(t, mux, apiKey, "?group_by=semana")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_usage_options", response["code"])
+
+	code, response = getUsage(t, mux, apiKey, "?from=ayer")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_date", response["code"])
+}
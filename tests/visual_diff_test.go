@@ -0,0 +1,267 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"toolbox/auth"
+	"toolbox/tools"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodePNG genera un PNG blanco de w×h con los rectángulos indicados pintados de negro
+func encodePNG(t *testing.T, w, h int, boxes ...image.Rectangle) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for _, box := range boxes {
+		draw.Draw(img, box, &image.Uniform{C: color.Black}, image.Point{}, draw.Src)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompareImages(t *testing.T) {
+	baseline := encodePNG(t, 200, 100, image.Rect(10, 10, 30, 30))
+
+	// Imágenes idénticas
+	result, err := tools.CompareImages(baseline, baseline, 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.MismatchedPixels)
+	assert.Empty(t, result.Regions)
+	assert.NotEmpty(t, result.DiffImage)
+
+	// Un bloque nuevo produce una región con su bounding box
+	changed := encodePNG(t, 200, 100, image.Rect(10, 10, 30, 30), image.Rect(150, 60, 170, 80))
+	result, err = tools.CompareImages(baseline, changed, 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, result.MismatchedPixels)
+	assert.InDelta(t, 2.0, result.MismatchPercent, 0.001)
+	if assert.Len(t, result.Regions, 1) {
+		region := result.Regions[0]
+		assert.True(t, region.X <= 150 && region.Y <= 60)
+		assert.True(t, region.X+region.Width >= 170 && region.Y+region.Height >= 80)
+	}
+
+	diffImg, err := png.Decode(bytes.NewReader(result.DiffImage))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 200, 100), diffImg.Bounds())
+
+	// Las regiones ignoradas no cuentan
+	result, err = tools.CompareImages(baseline, changed, 0, []tools.Region{{X: 140, Y: 50, Width: 40, Height: 40}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.MismatchedPixels)
+
+	// Con tamaños distintos el área sobrante cuenta como diferencia
+	taller := encodePNG(t, 200, 110, image.Rect(10, 10, 30, 30))
+	result, err = tools.CompareImages(baseline, taller, 0, nil)
+	assert.NoError(t, err)
+	assert.True(t, result.SizeChanged)
+	assert.Equal(t, 2000, result.MismatchedPixels)
+}
+
+// pngHeader genera solo la firma y la cabecera IHDR de un PNG que declara w×h
+func pngHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], w)
+	binary.BigEndian.PutUint32(ihdr[8:], h)
+	ihdr[12], ihdr[13] = 8, 6 // 8 bits, RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(13))
+	buf.Write(ihdr)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+	return buf.Bytes()
+}
+
+func TestBaselineImageLimits(t *testing.T) {
+	// Un PNG de unos pocos bytes que declara 60000×60000 se rechaza sin decodificarlo
+	huge := pngHeader(60000, 60000)
+	_, err := tools.DecodeBase64Image(base64.StdEncoding.EncodeToString(huge))
+	if assert.Error(t, err) {
+		assert.Equal(t, "baseline_image_too_large", err.(*tools.ToolError).Code)
+	}
+	_, err = tools.CompareImages(huge, encodePNG(t, 10, 10), 0, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "baseline_image_too_large", err.(*tools.ToolError).Code)
+	}
+
+	// Dentro de cada dimensión pero con demasiados píxeles en total
+	_, err = tools.DecodeBase64Image(base64.StdEncoding.EncodeToString(pngHeader(10000, 10000)))
+	if assert.Error(t, err) {
+		assert.Equal(t, "baseline_image_too_large", err.(*tools.ToolError).Code)
+	}
+
+	_, err = tools.DecodeBase64Image(base64.StdEncoding.EncodeToString(encodePNG(t, 100, 100)))
+	assert.NoError(t, err)
+}
+
+func TestToolRequestBodyLimit(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+
+	code, response := callTool(t, mux, apiKey, "visual_diff", map[string]interface{}{
+		"url":            "https://example.com",
+		"baseline_image": strings.Repeat("A", 21<<20),
+	})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	assert.Equal(t, "request_too_large", response["code"])
+}
+
+// stubScreenshot sustituye el navegador por una función que devuelve *current
+func stubScreenshot(t *testing.T, current *[]byte) {
+	previous := tools.CaptureScreenshot
+	tools.CaptureScreenshot = func(string, int, bool) ([]byte, error) { return *current, nil }
+	t.Cleanup(func() { tools.CaptureScreenshot = previous })
+}
+
+// getArtifact descarga una captura guardada con la clave indicada
+func getArtifact(mux *http.ServeMux, apiKey, artifactID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/api/artifacts/"+artifactID, nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestVisualDiffNamedBaseline(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+	current := encodePNG(t, 200, 100)
+	stubScreenshot(t, &current)
+
+	// La primera ejecución con un nombre guarda la referencia
+	code, response := callTool(t, mux, apiKey, "visual_diff", map[string]interface{}{"url": "https://example.com", "name": "inicio"})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, response["baseline_created"])
+	firstID := response["artifact_id"].(string)
+
+	// La siguiente se compara con ella
+	current = encodePNG(t, 200, 100, image.Rect(0, 0, 20, 20))
+	code, response = callTool(t, mux, apiKey, "visual_diff", map[string]interface{}{"url": "https://example.com", "name": "inicio", "include_diff_image": false})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, response["baseline_created"])
+	assert.Equal(t, firstID, response["baseline_artifact_id"])
+	assert.Equal(t, float64(400), response["mismatched_pixels"])
+	assert.Nil(t, response["diff_image"])
+	secondID := response["artifact_id"].(string)
+
+	// Y la última captura pasa a ser la referencia
+	code, response = callTool(t, mux, apiKey, "visual_diff", map[string]interface{}{"url": "https://example.com", "name": "inicio"})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, secondID, response["baseline_artifact_id"])
+	assert.Equal(t, float64(0), response["mismatched_pixels"])
+	assert.NotEmpty(t, response["diff_image"])
+
+	// La captura se puede descargar por su identificador
+	rr := getArtifact(mux, apiKey, secondID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+	assert.Equal(t, current, rr.Body.Bytes())
+}
+
+func TestVisualDiffBaselines(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+	current := encodePNG(t, 100, 100)
+	stubScreenshot(t, &current)
+
+	// Imagen de referencia subida en base64 o como data URI
+	baseline := encodePNG(t, 100, 100, image.Rect(0, 0, 10, 10))
+	code, response := callTool(t, mux, apiKey, "visual_diff", map[string]interface{}{
+		"url":            "https://example.com",
+		"baseline_image": "data:image/png;base64," + base64.StdEncoding.EncodeToString(baseline),
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(100), response["mismatched_pixels"])
+	uploadedID := response["artifact_id"].(string)
+
+	// Una captura anterior como referencia
+	code, response = callTool(t, mux, apiKey, "visual_diff", map[string]interface{}{"url": "https://example.com", "baseline_artifact_id": uploadedID})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, uploadedID, response["baseline_artifact_id"])
+	assert.Equal(t, float64(0), response["mismatched_pixels"])
+
+	// Imágenes de referencia no válidas o demasiado grandes
+	for input, expected := range map[string]string{
+		"no es base64": "invalid_baseline_image",
+		base64.StdEncoding.EncodeToString([]byte("texto")):         "invalid_baseline_image",
+		base64.StdEncoding.EncodeToString(pngHeader(60000, 60000)): "baseline_image_too_large",
+	} {
+		code, response = callTool(t, mux, apiKey, "visual_diff", map[string]interface{}{"url": "https://example.com", "baseline_image": input})
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, expected, response["code"])
+	}
+
+	code, response = callTool(t, mux, apiKey, "visual_diff", map[string]interface{}{"url": "https://example.com"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "missing_baseline", response["code"])
+}
+
+func TestVisualDiffArtifactOwnership(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+	current := encodePNG(t, 50, 50)
+	stubScreenshot(t, &current)
+
+	// Captura de otro usuario
+	otherID, err := getUserIDByEmail(auth.DB, "otro@example.com")
+	assert.NoError(t, err)
+	_, err = auth.DB.Exec("INSERT INTO screenshot_artifacts (id, user_id, name, url, image) VALUES ('art_ajena', ?, '', 'https://example.com', ?)", otherID, current)
+	assert.NoError(t, err)
+
+	code, response := callTool(t, mux, apiKey, "visual_diff", map[string]interface{}{"url": "https://example.com", "baseline_artifact_id": "art_ajena"})
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "baseline_not_found", response["code"])
+	assert.Equal(t, http.StatusNotFound, getArtifact(mux, apiKey, "art_ajena").Code)
+
+	// Las capturas propias requieren el permiso de visual_diff
+	code, response = callTool(t, mux, apiKey, "visual_diff", map[string]interface{}{"url": "https://example.com", "name": "propia"})
+	assert.Equal(t, http.StatusOK, code)
+	ownID := response["artifact_id"].(string)
+
+	jwtToken, err := auth.GenerateJWT("test@example.com")
+	assert.NoError(t, err)
+	_, response = createKey(t, mux, jwtToken, `{"scopes": ["tool:search"]}`)
+	assert.Equal(t, http.StatusForbidden, getArtifact(mux, response["key"].(string), ownID).Code)
+	_, response = createKey(t, mux, jwtToken, `{"scopes": ["tool:visual_diff"]}`)
+	assert.Equal(t, http.StatusOK, getArtifact(mux, response["key"].(string), ownID).Code)
+}
+
+func TestVisualDiffUnnamedRetention(t *testing.T) {
+	mux, apiKey := setupTestAPI(t)
+	current := encodePNG(t, 50, 50)
+	stubScreenshot(t, &current)
+
+	userID, err := getUserIDByEmail(auth.DB, "test@example.com")
+	assert.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		_, err := auth.DB.Exec("INSERT INTO screenshot_artifacts (id, user_id, name, url, image, created_at) VALUES (?, ?, '', 'https://example.com', ?, datetime('now', '-1 hour'))",
+			fmt.Sprintf("art_%02d", i), userID, current)
+		assert.NoError(t, err)
+	}
+
+	// Las capturas sin nombre se purgan al llegar al límite por usuario
+	code, response := callTool(t, mux, apiKey, "visual_diff", map[string]interface{}{
+		"url":            "https://example.com",
+		"baseline_image": base64.StdEncoding.EncodeToString(current),
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	var count int
+	assert.NoError(t, auth.DB.QueryRow("SELECT COUNT(*) FROM screenshot_artifacts WHERE user_id = ? AND name = ''", userID).Scan(&count))
+	assert.Equal(t, 50, count)
+	assert.Equal(t, http.StatusOK, getArtifact(mux, apiKey, response["artifact_id"].(string)).Code)
+}
@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"bytes"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// Origen de la codificación detectada por DetectCharset
+const (
+	CharsetSourceBOM     = "bom"
+	CharsetSourceHeader  = "header"
+	CharsetSourceMeta    = "meta"
+	CharsetSourceSniffed = "sniffed"
+)
+
+// charsetPrescanSize es la cantidad de bytes que se inspeccionan buscando <meta charset>
+const charsetPrescanSize = 4096
+
+var (
+	metaCharsetRe = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-zA-Z0-9_:.\-]+)`)
+	xmlEncodingRe = regexp.MustCompile(`(?i)^\s*<\?xml[^>]+encoding\s*=\s*["']([a-zA-Z0-9_:.\-]+)["']`)
+)
+
+// IsTextContent indica si un Content-Type corresponde a contenido textual que
+// debe transcodificarse (HTML, XML, JSON, texto plano, etc.)
+func IsTextContent(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if mediaType == "" || strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	for _, suffix := range []string{"xml", "json", "javascript", "xhtml+xml"} {
+		if strings.HasSuffix(mediaType, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectCharset determina la codificación del contenido en este orden: BOM,
+// parámetro charset del Content-Type, <meta charset> o declaración XML y, por
+// último, análisis del propio contenido. Devuelve el nombre canónico y su origen.
+func DetectCharset(content []byte, contentType string) (string, string) {
+	// 1. Byte Order Mark
+	switch {
+	case bytes.HasPrefix(content, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8", CharsetSourceBOM
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		return "utf-16be", CharsetSourceBOM
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		return "utf-16le", CharsetSourceBOM
+	}
+
+	// 2. Encabezado Content-Type
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if name := canonicalCharset(params["charset"]); name != "" {
+			return name, CharsetSourceHeader
+		}
+	}
+
+	// 3. <meta charset> o <?xml encoding?> al principio del documento
+	prescan := content
+	if len(prescan) > charsetPrescanSize {
+		prescan = prescan[:charsetPrescanSize]
+	}
+	if m := xmlEncodingRe.FindSubmatch(prescan); m != nil {
+		if name := canonicalCharset(string(m[1])); name != "" {
+			return name, CharsetSourceMeta
+		}
+	}
+	if m := metaCharsetRe.FindSubmatch(prescan); m != nil {
+		if name := canonicalCharset(string(m[1])); name != "" {
+			return name, CharsetSourceMeta
+		}
+	}
+
+	// 4. Análisis del contenido
+	return sniffCharset(content), CharsetSourceSniffed
+}
+
+// canonicalCharset normaliza una etiqueta de codificación según WHATWG ("latin1" -> "windows-1252")
+func canonicalCharset(label string) string {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return ""
+	}
+	if _, name := charset.Lookup(label); name != "" {
+		return name
+	}
+	return ""
+}
+
+// sniffCharset estima la codificación cuando no hay declaración explícita
+func sniffCharset(content []byte) string {
+	if utf8.Valid(content) {
+		return "utf-8"
+	}
+
+	// Las páginas japonesas sin declarar suelen estar en Shift_JIS; sólo se
+	// acepta si todas las secuencias son válidas y abundan los caracteres dobles
+	if looksLikeShiftJIS(content) {
+		return "shift_jis"
+	}
+
+	// Windows-1252 es el valor por defecto de los navegadores para contenido occidental
+	return "windows-1252"
+}
+
+// looksLikeShiftJIS comprueba si los bytes altos forman pares Shift_JIS válidos
+func looksLikeShiftJIS(content []byte) bool {
+	pairs, high := 0, 0
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if c < 0x80 {
+			continue
+		}
+		high++
+		// Katakana de ancho medio (un solo byte)
+		if c >= 0xA1 && c <= 0xDF {
+			continue
+		}
+		if (c >= 0x81 && c <= 0x9F) || (c >= 0xE0 && c <= 0xFC) {
+			if i+1 >= len(content) {
+				return false
+			}
+			next := content[i+1]
+			if next < 0x40 || next == 0x7F || next > 0xFC {
+				return false
+			}
+			pairs++
+			high++
+			i++
+			continue
+		}
+		return false
+	}
+	return pairs > 0 && pairs*2 >= high/2
+}
+
+// DecodeToUTF8 transcodifica el contenido a UTF-8 usando la codificación
+// detectada. Devuelve el contenido convertido, el nombre de la codificación
+// original y el origen de la detección.
+func DecodeToUTF8(content []byte, contentType string) ([]byte, string, string, error) {
+	name, source := DetectCharset(content, contentType)
+
+	enc, canonical := charset.Lookup(name)
+	if name == "shift_jis" && enc == nil {
+		enc, canonical = japanese.ShiftJIS, "shift_jis"
+	}
+	if enc == nil || canonical == "utf-8" {
+		// Eliminar el BOM para que no aparezca en la salida
+		return bytes.TrimPrefix(content, []byte{0xEF, 0xBB, 0xBF}), name, source, nil
+	}
+
+	decoded, _, err := transform.Bytes(enc.NewDecoder(), content)
+	if err != nil {
+		return content, canonical, source, err
+	}
+	return bytes.TrimPrefix(decoded, []byte{0xEF, 0xBB, 0xBF}), canonical, source, nil
+}
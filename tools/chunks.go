@@ -0,0 +1,381 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultChunkSize = 512
+	minChunkSize     = 32
+	maxChunkSize     = 8192
+)
+
+// ChunkOptions configura la división del contenido en fragmentos
+type ChunkOptions struct {
+	Enabled bool
+	Size    int // máximo de tokens por fragmento
+	Overlap int // tokens repetidos del fragmento anterior
+}
+
+// Chunk es un fragmento del contenido. Start y End son posiciones en
+// caracteres (code points) dentro de output.
+type Chunk struct {
+	Index       int      `json:"index"`
+	Text        string   `json:"text"`
+	Tokens      int      `json:"tokens"`
+	HeadingPath []string `json:"heading_path"`
+	Start       int      `json:"start"`
+	End         int      `json:"end"`
+}
+
+// ParseChunkOptions lee chunks, chunk_size y chunk_overlap del payload
+func ParseChunkOptions(payload map[string]interface{}) (*ChunkOptions, error) {
+	opts := &ChunkOptions{Size: defaultChunkSize}
+
+	if v, ok := payload["chunks"]; ok && v != nil {
+		enabled, ok := v.(bool)
+		if !ok {
+			return nil, &ToolError{Code: "invalid_chunk_options", Message: "el campo 'chunks' debe ser booleano"}
+		}
+		opts.Enabled = enabled
+	}
+
+	readInt := func(field string, target *int) error {
+		v, ok := payload[field]
+		if !ok || v == nil {
+			return nil
+		}
+		n, ok := v.(float64)
+		if !ok || n < 0 || n != float64(int(n)) {
+			return &ToolError{Code: "invalid_chunk_options", Message: fmt.Sprintf("el campo '%s' debe ser un entero no negativo", field)}
+		}
+		*target = int(n)
+		return nil
+	}
+	if err := readInt("chunk_size", &opts.Size); err != nil {
+		return nil, err
+	}
+	if err := readInt("chunk_overlap", &opts.Overlap); err != nil {
+		return nil, err
+	}
+
+	if opts.Size < minChunkSize || opts.Size > maxChunkSize {
+		return nil, &ToolError{Code: "invalid_chunk_options", Message: fmt.Sprintf("'chunk_size' debe estar entre %d y %d tokens", minChunkSize, maxChunkSize)}
+	}
+	if opts.Overlap > opts.Size/2 {
+		return nil, &ToolError{Code: "invalid_chunk_options", Message: "'chunk_overlap' no puede superar la mitad de 'chunk_size'"}
+	}
+	return opts, nil
+}
+
+// EstimateTokens aproxima el número de tokens de un texto sin depender de un
+// tokenizador concreto: ~4 caracteres por token en palabras latinas, un token
+// por ideograma CJK y por signo de puntuación
+func EstimateTokens(text string) int {
+	tokens := 0
+	wordLen := 0
+	flush := func() {
+		if wordLen > 0 {
+			tokens += (wordLen + 3) / 4
+			wordLen = 0
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			wordLen++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+var (
+	headingLine   = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+	sentenceBreak = regexp.MustCompile(`[.!?。！？]+\s+`)
+)
+
+// chunkBlock es un bloque (encabezado, párrafo, lista, código...) del contenido
+type chunkBlock struct {
+	start, end  int // posiciones en bytes
+	headingPath []string
+	heading     bool
+}
+
+// splitBlocks divide el contenido en bloques separados por líneas en blanco,
+// manteniendo los bloques de código completos y los encabezados como bloques propios
+func splitBlocks(content string) []chunkBlock {
+	var blocks []chunkBlock
+	var path []string
+	blockStart := -1
+	inFence := false
+
+	closeBlock := func(end int) {
+		if blockStart >= 0 {
+			blocks = append(blocks, chunkBlock{start: blockStart, end: end, headingPath: append([]string(nil), path...)})
+			blockStart = -1
+		}
+	}
+
+	offset := 0
+	for offset < len(content) {
+		lineEnd := strings.IndexByte(content[offset:], '\n')
+		next := len(content)
+		if lineEnd >= 0 {
+			next = offset + lineEnd + 1
+			lineEnd = offset + lineEnd
+		} else {
+			lineEnd = len(content)
+		}
+		line := strings.TrimRight(content[offset:lineEnd], "\r")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			if blockStart < 0 {
+				blockStart = offset
+			}
+			inFence = !inFence
+		case inFence:
+			// Dentro de un bloque de código las líneas en blanco no separan bloques
+		case trimmed == "":
+			closeBlock(offset)
+		case headingLine.MatchString(line):
+			closeBlock(offset)
+			match := headingLine.FindStringSubmatch(line)
+			level := len(match[1])
+			if len(path) >= level {
+				path = path[:level-1]
+			}
+			for len(path) < level-1 {
+				path = append(path, "")
+			}
+			path = append(path, match[2])
+			blocks = append(blocks, chunkBlock{start: offset, end: lineEnd, headingPath: append([]string(nil), path...), heading: true})
+		default:
+			if blockStart < 0 {
+				blockStart = offset
+			}
+		}
+		offset = next
+	}
+	closeBlock(len(content))
+
+	// Quitar espacios finales de cada bloque para que los fragmentos no terminen en saltos de línea
+	for i := range blocks {
+		blocks[i].end = blocks[i].start + len(strings.TrimRight(content[blocks[i].start:blocks[i].end], " \t\r\n"))
+	}
+	return blocks
+}
+
+// splitOversized divide un tramo que excede el presupuesto por frases, si
+// una frase sigue siendo demasiado larga por palabras y, si una palabra no
+// cabe (URLs, base64), por caracteres
+func splitOversized(content string, start, end, budget int) [][2]int {
+	var units [][2]int
+	last := start
+	for _, loc := range sentenceBreak.FindAllStringIndex(content[start:end], -1) {
+		units = append(units, [2]int{last, start + loc[1]})
+		last = start + loc[1]
+	}
+	if last < end {
+		units = append(units, [2]int{last, end})
+	}
+
+	// Partir por palabras las frases demasiado largas
+	var pieces [][2]int
+	for _, unit := range units {
+		if EstimateTokens(content[unit[0]:unit[1]]) <= budget {
+			pieces = append(pieces, unit)
+			continue
+		}
+		addWord := func(start, end int) {
+			if EstimateTokens(content[start:end]) <= budget {
+				pieces = append(pieces, [2]int{start, end})
+				return
+			}
+			pieces = append(pieces, splitRunes(content, start, end, budget)...)
+		}
+		wordStart := unit[0]
+		for i, r := range content[unit[0]:unit[1]] {
+			pos := unit[0] + i
+			if unicode.IsSpace(r) && pos > wordStart {
+				addWord(wordStart, pos+utf8.RuneLen(r))
+				wordStart = pos + utf8.RuneLen(r)
+			}
+		}
+		if wordStart < unit[1] {
+			addWord(wordStart, unit[1])
+		}
+	}
+
+	// Agrupar las piezas consecutivas sin superar el presupuesto
+	var spans [][2]int
+	current := [2]int{-1, -1}
+	for _, piece := range pieces {
+		if current[0] >= 0 && EstimateTokens(content[current[0]:piece[1]]) > budget {
+			spans = append(spans, current)
+			current = [2]int{-1, -1}
+		}
+		if current[0] < 0 {
+			current[0] = piece[0]
+		}
+		current[1] = piece[1]
+	}
+	if current[0] >= 0 {
+		spans = append(spans, current)
+	}
+	return spans
+}
+
+// splitRunes parte por caracteres un tramo sin espacios que excede el
+// presupuesto. Cada carácter cuenta como mucho un token y cuatro letras
+// seguidas cuentan uno, así que cada trozo tiene entre budget y 4*budget
+// caracteres; se busca el más largo que quepa.
+func splitRunes(content string, start, end, budget int) [][2]int {
+	if budget < 1 {
+		budget = 1
+	}
+	// advance devuelve la posición tras n caracteres desde pos, sin pasar de end
+	advance := func(pos, n int) int {
+		for ; n > 0 && pos < end; n-- {
+			_, size := utf8.DecodeRuneInString(content[pos:end])
+			pos += size
+		}
+		return pos
+	}
+
+	var pieces [][2]int
+	for start < end {
+		lo, hi := budget, 4*budget
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			if EstimateTokens(content[start:advance(start, mid)]) <= budget {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		cut := advance(start, lo)
+		pieces = append(pieces, [2]int{start, cut})
+		start = cut
+	}
+	return pieces
+}
+
+// overlapStart retrocede desde pos hasta cubrir unos overlap tokens, sin pasar de limit
+func overlapStart(content string, pos, limit, overlap int) int {
+	start := pos
+	for start > limit && EstimateTokens(content[start:pos]) < overlap {
+		// Retroceder hasta el inicio de la palabra anterior
+		prev := strings.LastIndexFunc(strings.TrimRightFunc(content[limit:start], unicode.IsSpace), unicode.IsSpace)
+		if prev < 0 {
+			return limit
+		}
+		_, size := utf8.DecodeRuneInString(content[limit+prev:])
+		start = limit + prev + size
+	}
+	return start
+}
+
+// ChunkContent divide el contenido en fragmentos de como máximo opts.Size
+// tokens, respetando encabezados y párrafos. Cada fragmento incluye la ruta
+// de encabezados en la que empieza y sus posiciones en el contenido.
+func ChunkContent(content string, opts *ChunkOptions) []Chunk {
+	budget := opts.Size - opts.Overlap
+	var spans []struct {
+		start, end int
+		path       []string
+	}
+
+	addSpan := func(start, end int, path []string) {
+		spans = append(spans, struct {
+			start, end int
+			path       []string
+		}{start, end, path})
+	}
+
+	curStart, curEnd := -1, -1
+	var curPath []string
+	flush := func() {
+		if curStart >= 0 {
+			addSpan(curStart, curEnd, curPath)
+			curStart, curEnd = -1, -1
+		}
+	}
+
+	for _, block := range splitBlocks(content) {
+		if block.end <= block.start {
+			continue
+		}
+		if block.heading {
+			flush()
+		}
+		if curStart >= 0 && EstimateTokens(content[curStart:block.end]) > budget {
+			flush()
+		}
+		if EstimateTokens(content[block.start:block.end]) > budget {
+			flush()
+			for _, span := range splitOversized(content, block.start, block.end, budget) {
+				addSpan(span[0], span[1], block.headingPath)
+			}
+			continue
+		}
+		if curStart < 0 {
+			curStart, curPath = block.start, block.headingPath
+		}
+		curEnd = block.end
+	}
+	flush()
+
+	// Aplicar el solapamiento y convertir las posiciones de bytes a caracteres
+	starts := make([]int, len(spans))
+	var positions []int
+	for i, span := range spans {
+		starts[i] = span.start
+		if i > 0 && opts.Overlap > 0 {
+			starts[i] = overlapStart(content, span.start, spans[i-1].start, opts.Overlap)
+		}
+		positions = append(positions, starts[i], span.end)
+	}
+	sort.Ints(positions)
+	charAt := make(map[int]int, len(positions))
+	chars, last := 0, 0
+	for _, pos := range positions {
+		chars += utf8.RuneCountInString(content[last:pos])
+		last = pos
+		charAt[pos] = chars
+	}
+
+	chunks := make([]Chunk, 0, len(spans))
+	for i, span := range spans {
+		start := starts[i]
+		text := content[start:span.end]
+		path := span.path
+		if path == nil {
+			path = []string{}
+		}
+		chunks = append(chunks, Chunk{
+			Index:       i,
+			Text:        text,
+			Tokens:      EstimateTokens(text),
+			HeadingPath: path,
+			Start:       charAt[start],
+			End:         charAt[span.end],
+		})
+	}
+	return chunks
+}
@@ -0,0 +1,420 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/jaytaylor/html2text"
+)
+
+const (
+	defaultCrawlDepth       = 2
+	maxCrawlDepth           = 5
+	defaultCrawlPages       = 20
+	maxCrawlPages           = 200
+	defaultCrawlConcurrency = 4
+	maxCrawlConcurrency     = 10
+)
+
+// crawlSkipExtensions son recursos que nunca se encolan al seguir enlaces
+var crawlSkipExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".svg": true, ".ico": true,
+	".css": true, ".js": true, ".mjs": true, ".map": true, ".woff": true, ".woff2": true, ".ttf": true,
+	".mp3": true, ".mp4": true, ".webm": true, ".avi": true, ".mov": true, ".zip": true, ".gz": true,
+	".tar": true, ".rar": true, ".7z": true, ".exe": true, ".dmg": true, ".iso": true,
+}
+
+// CrawlOptions configura un rastreo a partir de una URL semilla
+type CrawlOptions struct {
+	URL         string
+	Format      string
+	MaxDepth    int
+	MaxPages    int
+	Concurrency int
+	SameDomain  bool
+	PathPrefix  string
+	Include     []*regexp.Regexp
+	Exclude     []*regexp.Regexp
+	Fetch       *FetchOptions // encabezados, cookies, timeout por página, redirecciones y robots.txt
+}
+
+// CrawlPage es el resultado de visitar una página
+type CrawlPage struct {
+	URL         string                 `json:"url"`
+	Depth       int                    `json:"depth"`
+	StatusCode  int                    `json:"status_code,omitempty"`
+	ContentType string                 `json:"content_type,omitempty"`
+	Title       string                 `json:"title,omitempty"`
+	Output      string                 `json:"output,omitempty"`
+	Links       int                    `json:"links"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	ErrorCode   string                 `json:"error_code,omitempty"`
+}
+
+// CrawlProgress resume el avance de un rastreo
+type CrawlProgress struct {
+	Visited  int `json:"visited"`
+	Failed   int `json:"failed"`
+	Queued   int `json:"queued"`
+	Depth    int `json:"depth"`
+	MaxPages int `json:"max_pages"`
+}
+
+// ParseCrawlOptions valida el payload de la herramienta crawl
+func ParseCrawlOptions(payload map[string]interface{}) (*CrawlOptions, error) {
+	rawURL, _ := payload["url"].(string)
+	if rawURL == "" {
+		return nil, &ToolError{Code: "missing_url", Message: "se requiere el parámetro 'url' en el payload"}
+	}
+	seed, err := url.ParseRequestURI(rawURL)
+	if err != nil || (seed.Scheme != "http" && seed.Scheme != "https") || seed.Host == "" {
+		return nil, &ToolError{Code: "invalid_url", Message: "URL inválida. Debe comenzar con http:// o https://"}
+	}
+
+	opts := &CrawlOptions{
+		URL:         normalizeCrawlURL(seed),
+		Format:      "markdown",
+		MaxDepth:    defaultCrawlDepth,
+		MaxPages:    defaultCrawlPages,
+		Concurrency: defaultCrawlConcurrency,
+		SameDomain:  true,
+	}
+
+	if opts.Fetch, err = ParseFetchOptions(payload); err != nil {
+		return nil, err
+	}
+	if err := opts.Fetch.RequireGET(); err != nil {
+		return nil, err
+	}
+
+	if f, ok := payload["format"].(string); ok && f != "" {
+		switch f {
+		case "text", "markdown", "html":
+			opts.Format = f
+		default:
+			return nil, &ToolError{Code: "invalid_format", Message: "formato no válido. Use 'text', 'markdown' o 'html'"}
+		}
+	}
+
+	readInt := func(field string, target *int, min, max int) error {
+		v, ok := payload[field]
+		if !ok || v == nil {
+			return nil
+		}
+		n, ok := v.(float64)
+		if !ok || n != float64(int(n)) || int(n) < min {
+			return &ToolError{Code: "invalid_crawl_options", Message: fmt.Sprintf("el campo '%s' debe ser un entero mayor o igual a %d", field, min)}
+		}
+		*target = int(n)
+		if *target > max {
+			*target = max
+		}
+		return nil
+	}
+	if err := readInt("max_depth", &opts.MaxDepth, 0, maxCrawlDepth); err != nil {
+		return nil, err
+	}
+	if err := readInt("max_pages", &opts.MaxPages, 1, maxCrawlPages); err != nil {
+		return nil, err
+	}
+	if err := readInt("concurrency", &opts.Concurrency, 1, maxCrawlConcurrency); err != nil {
+		return nil, err
+	}
+
+	if v, ok := payload["same_domain"]; ok && v != nil {
+		sameDomain, ok := v.(bool)
+		if !ok {
+			return nil, &ToolError{Code: "invalid_crawl_options", Message: "el campo 'same_domain' debe ser booleano"}
+		}
+		opts.SameDomain = sameDomain
+	}
+
+	if v, ok := payload["path_prefix"]; ok && v != nil {
+		prefix, ok := v.(string)
+		if !ok {
+			return nil, &ToolError{Code: "invalid_crawl_options", Message: "el campo 'path_prefix' debe ser una cadena"}
+		}
+		if prefix != "" && !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		opts.PathPrefix = prefix
+	}
+
+	compile := func(field string) ([]*regexp.Regexp, error) {
+		v, ok := payload[field]
+		if !ok || v == nil {
+			return nil, nil
+		}
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, &ToolError{Code: "invalid_crawl_options", Message: fmt.Sprintf("el campo '%s' debe ser una lista de expresiones regulares", field)}
+		}
+		var patterns []*regexp.Regexp
+		for _, item := range list {
+			expr, ok := item.(string)
+			if !ok {
+				return nil, &ToolError{Code: "invalid_crawl_options", Message: fmt.Sprintf("el campo '%s' debe contener cadenas", field)}
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, &ToolError{Code: "invalid_crawl_options", Message: fmt.Sprintf("patrón inválido en '%s': %v", field, err)}
+			}
+			patterns = append(patterns, re)
+		}
+		return patterns, nil
+	}
+	if opts.Include, err = compile("include"); err != nil {
+		return nil, err
+	}
+	if opts.Exclude, err = compile("exclude"); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// normalizeCrawlURL elimina el fragmento y normaliza host y ruta para deduplicar
+func normalizeCrawlURL(u *url.URL) string {
+	normalized := *u
+	normalized.Fragment = ""
+	normalized.RawFragment = ""
+	normalized.Host = strings.ToLower(normalized.Host)
+	normalized.Scheme = strings.ToLower(normalized.Scheme)
+	if normalized.Path == "" {
+		normalized.Path = "/"
+	}
+	return normalized.String()
+}
+
+// inScope indica si un enlace debe seguirse según las opciones del rastreo
+func (o *CrawlOptions) inScope(seed, link *url.URL) bool {
+	if link.Scheme != "http" && link.Scheme != "https" {
+		return false
+	}
+	if o.SameDomain && !strings.EqualFold(link.Hostname(), seed.Hostname()) {
+		return false
+	}
+	if o.PathPrefix != "" && !strings.HasPrefix(link.Path, o.PathPrefix) {
+		return false
+	}
+	if crawlSkipExtensions[strings.ToLower(path.Ext(link.Path))] {
+		return false
+	}
+
+	full := link.String()
+	for _, re := range o.Exclude {
+		if re.MatchString(full) {
+			return false
+		}
+	}
+	if len(o.Include) == 0 {
+		return true
+	}
+	for _, re := range o.Include {
+		if re.MatchString(full) {
+			return true
+		}
+	}
+	return false
+}
+
+// Crawl recorre el sitio en anchura a partir de la URL semilla. onProgress se
+// invoca después de cada página visitada. Las páginas se devuelven en el orden
+// en que se visitaron dentro de cada nivel.
+func Crawl(ctx context.Context, opts *CrawlOptions, onProgress func(CrawlProgress, CrawlPage)) ([]CrawlPage, error) {
+	seed, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, &ToolError{Code: "invalid_url", Message: "URL inválida: " + opts.URL}
+	}
+
+	// Si la semilla está prohibida no tiene sentido iniciar el rastreo
+	if opts.Fetch.RespectRobots {
+		if err := Robots.Check(ctx, opts.URL); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := map[string]bool{opts.URL: true}
+	level := []string{opts.URL}
+	var pages []CrawlPage
+	progress := CrawlProgress{MaxPages: opts.MaxPages}
+
+	for depth := 0; depth <= opts.MaxDepth && len(level) > 0 && len(pages) < opts.MaxPages; depth++ {
+		// Recortar el nivel a las páginas que aún caben
+		if remaining := opts.MaxPages - len(pages); len(level) > remaining {
+			level = level[:remaining]
+		}
+		progress.Depth = depth
+
+		results := make([]CrawlPage, len(level))
+		links := make([][]string, len(level))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, opts.Concurrency)
+
+		for i, pageURL := range level {
+			if ctx.Err() != nil {
+				break
+			}
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, pageURL string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				page, found := crawlPage(ctx, pageURL, opts)
+				page.Depth = depth
+				results[i] = page
+				links[i] = found
+
+				mu.Lock()
+				if page.Error != "" {
+					progress.Failed++
+				} else {
+					progress.Visited++
+				}
+				progress.Queued = len(level) - progress.Visited - progress.Failed + len(pages)
+				current := progress
+				mu.Unlock()
+
+				if onProgress != nil {
+					onProgress(current, page)
+				}
+			}(i, pageURL)
+		}
+		wg.Wait()
+
+		if err := ctx.Err(); err != nil {
+			for _, page := range results {
+				if page.URL != "" {
+					pages = append(pages, page)
+				}
+			}
+			return pages, err
+		}
+
+		// Construir el siguiente nivel con los enlaces en alcance no visitados
+		var next []string
+		for i, page := range results {
+			pages = append(pages, page)
+			if depth == opts.MaxDepth {
+				continue
+			}
+			for _, link := range links[i] {
+				parsed, err := url.Parse(link)
+				if err != nil || !opts.inScope(seed, parsed) {
+					continue
+				}
+				normalized := normalizeCrawlURL(parsed)
+				if seen[normalized] {
+					continue
+				}
+				seen[normalized] = true
+				next = append(next, normalized)
+			}
+		}
+		level = next
+	}
+
+	return pages, nil
+}
+
+// crawlPage descarga una página, la convierte al formato pedido y devuelve sus enlaces
+func crawlPage(ctx context.Context, pageURL string, opts *CrawlOptions) (CrawlPage, []string) {
+	page := CrawlPage{URL: pageURL}
+	fail := func(code string, err error) (CrawlPage, []string) {
+		page.ErrorCode = code
+		page.Error = err.Error()
+		return page, nil
+	}
+
+	resp, err := Fetch(ctx, pageURL, opts.Fetch)
+	page.StatusCode = resp.StatusCode
+	page.ContentType = resp.ContentType
+	if err != nil {
+		return fail(fetchErrorCode(err, "request_failed"), err)
+	}
+	if resp.FinalURL.String() != pageURL {
+		page.Metadata = map[string]interface{}{"final_url": resp.FinalURL.String()}
+	}
+	if resp.StatusCode >= 400 {
+		return fail("http_error", fmt.Errorf("el servidor respondió con el código %d", resp.StatusCode))
+	}
+
+	// Documentos (PDF, Office): extraer texto y no seguir enlaces
+	if doc := resp.Document; doc != nil {
+		page.Output = doc.Text
+		if opts.Format == "markdown" {
+			page.Output = doc.Markdown
+		}
+		if page.Metadata == nil {
+			page.Metadata = map[string]interface{}{}
+		}
+		for k, v := range doc.Metadata {
+			page.Metadata[k] = v
+		}
+		if title, ok := doc.Metadata["title"].(string); ok {
+			page.Title = title
+		}
+		return page, nil
+	}
+
+	body := resp.Body
+	if !resp.IsHTML() {
+		page.Output = string(body)
+		return page, nil
+	}
+
+	var links []string
+	base := resp.FinalURL
+	if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body)); err == nil {
+		page.Title = strings.TrimSpace(doc.Find("title").First().Text())
+		if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+			if parsed, err := base.Parse(href); err == nil {
+				base = parsed
+			}
+		}
+		doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+			href, _ := s.Attr("href")
+			if rel, _ := s.Attr("rel"); strings.Contains(strings.ToLower(rel), "nofollow") {
+				return
+			}
+			if resolved, err := base.Parse(strings.TrimSpace(href)); err == nil {
+				links = append(links, resolved.String())
+			}
+		})
+	}
+	page.Links = len(links)
+
+	output, err := ConvertHTML(body, opts.Format)
+	if err != nil {
+		output = string(body)
+	}
+	page.Output = output
+	return page, links
+}
+
+// ConvertHTML convierte HTML al formato de salida de webfetch ("html", "markdown" o "text")
+func ConvertHTML(body []byte, format string) (string, error) {
+	switch format {
+	case "markdown":
+		converter := md.NewConverter("", true, nil)
+		return converter.ConvertString(string(body))
+	case "text":
+		return html2text.FromString(string(body), html2text.Options{
+			PrettyTables: true,
+			TextOnly:     true,
+		})
+	default:
+		return string(body), nil
+	}
+}
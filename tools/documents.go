@@ -0,0 +1,1137 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/jaytaylor/html2text"
+	"github.com/ledongthuc/pdf"
+)
+
+// Tipos de documento soportados por ExtractDocument
+const (
+	DocumentPDF  = "pdf"
+	DocumentDOCX = "docx"
+	DocumentXLSX = "xlsx"
+	DocumentPPTX = "pptx"
+	DocumentEPUB = "epub"
+	DocumentODT  = "odt"
+)
+
+// maxDocumentEntrySize limita lo que se descomprime de cada archivo interno
+// de un documento ZIP (protección contra zip bombs)
+const maxDocumentEntrySize = 50 * 1024 * 1024 // 50MB
+
+// maxSheetCells limita las celdas (filas × columnas usadas) que se generan por
+// hoja de cálculo: una celda suelta en la columna XFD no debe expandir cada
+// fila a 16384 columnas
+const maxSheetCells = 1000000
+
+// DocumentResult contiene el contenido extraído de un documento binario
+type DocumentResult struct {
+	Type     string                 `json:"type"`
+	Text     string                 `json:"text"`
+	Markdown string                 `json:"markdown"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// documentContentTypes relaciona los Content-Type conocidos con su tipo de documento
+var documentContentTypes = map[string]string{
+	"application/pdf": DocumentPDF,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   DocumentDOCX,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         DocumentXLSX,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": DocumentPPTX,
+	"application/epub+zip":                    DocumentEPUB,
+	"application/vnd.oasis.opendocument.text": DocumentODT,
+}
+
+// DetectDocumentType determina si la respuesta es un documento soportado a partir
+// del Content-Type y, si éste es genérico, de la extensión de la URL y de los
+// primeros bytes del contenido. Devuelve "" si no es un documento.
+func DetectDocumentType(contentType, rawURL string, content []byte) string {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if docType, ok := documentContentTypes[mediaType]; ok {
+		return docType
+	}
+
+	// Solo inspeccionar la extensión cuando el servidor no declaró un tipo útil
+	if mediaType != "" && mediaType != "application/octet-stream" &&
+		mediaType != "binary/octet-stream" && mediaType != "application/zip" &&
+		mediaType != "application/x-zip-compressed" {
+		return ""
+	}
+
+	if bytes.HasPrefix(content, []byte("%PDF-")) {
+		return DocumentPDF
+	}
+
+	if !bytes.HasPrefix(content, []byte("PK\x03\x04")) {
+		return ""
+	}
+
+	ext := strings.ToLower(path.Ext(strings.SplitN(strings.SplitN(rawURL, "?", 2)[0], "#", 2)[0]))
+	switch ext {
+	case ".docx", ".xlsx", ".pptx", ".epub", ".odt":
+		return strings.TrimPrefix(ext, ".")
+	}
+
+	// Sin extensión reconocible, inspeccionar la estructura interna del ZIP
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return ""
+	}
+	for _, f := range zr.File {
+		switch f.Name {
+		case "word/document.xml":
+			return DocumentDOCX
+		case "xl/workbook.xml":
+			return DocumentXLSX
+		case "ppt/presentation.xml":
+			return DocumentPPTX
+		case "META-INF/container.xml":
+			return DocumentEPUB
+		}
+	}
+	if mimetype, err := readZipFile(zr, "mimetype"); err == nil {
+		if docType, ok := documentContentTypes[strings.TrimSpace(string(mimetype))]; ok {
+			return docType
+		}
+	}
+
+	return ""
+}
+
+// ExtractDocument convierte un documento PDF u Office en texto plano y markdown.
+// Las tablas de las hojas de cálculo se conservan como tablas markdown.
+func ExtractDocument(docType string, content []byte) (result *DocumentResult, err error) {
+	// Los parsers de terceros pueden entrar en pánico con archivos corruptos
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = &ToolError{Message: fmt.Sprintf("documento %s inválido: %v", docType, r)}
+		}
+	}()
+
+	switch docType {
+	case DocumentPDF:
+		return extractPDF(content)
+	case DocumentDOCX:
+		return extractDOCX(content)
+	case DocumentXLSX:
+		return extractXLSX(content)
+	case DocumentPPTX:
+		return extractPPTX(content)
+	case DocumentEPUB:
+		return extractEPUB(content)
+	case DocumentODT:
+		return extractODT(content)
+	default:
+		return nil, &ToolError{Message: "tipo de documento no soportado: " + docType}
+	}
+}
+
+// extractPDF extrae el texto de cada página de un PDF
+func extractPDF(content []byte) (*DocumentResult, error) {
+	reader, err := pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir el PDF: %v", err)
+	}
+
+	numPages := reader.NumPage()
+	fonts := make(map[string]*pdf.Font)
+	var pages []string
+	for i := 1; i <= numPages; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		for _, name := range page.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				f := page.Font(name)
+				fonts[name] = &f
+			}
+		}
+		text, err := page.GetPlainText(fonts)
+		if err != nil {
+			return nil, fmt.Errorf("error al extraer texto de la página %d: %v", i, err)
+		}
+		pages = append(pages, strings.TrimSpace(text))
+	}
+
+	metadata := map[string]interface{}{
+		"document_type": DocumentPDF,
+		"pages":         numPages,
+	}
+	info := reader.Trailer().Key("Info")
+	if title := strings.TrimSpace(info.Key("Title").Text()); title != "" {
+		metadata["title"] = title
+	}
+	if author := strings.TrimSpace(info.Key("Author").Text()); author != "" {
+		metadata["author"] = author
+	}
+
+	text := strings.Join(pages, "\n\n")
+	return &DocumentResult{
+		Type:     DocumentPDF,
+		Text:     text,
+		Markdown: text,
+		Metadata: metadata,
+	}, nil
+}
+
+// docBlock es un bloque de contenido de un documento de texto (DOCX, ODT, PPTX)
+type docBlock struct {
+	kind  string // heading, paragraph, list, table
+	level int
+	text  string
+	rows  [][]string
+}
+
+// renderBlocks genera el texto plano y el markdown de una lista de bloques
+func renderBlocks(blocks []docBlock) (string, string) {
+	var text, markdown []string
+	for _, b := range blocks {
+		switch b.kind {
+		case "heading":
+			level := b.level
+			if level < 1 {
+				level = 1
+			}
+			if level > 6 {
+				level = 6
+			}
+			text = append(text, b.text)
+			markdown = append(markdown, strings.Repeat("#", level)+" "+b.text)
+		case "list":
+			text = append(text, "- "+b.text)
+			markdown = append(markdown, "- "+b.text)
+		case "table":
+			text = append(text, plainTable(b.rows))
+			markdown = append(markdown, markdownTable(b.rows))
+		default:
+			text = append(text, b.text)
+			markdown = append(markdown, b.text)
+		}
+	}
+	return strings.Join(text, "\n\n"), strings.Join(markdown, "\n\n")
+}
+
+// markdownTable convierte una matriz de celdas en una tabla markdown usando la
+// primera fila como encabezado
+func markdownTable(rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	if width == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	writeRow := func(row []string) {
+		sb.WriteString("|")
+		for i := 0; i < width; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = strings.ReplaceAll(row[i], "|", "\\|")
+				cell = strings.ReplaceAll(cell, "\n", " ")
+			}
+			sb.WriteString(" " + cell + " |")
+		}
+		sb.WriteString("\n")
+	}
+
+	writeRow(rows[0])
+	sb.WriteString("|")
+	for i := 0; i < width; i++ {
+		sb.WriteString(" --- |")
+	}
+	sb.WriteString("\n")
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// plainTable convierte una matriz de celdas en texto separado por tabuladores
+func plainTable(rows [][]string) string {
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		lines = append(lines, strings.Join(row, "\t"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// openZip abre el contenido como archivo ZIP
+func openZip(content []byte) (*zip.Reader, error) {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir el documento: %v", err)
+	}
+	return zr, nil
+}
+
+// readZipFile lee un archivo interno del ZIP respetando maxDocumentEntrySize
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		data, err := io.ReadAll(io.LimitReader(rc, maxDocumentEntrySize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxDocumentEntrySize {
+			return nil, fmt.Errorf("el archivo %s excede el tamaño máximo permitido", name)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("no se encontró %s en el documento", name)
+}
+
+// xmlAttr devuelve el valor de un atributo por su nombre local
+func xmlAttr(el xml.StartElement, local string) string {
+	for _, attr := range el.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// readCoreProperties extrae título y autor de docProps/core.xml (OOXML) o meta.xml (ODF)
+func readCoreProperties(zr *zip.Reader, name string, metadata map[string]interface{}) {
+	data, err := readZipFile(zr, name)
+	if err != nil {
+		return
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var current string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			current = t.Name.Local
+			if t.Name.Local == "document-statistic" {
+				if pages, err := strconv.Atoi(xmlAttr(t, "page-count")); err == nil {
+					metadata["pages"] = pages
+				}
+			}
+		case xml.CharData:
+			value := strings.TrimSpace(string(t))
+			if value == "" {
+				continue
+			}
+			switch current {
+			case "title":
+				metadata["title"] = value
+			case "creator", "initial-creator":
+				if _, ok := metadata["author"]; !ok {
+					metadata["author"] = value
+				}
+			}
+		case xml.EndElement:
+			current = ""
+		}
+	}
+}
+
+// blockBuilder acumula bloques mientras se recorre un documento XML de texto
+type blockBuilder struct {
+	blocks     []docBlock
+	current    strings.Builder
+	kind       string
+	level      int
+	tableDepth int
+	rows       [][]string
+	cell       []string
+}
+
+func (b *blockBuilder) startParagraph(kind string, level int) {
+	b.current.Reset()
+	b.kind = kind
+	b.level = level
+}
+
+func (b *blockBuilder) endParagraph() {
+	text := strings.TrimSpace(b.current.String())
+	b.current.Reset()
+	if text == "" {
+		return
+	}
+	if b.tableDepth > 0 {
+		b.cell = append(b.cell, text)
+		return
+	}
+	b.blocks = append(b.blocks, docBlock{kind: b.kind, level: b.level, text: text})
+}
+
+func (b *blockBuilder) startTable() {
+	b.tableDepth++
+	if b.tableDepth == 1 {
+		b.rows = nil
+	}
+}
+
+func (b *blockBuilder) endTable() {
+	b.tableDepth--
+	if b.tableDepth == 0 && len(b.rows) > 0 {
+		b.blocks = append(b.blocks, docBlock{kind: "table", rows: b.rows})
+		b.rows = nil
+	}
+}
+
+func (b *blockBuilder) startRow() {
+	if b.tableDepth == 1 {
+		b.rows = append(b.rows, []string{})
+	}
+}
+
+func (b *blockBuilder) startCell() {
+	if b.tableDepth == 1 {
+		b.cell = nil
+	}
+}
+
+func (b *blockBuilder) endCell(repeat int) {
+	if b.tableDepth != 1 || len(b.rows) == 0 {
+		return
+	}
+	last := len(b.rows) - 1
+	value := strings.Join(b.cell, " ")
+	for i := 0; i < repeat; i++ {
+		b.rows[last] = append(b.rows[last], value)
+	}
+	b.cell = nil
+}
+
+// headingLevel interpreta estilos de párrafo como "Heading2" o "Title"
+func headingLevel(style string) int {
+	lower := strings.ToLower(strings.ReplaceAll(style, " ", ""))
+	if lower == "title" {
+		return 1
+	}
+	for _, prefix := range []string{"heading", "título", "titulo"} {
+		if strings.HasPrefix(lower, prefix) {
+			if n, err := strconv.Atoi(strings.TrimPrefix(lower, prefix)); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// extractDOCX extrae párrafos, encabezados, listas y tablas de un documento Word
+func extractDOCX(content []byte) (*DocumentResult, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readZipFile(zr, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &blockBuilder{}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error al leer el documento Word: %v", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				b.startParagraph("paragraph", 0)
+			case "pStyle":
+				if level := headingLevel(xmlAttr(t, "val")); level > 0 {
+					b.kind, b.level = "heading", level
+				}
+			case "numPr":
+				if b.kind == "paragraph" {
+					b.kind = "list"
+				}
+			case "t":
+				inText = true
+			case "tab":
+				b.current.WriteString("\t")
+			case "br", "cr":
+				b.current.WriteString("\n")
+			case "tbl":
+				b.startTable()
+			case "tr":
+				b.startRow()
+			case "tc":
+				b.startCell()
+			}
+		case xml.CharData:
+			if inText {
+				b.current.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.endParagraph()
+			case "tc":
+				b.endCell(1)
+			case "tbl":
+				b.endTable()
+			}
+		}
+	}
+
+	metadata := map[string]interface{}{
+		"document_type": DocumentDOCX,
+	}
+	readCoreProperties(zr, "docProps/core.xml", metadata)
+	readAppPages(zr, metadata)
+
+	text, markdown := renderBlocks(b.blocks)
+	return &DocumentResult{
+		Type:     DocumentDOCX,
+		Text:     text,
+		Markdown: markdown,
+		Metadata: metadata,
+	}, nil
+}
+
+// readAppPages lee el número de páginas de docProps/app.xml si está disponible
+func readAppPages(zr *zip.Reader, metadata map[string]interface{}) {
+	data, err := readZipFile(zr, "docProps/app.xml")
+	if err != nil {
+		return
+	}
+	var app struct {
+		Pages string `xml:"Pages"`
+	}
+	if err := xml.Unmarshal(data, &app); err != nil {
+		return
+	}
+	if pages, err := strconv.Atoi(strings.TrimSpace(app.Pages)); err == nil && pages > 0 {
+		metadata["pages"] = pages
+	}
+}
+
+// extractODT extrae el contenido de un documento OpenDocument de texto
+func extractODT(content []byte) (*DocumentResult, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readZipFile(zr, "content.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &blockBuilder{}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	inBody := false
+	listDepth := 0
+	repeats := []int{}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error al leer el documento ODT: %v", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "body":
+				inBody = true
+			case "h":
+				level, _ := strconv.Atoi(xmlAttr(t, "outline-level"))
+				if level < 1 {
+					level = 1
+				}
+				b.startParagraph("heading", level)
+			case "p":
+				if listDepth > 0 {
+					b.startParagraph("list", 0)
+				} else {
+					b.startParagraph("paragraph", 0)
+				}
+			case "list":
+				listDepth++
+			case "s":
+				count, _ := strconv.Atoi(xmlAttr(t, "c"))
+				if count < 1 {
+					count = 1
+				}
+				b.current.WriteString(strings.Repeat(" ", count))
+			case "tab":
+				b.current.WriteString("\t")
+			case "line-break":
+				b.current.WriteString("\n")
+			case "table":
+				b.startTable()
+			case "table-row":
+				b.startRow()
+			case "table-cell":
+				repeat, _ := strconv.Atoi(xmlAttr(t, "number-columns-repeated"))
+				if repeat < 1 || repeat > 64 {
+					repeat = 1
+				}
+				repeats = append(repeats, repeat)
+				b.startCell()
+			}
+		case xml.CharData:
+			if inBody {
+				b.current.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "h", "p":
+				b.endParagraph()
+			case "list":
+				listDepth--
+			case "table-cell":
+				repeat := 1
+				if len(repeats) > 0 {
+					repeat = repeats[len(repeats)-1]
+					repeats = repeats[:len(repeats)-1]
+				}
+				b.endCell(repeat)
+			case "table":
+				b.endTable()
+			}
+		}
+	}
+
+	metadata := map[string]interface{}{
+		"document_type": DocumentODT,
+	}
+	readCoreProperties(zr, "meta.xml", metadata)
+
+	text, markdown := renderBlocks(b.blocks)
+	return &DocumentResult{
+		Type:     DocumentODT,
+		Text:     text,
+		Markdown: markdown,
+		Metadata: metadata,
+	}, nil
+}
+
+// zipRelationships lee un archivo .rels de OOXML y devuelve Id -> ruta absoluta
+func zipRelationships(zr *zip.Reader, relsPath, baseDir string) map[string]string {
+	rels := make(map[string]string)
+	data, err := readZipFile(zr, relsPath)
+	if err != nil {
+		return rels
+	}
+	var parsed struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xml.Unmarshal(data, &parsed); err != nil {
+		return rels
+	}
+	for _, rel := range parsed.Relationships {
+		target := rel.Target
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join(baseDir, target)
+		}
+		rels[rel.ID] = target
+	}
+	return rels
+}
+
+// extractXLSX convierte cada hoja de un libro de Excel en una tabla
+func extractXLSX(content []byte) (*DocumentResult, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+
+	workbookData, err := readZipFile(zr, "xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	var workbook struct {
+		Sheets []struct {
+			Name string     `xml:"name,attr"`
+			Attr []xml.Attr `xml:",any,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(workbookData, &workbook); err != nil {
+		return nil, fmt.Errorf("error al leer el libro de Excel: %v", err)
+	}
+
+	rels := zipRelationships(zr, "xl/_rels/workbook.xml.rels", "xl")
+	sharedStrings := readSharedStrings(zr)
+
+	var text, markdown []string
+	var sheetNames, truncatedSheets []string
+	for i, sheet := range workbook.Sheets {
+		var relID string
+		for _, attr := range sheet.Attr {
+			if attr.Name.Local == "id" {
+				relID = attr.Value
+			}
+		}
+		sheetPath, ok := rels[relID]
+		if !ok {
+			sheetPath = fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		}
+
+		rows, truncated, err := readSheetRows(zr, sheetPath, sharedStrings)
+		if err != nil {
+			return nil, err
+		}
+		if truncated {
+			truncatedSheets = append(truncatedSheets, sheet.Name)
+		}
+
+		sheetNames = append(sheetNames, sheet.Name)
+		text = append(text, sheet.Name+"\n"+plainTable(rows))
+		section := "## " + sheet.Name
+		if table := markdownTable(rows); table != "" {
+			section += "\n\n" + table
+		}
+		markdown = append(markdown, section)
+	}
+
+	metadata := map[string]interface{}{
+		"document_type": DocumentXLSX,
+		"sheets":        len(sheetNames),
+		"sheet_names":   sheetNames,
+	}
+	if len(truncatedSheets) > 0 {
+		metadata["truncated_sheets"] = truncatedSheets
+	}
+	return &DocumentResult{
+		Type:     DocumentXLSX,
+		Text:     strings.Join(text, "\n\n"),
+		Markdown: strings.Join(markdown, "\n\n"),
+		Metadata: metadata,
+	}, nil
+}
+
+// readSharedStrings lee la tabla de cadenas compartidas de un libro de Excel
+func readSharedStrings(zr *zip.Reader) []string {
+	data, err := readZipFile(zr, "xl/sharedStrings.xml")
+	if err != nil {
+		return nil
+	}
+
+	var strs []string
+	var current strings.Builder
+	inText, inPhonetic := false, false
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return strs
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				current.Reset()
+			case "rPh":
+				inPhonetic = true
+			case "t":
+				inText = true
+			}
+		case xml.CharData:
+			if inText && !inPhonetic {
+				current.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				strs = append(strs, current.String())
+			case "rPh":
+				inPhonetic = false
+			case "t":
+				inText = false
+			}
+		}
+	}
+}
+
+// columnIndex convierte una referencia de celda como "C7" en el índice de columna (0 para A)
+func columnIndex(ref string) int {
+	index := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+	}
+	return index - 1
+}
+
+// readSheetRows lee las celdas de una hoja y devuelve la matriz de valores de
+// las columnas usadas; indica si se cortó al llegar a maxSheetCells
+func readSheetRows(zr *zip.Reader, sheetPath string, sharedStrings []string) ([][]string, bool, error) {
+	data, err := readZipFile(zr, sheetPath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline struct {
+					Text string `xml:",innerxml"`
+				} `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(data, &sheet); err != nil {
+		return nil, false, fmt.Errorf("error al leer la hoja %s: %v", sheetPath, err)
+	}
+
+	// Guardar solo las celdas con valor y las columnas que aparecen en ellas
+	type sheetCell struct {
+		col   int
+		value string
+	}
+	var sparse [][]sheetCell
+	used := map[int]bool{}
+	truncated := false
+	for _, row := range sheet.Rows {
+		var cells []sheetCell
+		newCols := 0
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				col = columnIndex(cell.Ref)
+			}
+			if col < 0 || col > 16383 {
+				continue
+			}
+
+			var value string
+			switch cell.Type {
+			case "s":
+				if idx, err := strconv.Atoi(strings.TrimSpace(cell.Value)); err == nil && idx >= 0 && idx < len(sharedStrings) {
+					value = sharedStrings[idx]
+				}
+			case "inlineStr":
+				value = stripXMLTags(cell.Inline.Text)
+			case "b":
+				if cell.Value == "1" {
+					value = "TRUE"
+				} else {
+					value = "FALSE"
+				}
+			default:
+				value = cell.Value
+			}
+
+			// Omitir celdas vacías (y, por tanto, filas completamente vacías)
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if !used[col] {
+				newCols++
+			}
+			cells = append(cells, sheetCell{col: col, value: value})
+		}
+		if len(cells) == 0 {
+			continue
+		}
+
+		if (len(sparse)+1)*(len(used)+newCols) > maxSheetCells {
+			truncated = true
+			break
+		}
+		for _, cell := range cells {
+			used[cell.col] = true
+		}
+		sparse = append(sparse, cells)
+	}
+
+	// Las columnas sin ningún valor no se incluyen en la tabla
+	cols := make([]int, 0, len(used))
+	for col := range used {
+		cols = append(cols, col)
+	}
+	sort.Ints(cols)
+	position := make(map[int]int, len(cols))
+	for i, col := range cols {
+		position[col] = i
+	}
+
+	rows := make([][]string, 0, len(sparse))
+	for _, cells := range sparse {
+		values := make([]string, len(cols))
+		for _, cell := range cells {
+			values[position[cell.col]] = cell.value
+		}
+		rows = append(rows, values)
+	}
+	return rows, truncated, nil
+}
+
+// stripXMLTags devuelve únicamente el texto de un fragmento XML
+func stripXMLTags(fragment string) string {
+	var sb strings.Builder
+	dec := xml.NewDecoder(strings.NewReader("<root>" + fragment + "</root>"))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return sb.String()
+		}
+		if data, ok := tok.(xml.CharData); ok {
+			sb.Write(data)
+		}
+	}
+}
+
+// extractPPTX extrae el texto de cada diapositiva de una presentación
+func extractPPTX(content []byte) (*DocumentResult, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ordenar las diapositivas según presentation.xml y, si falla, por número de archivo
+	var slidePaths []string
+	if data, err := readZipFile(zr, "ppt/presentation.xml"); err == nil {
+		var presentation struct {
+			Slides []struct {
+				Attr []xml.Attr `xml:",any,attr"`
+			} `xml:"sldIdLst>sldId"`
+		}
+		if xml.Unmarshal(data, &presentation) == nil {
+			rels := zipRelationships(zr, "ppt/_rels/presentation.xml.rels", "ppt")
+			for _, slide := range presentation.Slides {
+				for _, attr := range slide.Attr {
+					if attr.Name.Local == "id" && attr.Name.Space != "" {
+						if target, ok := rels[attr.Value]; ok {
+							slidePaths = append(slidePaths, target)
+						}
+					}
+				}
+			}
+		}
+	}
+	if len(slidePaths) == 0 {
+		for _, f := range zr.File {
+			if strings.HasPrefix(f.Name, "ppt/slides/slide") && strings.HasSuffix(f.Name, ".xml") {
+				slidePaths = append(slidePaths, f.Name)
+			}
+		}
+		sort.Slice(slidePaths, func(i, j int) bool {
+			return slideNumber(slidePaths[i]) < slideNumber(slidePaths[j])
+		})
+	}
+
+	var blocks []docBlock
+	for i, slidePath := range slidePaths {
+		data, err := readZipFile(zr, slidePath)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, docBlock{kind: "heading", level: 2, text: fmt.Sprintf("Diapositiva %d", i+1)})
+
+		b := &blockBuilder{}
+		inText := false
+		dec := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error al leer la diapositiva %d: %v", i+1, err)
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				switch t.Name.Local {
+				case "p":
+					b.startParagraph("paragraph", 0)
+				case "t":
+					inText = true
+				case "br":
+					b.current.WriteString("\n")
+				case "tbl":
+					b.startTable()
+				case "tr":
+					b.startRow()
+				case "tc":
+					b.startCell()
+				}
+			case xml.CharData:
+				if inText {
+					b.current.Write(t)
+				}
+			case xml.EndElement:
+				switch t.Name.Local {
+				case "t":
+					inText = false
+				case "p":
+					b.endParagraph()
+				case "tc":
+					b.endCell(1)
+				case "tbl":
+					b.endTable()
+				}
+			}
+		}
+		blocks = append(blocks, b.blocks...)
+	}
+
+	text, markdown := renderBlocks(blocks)
+	return &DocumentResult{
+		Type:     DocumentPPTX,
+		Text:     text,
+		Markdown: markdown,
+		Metadata: map[string]interface{}{
+			"document_type": DocumentPPTX,
+			"slides":        len(slidePaths),
+		},
+	}, nil
+}
+
+// slideNumber obtiene el número de "ppt/slides/slide12.xml"
+func slideNumber(name string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path.Base(name), "slide"), ".xml"))
+	return n
+}
+
+// extractEPUB convierte los capítulos de un libro EPUB siguiendo el orden del spine
+func extractEPUB(content []byte) (*DocumentResult, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+
+	containerData, err := readZipFile(zr, "META-INF/container.xml")
+	if err != nil {
+		return nil, err
+	}
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := xml.Unmarshal(containerData, &container); err != nil || len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("no se encontró el paquete OPF del EPUB")
+	}
+
+	opfPath := container.Rootfiles[0].FullPath
+	opfData, err := readZipFile(zr, opfPath)
+	if err != nil {
+		return nil, err
+	}
+	var pkg struct {
+		Title    []string `xml:"metadata>title"`
+		Creator  []string `xml:"metadata>creator"`
+		Language []string `xml:"metadata>language"`
+		Items    []struct {
+			ID        string `xml:"id,attr"`
+			Href      string `xml:"href,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}
+	if err := xml.Unmarshal(opfData, &pkg); err != nil {
+		return nil, fmt.Errorf("error al leer el paquete OPF: %v", err)
+	}
+
+	manifest := make(map[string]string)
+	for _, item := range pkg.Items {
+		if strings.Contains(item.MediaType, "html") {
+			manifest[item.ID] = path.Join(path.Dir(opfPath), item.Href)
+		}
+	}
+
+	converter := md.NewConverter("", true, nil)
+	var text, markdown []string
+	chapters := 0
+	for _, ref := range pkg.Spine {
+		chapterPath, ok := manifest[ref.IDRef]
+		if !ok {
+			continue
+		}
+		data, err := readZipFile(zr, chapterPath)
+		if err != nil {
+			continue
+		}
+
+		chapterMarkdown, err := converter.ConvertString(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("error al convertir el capítulo %s: %v", chapterPath, err)
+		}
+		chapterText, err := html2text.FromString(string(data), html2text.Options{PrettyTables: true})
+		if err != nil {
+			return nil, fmt.Errorf("error al convertir el capítulo %s: %v", chapterPath, err)
+		}
+
+		chapterMarkdown = strings.TrimSpace(chapterMarkdown)
+		chapterText = strings.TrimSpace(chapterText)
+		if chapterMarkdown == "" && chapterText == "" {
+			continue
+		}
+		chapters++
+		markdown = append(markdown, chapterMarkdown)
+		text = append(text, chapterText)
+	}
+
+	metadata := map[string]interface{}{
+		"document_type": DocumentEPUB,
+		"chapters":      chapters,
+	}
+	if len(pkg.Title) > 0 && strings.TrimSpace(pkg.Title[0]) != "" {
+		metadata["title"] = strings.TrimSpace(pkg.Title[0])
+	}
+	if len(pkg.Creator) > 0 && strings.TrimSpace(pkg.Creator[0]) != "" {
+		metadata["author"] = strings.TrimSpace(pkg.Creator[0])
+	}
+	if len(pkg.Language) > 0 && strings.TrimSpace(pkg.Language[0]) != "" {
+		metadata["language"] = strings.TrimSpace(pkg.Language[0])
+	}
+
+	return &DocumentResult{
+		Type:     DocumentEPUB,
+		Text:     strings.Join(text, "\n\n"),
+		Markdown: strings.Join(markdown, "\n\n"),
+		Metadata: metadata,
+	}, nil
+}
@@ -1,6 +1,8 @@
 package tools
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -15,18 +17,18 @@ type DuckDuckGoSearchResult struct {
 	Metadata map[string]interface{} `json:"metadata"`
 }
 
-type resultItem struct {
-	Title     string
-	Link      string
-	Snippet   string
-	Thumbnail string
-}
-
-// WebSearch realiza una búsqueda web utilizando DuckDuckGo
+// WebSearch realiza una búsqueda web con el proveedor elegido (DuckDuckGo por defecto)
 //
 // Parámetros:
 //   - query: La consulta de búsqueda (requerido)
-//   - max_results: Número máximo de resultados (opcional, por defecto 5, máximo 10)
+//   - max_results: Número máximo de resultados (opcional, por defecto 5, máximo 50)
+//   - provider, fallback: Proveedor preferido y si se prueban otros cuando falla
+//   - region: Código de región de DuckDuckGo (kl), p. ej. "es-es" (opcional, por defecto "wt-wt")
+//   - safe_search: "strict", "moderate" u "off" (opcional, por defecto "moderate")
+//   - time_range: "day", "week", "month" o "year" (opcional)
+//   - page, offset: Paginación (opcional)
+//   - site, exclude_site: Restringir o excluir dominios (opcional)
+//   - search_type: "web", "news", "images" o "videos" (opcional, por defecto "web")
 //
 // Ejemplo de uso:
 //
@@ -35,60 +37,171 @@ type resultItem struct {
 //	    "max_results": 3,
 //	})
 func WebSearch(payload map[string]interface{}) (interface{}, error) {
-	// Parsear parámetros
-	query, ok := payload["query"].(string)
-	if !ok || query == "" {
-		return nil, &ToolError{Message: "el parámetro 'query' es requerido"}
+	opts, err := ParseSearchOptions(payload)
+	if err != nil {
+		return nil, err
 	}
 
-	maxResults := 5
-	if mr, ok := payload["max_results"].(float64); ok {
-		maxResults = int(mr)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	search, err := Search(ctx, opts)
+	if err != nil {
+		return nil, err
 	}
-	if maxResults <= 0 || maxResults > 10 {
-		maxResults = 5
+	if opts.Type != "web" {
+		return formatVerticalResults(opts, search), nil
 	}
+	results := search.Results
+	maxResults := opts.MaxResults
+
+	// Formatear resultados
+	var output strings.Builder
+	metadata := make(map[string]interface{})
+
+	// Metadatos generales
+	metadata["query"] = opts.Query
+	metadata["timestamp"] = time.Now().Format(time.RFC3339)
+	metadata["result_count"] = len(results)
+	metadata["source"] = search.Provider
+	metadata["attempts"] = search.Attempts
+	metadata["options"] = opts.Resolved()
+	metadata["duplicates_removed"] = search.Duplicates
+
+	// Estructura para almacenar los resultados en formato de lista
+	resultsList := []map[string]interface{}{}
 
-	// Crear la URL de búsqueda
-	searchURL := fmt.Sprintf("https://html.duckduckgo.com/html/?q=%s", url.QueryEscape(query))
+	for i, result := range results {
+		// Crear un mapa para el resultado actual
+		resultMap := map[string]interface{}{
+			"position":       i + 1,
+			"title":          result.Title,
+			"url":            result.URL,
+			"description":    result.Description,
+			"display_domain": result.DisplayDomain,
+		}
+		if result.Favicon != "" {
+			resultMap["favicon"] = result.Favicon
+		}
 
-	// Crear cliente HTTP con timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+		// Agregar la URL de la imagen de vista previa si está disponible
+		if result.Thumbnail != "" {
+			resultMap["thumbnail"] = result.Thumbnail
+		}
+
+		// Formatear el resultado actual
+		if thumb, ok := resultMap["thumbnail"]; ok && thumb != "" {
+			output.WriteString(fmt.Sprintf("%d. ![%s](%s) [%s](%s)\n",
+				i+1, result.Title, thumb, result.Title, result.URL))
+		} else {
+			output.WriteString(fmt.Sprintf("%d. [%s](%s)\n", i+1, result.Title, result.URL))
+		}
+		output.WriteString(fmt.Sprintf("   %s\n\n", result.Description))
+
+		// Agregar a la lista de resultados
+		resultsList = append(resultsList, resultMap)
+
+		// Si ya tenemos suficientes resultados, salir
+		if i >= maxResults-1 {
+			break
+		}
 	}
 
-	// Crear la petición
-	req, err := http.NewRequest("GET", searchURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error al crear la petición: %v", err)
+	// Agregar la lista de resultados a los metadatos
+	metadata["results"] = resultsList
+	if len(resultsList) == 0 {
+		output.WriteString("No se encontraron resultados para la búsqueda: " + opts.Query + "\n")
 	}
 
-	// Añadir headers para parecer un navegador
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
+	return &DuckDuckGoSearchResult{
+		Output:   output.String(),
+		Metadata: metadata,
+	}, nil
+}
 
-	// Realizar la petición
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error al realizar la petición: %v", err)
+// formatVerticalResults da formato a los resultados de noticias, imágenes o vídeos
+func formatVerticalResults(opts *SearchOptions, search *SearchResponse) *DuckDuckGoSearchResult {
+	var output strings.Builder
+	metadata := map[string]interface{}{
+		"query":        opts.Query,
+		"search_type":  opts.Type,
+		"timestamp":    time.Now().Format(time.RFC3339),
+		"result_count": search.Count(),
+		"source":       search.Provider,
+		"attempts":     search.Attempts,
+		"options":      opts.Resolved(),
 	}
-	defer resp.Body.Close()
 
-	// Parsear el HTML de la respuesta
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error al parsear el HTML: %v", err)
+	switch opts.Type {
+	case "news":
+		for i, r := range search.News {
+			fmt.Fprintf(&output, "%d. [%s](%s)\n", i+1, r.Title, r.URL)
+			if r.Source != "" || r.Published != "" {
+				fmt.Fprintf(&output, "   %s", r.Source)
+				if r.Published != "" {
+					fmt.Fprintf(&output, " · %s", r.Published)
+				}
+				output.WriteString("\n")
+			}
+			fmt.Fprintf(&output, "   %s\n\n", r.Excerpt)
+		}
+		metadata["results"] = search.News
+	case "images":
+		for i, r := range search.Images {
+			thumbnail := r.Thumbnail
+			if thumbnail == "" {
+				thumbnail = r.ImageURL
+			}
+			fmt.Fprintf(&output, "%d. ![%s](%s) [%s](%s)\n", i+1, r.Title, thumbnail, r.Title, r.SourcePage)
+			if r.Width > 0 && r.Height > 0 {
+				fmt.Fprintf(&output, "   %dx%d · %s\n\n", r.Width, r.Height, r.ImageURL)
+			} else {
+				fmt.Fprintf(&output, "   %s\n\n", r.ImageURL)
+			}
+		}
+		metadata["results"] = search.Images
+	case "videos":
+		for i, r := range search.Videos {
+			fmt.Fprintf(&output, "%d. [%s](%s)\n", i+1, r.Title, r.URL)
+			var details []string
+			for _, d := range []string{r.Publisher, r.Duration, r.Published} {
+				if d != "" {
+					details = append(details, d)
+				}
+			}
+			if len(details) > 0 {
+				fmt.Fprintf(&output, "   %s\n", strings.Join(details, " · "))
+			}
+			fmt.Fprintf(&output, "   %s\n\n", r.Description)
+		}
+		metadata["results"] = search.Videos
 	}
 
-	// Extraer resultados de búsqueda
-	var results []resultItem
+	return &DuckDuckGoSearchResult{
+		Output:   output.String(),
+		Metadata: metadata,
+	}
+}
 
-	doc.Find(".result").Each(func(i int, s *goquery.Selection) {
-		if i >= maxResults {
-			return
-		}
+// DuckDuckGoHTMLURL es el endpoint HTML de DuckDuckGo
+var DuckDuckGoHTMLURL = "https://html.duckduckgo.com/html/"
 
+// duckDuckGoHTMLProvider extrae los resultados de html.duckduckgo.com
+type duckDuckGoHTMLProvider struct {
+	endpoint string
+}
+
+func (p *duckDuckGoHTMLProvider) Name() string     { return "duckduckgo" }
+func (p *duckDuckGoHTMLProvider) Configured() bool { return p.endpoint != "" }
+
+func (p *duckDuckGoHTMLProvider) Search(ctx context.Context, opts *SearchOptions) ([]SearchResult, error) {
+	return searchDuckDuckGo(ctx, p.endpoint, opts, parseDuckDuckGoHTML)
+}
+
+// parseDuckDuckGoHTML extrae los resultados de una página de html.duckduckgo.com
+func parseDuckDuckGoHTML(doc *goquery.Document) []SearchResult {
+	results := []SearchResult{}
+	doc.Find(".result").Not(".result--ad").Each(func(i int, s *goquery.Selection) {
 		title := strings.TrimSpace(s.Find(".result__title").Text())
 		link, _ := s.Find(".result__title a").Attr("href")
 		snippet := strings.TrimSpace(s.Find(".result__snippet").Text())
@@ -104,76 +217,194 @@ func WebSearch(payload map[string]interface{}) (interface{}, error) {
 		}
 
 		if title != "" && link != "" {
-			item := resultItem{
-				Title:     title,
-				Link:      link,
-				Snippet:   snippet,
-				Thumbnail: thumbnailURL,
-			}
-			results = append(results, item)
+			results = append(results, SearchResult{
+				Title:       title,
+				URL:         unwrapSearchURL(link),
+				Description: snippet,
+				Thumbnail:   thumbnailURL,
+			})
 		}
 	})
+	return results
+}
+
+// duckDuckGoLiteProvider extrae los resultados de lite.duckduckgo.com, cuyo
+// marcado es una tabla sencilla que cambia con menos frecuencia
+type duckDuckGoLiteProvider struct {
+	endpoint string
+}
+
+func (p *duckDuckGoLiteProvider) Name() string     { return "duckduckgo_lite" }
+func (p *duckDuckGoLiteProvider) Configured() bool { return p.endpoint != "" }
 
-	// Si no se encontraron resultados, devolver un mensaje
-	if len(results) == 0 {
-		results = append(results, resultItem{
-			Title:     "No se encontraron resultados",
-			Link:      "",
-			Snippet:   "No se encontraron resultados para la búsqueda: " + query,
-			Thumbnail: "",
+func (p *duckDuckGoLiteProvider) Search(ctx context.Context, opts *SearchOptions) ([]SearchResult, error) {
+	return searchDuckDuckGo(ctx, p.endpoint, opts, parseDuckDuckGoLite)
+}
+
+// parseDuckDuckGoLite extrae los resultados de una página de lite.duckduckgo.com.
+// Cada resultado ocupa varias filas: enlace, fragmento y URL visible.
+func parseDuckDuckGoLite(doc *goquery.Document) []SearchResult {
+	results := []SearchResult{}
+	snippets := doc.Find(".result-snippet")
+	doc.Find("a.result-link").Each(func(i int, s *goquery.Selection) {
+		title := strings.TrimSpace(s.Text())
+		link, _ := s.Attr("href")
+		if title == "" || link == "" {
+			return
+		}
+		results = append(results, SearchResult{
+			Title:       title,
+			URL:         unwrapSearchURL(link),
+			Description: strings.TrimSpace(snippets.Eq(i).Text()),
 		})
-	}
+	})
+	return results
+}
 
-	// Formatear resultados
-	var output strings.Builder
-	metadata := make(map[string]interface{})
+// duckDuckGoParams traduce las opciones a los parámetros del formulario de DuckDuckGo
+func duckDuckGoParams(opts *SearchOptions) url.Values {
+	params := url.Values{
+		"q":  {opts.EffectiveQuery()},
+		"kl": {opts.Region},
+		"kp": {map[string]string{"strict": "1", "moderate": "-1", "off": "-2"}[opts.SafeSearch]},
+	}
+	if opts.TimeRange != "" {
+		params.Set("df", opts.TimeRange[:1])
+	}
+	if opts.Offset > 0 {
+		params.Set("s", fmt.Sprint(opts.Offset))
+		params.Set("dc", fmt.Sprint(opts.Offset+1))
+	}
+	return params
+}
 
-	// Metadatos generales
-	metadata["query"] = query
-	metadata["timestamp"] = time.Now().Format(time.RFC3339)
-	metadata["result_count"] = len(results)
-	metadata["source"] = "duckduckgo"
+// searchDuckDuckGo consulta DuckDuckGo y sigue el formulario de página
+// siguiente para saltar hasta opts.Page y completar opts.MaxResults
+func searchDuckDuckGo(ctx context.Context, endpoint string, opts *SearchOptions, parse func(*goquery.Document) []SearchResult) ([]SearchResult, error) {
+	doc, err := fetchDuckDuckGoPage(ctx, http.MethodGet, endpoint, duckDuckGoParams(opts))
+	if err != nil {
+		return nil, err
+	}
 
-	// Estructura para almacenar los resultados en formato de lista
-	var resultsList []map[string]interface{}
+	// Saltar páginas siguiendo los formularios "Next", que llevan el estado de la paginación
+	if opts.Offset == 0 {
+		for page := 1; page < opts.Page; page++ {
+			action, params, ok := duckDuckGoNextPage(doc, endpoint)
+			if !ok {
+				return []SearchResult{}, nil
+			}
+			if doc, err = fetchDuckDuckGoPage(ctx, http.MethodPost, action, params); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-	for i, result := range results {
-		// Crear un mapa para el resultado actual
-		resultMap := map[string]interface{}{
-			"position":    i + 1,
-			"title":       result.Title,
-			"url":         result.Link,
-			"description": result.Snippet,
+	results := parse(doc)
+	for pages := 1; len(results) < opts.MaxResults && pages < maxSearchPages; pages++ {
+		action, params, ok := duckDuckGoNextPage(doc, endpoint)
+		if !ok {
+			break
 		}
+		if doc, err = fetchDuckDuckGoPage(ctx, http.MethodPost, action, params); err != nil {
+			// Devolver lo que ya se tiene si falla una página posterior
+			break
+		}
+		more := parse(doc)
+		if len(more) == 0 {
+			break
+		}
+		results = append(results, more...)
+	}
+	return results, nil
+}
 
-		// Agregar la URL de la imagen de vista previa si está disponible
-		if result.Thumbnail != "" {
-			resultMap["thumbnail"] = result.Thumbnail
+// duckDuckGoNextPage busca el formulario de la página siguiente y devuelve su
+// destino y sus campos
+func duckDuckGoNextPage(doc *goquery.Document, endpoint string) (string, url.Values, bool) {
+	var form *goquery.Selection
+	doc.Find("form").EachWithBreak(func(_ int, f *goquery.Selection) bool {
+		submit, _ := f.Find("input[type='submit']").Attr("value")
+		if strings.Contains(strings.ToLower(submit), "next") {
+			form = f
+			return false
 		}
+		return true
+	})
+	if form == nil {
+		return "", nil, false
+	}
 
-		// Formatear el resultado actual
-		if thumb, ok := resultMap["thumbnail"]; ok && thumb != "" {
-			output.WriteString(fmt.Sprintf("%d. ![%s](%s) [%s](%s)\n", 
-				i+1, result.Title, thumb, result.Title, result.Link))
-		} else {
-			output.WriteString(fmt.Sprintf("%d. [%s](%s)\n", i+1, result.Title, result.Link))
+	params := url.Values{}
+	form.Find("input[name]").Each(func(_ int, input *goquery.Selection) {
+		if inputType, _ := input.Attr("type"); inputType == "submit" {
+			return
 		}
-		output.WriteString(fmt.Sprintf("   %s\n\n", result.Snippet))
+		name, _ := input.Attr("name")
+		value, _ := input.Attr("value")
+		params.Add(name, value)
+	})
 
-		// Agregar a la lista de resultados
-		resultsList = append(resultsList, resultMap)
+	action := endpoint
+	if href, ok := form.Attr("action"); ok && href != "" {
+		if base, err := url.Parse(endpoint); err == nil {
+			if resolved, err := base.Parse(href); err == nil {
+				action = resolved.String()
+			}
+		}
+	}
+	return action, params, true
+}
 
-		// Si ya tenemos suficientes resultados, salir
-		if i >= maxResults-1 {
-			break
+// unwrapSearchURL extrae el destino real de los enlaces de redirección de DuckDuckGo
+// (//duckduckgo.com/l/?uddg=...)
+func unwrapSearchURL(link string) string {
+	if strings.HasPrefix(link, "//") {
+		link = "https:" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	if strings.HasSuffix(u.Host, "duckduckgo.com") && strings.HasPrefix(u.Path, "/l/") {
+		if target := u.Query().Get("uddg"); target != "" {
+			return target
 		}
 	}
+	return link
+}
+
+// isDuckDuckGoChallenge detecta la página de verificación anti-bots que
+// DuckDuckGo devuelve en lugar de resultados
+func isDuckDuckGoChallenge(doc *goquery.Document) bool {
+	if doc.Find(".anomaly-modal, #challenge-form, form[action*='anomaly']").Length() > 0 {
+		return true
+	}
+	text := strings.ToLower(doc.Find("body").Text())
+	return strings.Contains(text, "bots use duckduckgo too") || strings.Contains(text, "unfortunately, bots use")
+}
 
-	// Agregar la lista de resultados a los metadatos
-	metadata["results"] = resultsList
+// errSearchBlocked es el error de una búsqueda bloqueada por la verificación anti-bots
+func errSearchBlocked(provider string) error {
+	return &ToolError{Code: "search_blocked", Message: provider + " bloqueó la búsqueda con una verificación anti-bots"}
+}
 
-	return &DuckDuckGoSearchResult{
-		Output:   output.String(),
-		Metadata: metadata,
-	}, nil
+// fetchDuckDuckGoPage descarga y parsea una página de resultados de DuckDuckGo
+func fetchDuckDuckGoPage(ctx context.Context, method, endpoint string, params url.Values) (*goquery.Document, error) {
+	body, err := searchRequest(ctx, method, endpoint, params, map[string]string{
+		"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8",
+		"Accept-Language": "en-US,en;q=0.5",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Parsear el HTML de la respuesta
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error al parsear el HTML: %v", err)
+	}
+	if isDuckDuckGoChallenge(doc) {
+		return nil, errSearchBlocked("DuckDuckGo")
+	}
+	return doc, nil
 }
@@ -0,0 +1,677 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	defaultFeedItems      = 50
+	maxFeedItems          = 500
+	maxFullContentItems   = 20
+	fullContentConcurrent = 4
+)
+
+// feedContentTypes son los tipos MIME que identifican un feed en <link rel="alternate">.
+// application/json no se incluye: WordPress lo usa para su API REST (wp-json).
+var feedContentTypes = map[string]string{
+	"application/rss+xml":   "rss",
+	"application/atom+xml":  "atom",
+	"application/feed+json": "json",
+	"application/rdf+xml":   "rss",
+}
+
+// FeedLink es un feed anunciado por una página HTML
+type FeedLink struct {
+	URL   string `json:"url"`
+	Type  string `json:"type"`
+	Title string `json:"title,omitempty"`
+}
+
+// FeedEnclosure es un archivo adjunto de un elemento (podcast, imagen...)
+type FeedEnclosure struct {
+	URL    string `json:"url"`
+	Type   string `json:"type,omitempty"`
+	Length int64  `json:"length,omitempty"`
+}
+
+// FeedItem es un elemento normalizado de RSS, Atom o JSON Feed
+type FeedItem struct {
+	ID          string          `json:"id,omitempty"`
+	Title       string          `json:"title"`
+	Link        string          `json:"link,omitempty"`
+	Published   string          `json:"published,omitempty"`
+	Updated     string          `json:"updated,omitempty"`
+	Author      string          `json:"author,omitempty"`
+	Summary     string          `json:"summary,omitempty"`
+	Content     string          `json:"content,omitempty"`
+	Enclosures  []FeedEnclosure `json:"enclosures,omitempty"`
+	FullContent string          `json:"full_content,omitempty"`
+	FetchError  string          `json:"fetch_error,omitempty"`
+
+	date time.Time
+}
+
+// Feed es un feed normalizado
+type Feed struct {
+	Type        string     `json:"type"`
+	Version     string     `json:"version,omitempty"`
+	Title       string     `json:"title"`
+	Link        string     `json:"link,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Items       []FeedItem `json:"items"`
+}
+
+// FeedOptions configura la herramienta feed
+type FeedOptions struct {
+	URL           string
+	Since         time.Time
+	Limit         int
+	FullContent   bool
+	RespectRobots bool
+}
+
+// DiscoverFeeds devuelve los feeds anunciados con <link rel="alternate"> en una página
+func DiscoverFeeds(base *url.URL, doc *goquery.Document) []FeedLink {
+	var feeds []FeedLink
+	seen := map[string]bool{}
+	doc.Find("link[rel][href]").Each(func(_ int, s *goquery.Selection) {
+		rel, _ := s.Attr("rel")
+		if !strings.Contains(strings.ToLower(rel), "alternate") {
+			return
+		}
+		mimeType, _ := s.Attr("type")
+		feedType, ok := feedContentTypes[strings.ToLower(strings.TrimSpace(mimeType))]
+		if !ok {
+			return
+		}
+		href, _ := s.Attr("href")
+		resolved, err := base.Parse(strings.TrimSpace(href))
+		if err != nil || seen[resolved.String()] {
+			return
+		}
+		seen[resolved.String()] = true
+		title, _ := s.Attr("title")
+		feeds = append(feeds, FeedLink{URL: resolved.String(), Type: feedType, Title: strings.TrimSpace(title)})
+	})
+	return feeds
+}
+
+// ParseFeedOptions valida el payload de la herramienta feed
+func ParseFeedOptions(payload map[string]interface{}) (*FeedOptions, error) {
+	rawURL, _ := payload["url"].(string)
+	if rawURL == "" {
+		return nil, &ToolError{Code: "missing_url", Message: "se requiere el parámetro 'url' en el payload"}
+	}
+	parsed, err := url.ParseRequestURI(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, &ToolError{Code: "invalid_url", Message: "URL inválida. Debe comenzar con http:// o https://"}
+	}
+
+	opts := &FeedOptions{
+		URL:           parsed.String(),
+		Limit:         defaultFeedItems,
+		RespectRobots: RespectRobots(payload),
+	}
+
+	if v, ok := payload["since"]; ok && v != nil {
+		value, ok := v.(string)
+		since, valid := parseFeedDate(value)
+		if !ok || !valid {
+			return nil, &ToolError{Code: "invalid_feed_options", Message: "el campo 'since' debe ser una fecha (YYYY-MM-DD o RFC 3339)"}
+		}
+		opts.Since = since
+	}
+
+	if v, ok := payload["limit"]; ok && v != nil {
+		n, ok := v.(float64)
+		if !ok || n < 1 || n != float64(int(n)) {
+			return nil, &ToolError{Code: "invalid_feed_options", Message: "el campo 'limit' debe ser un entero positivo"}
+		}
+		opts.Limit = int(n)
+		if opts.Limit > maxFeedItems {
+			opts.Limit = maxFeedItems
+		}
+	}
+
+	if v, ok := payload["full_content"]; ok && v != nil {
+		fullContent, ok := v.(bool)
+		if !ok {
+			return nil, &ToolError{Code: "invalid_feed_options", Message: "el campo 'full_content' debe ser booleano"}
+		}
+		opts.FullContent = fullContent
+	}
+
+	return opts, nil
+}
+
+// feedDateLayouts cubre RFC 822 (RSS), RFC 3339 (Atom, JSON Feed) y variantes habituales
+var feedDateLayouts = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 02 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04 MST",
+	"02 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC822Z,
+	time.RFC822,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseFeedDate interpreta las fechas de los distintos formatos de feed
+func parseFeedDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// formatFeedDate normaliza una fecha a RFC 3339 (o la deja tal cual si no se reconoce)
+func formatFeedDate(value string) (string, time.Time) {
+	if t, ok := parseFeedDate(value); ok {
+		return t.UTC().Format(time.RFC3339), t
+	}
+	return strings.TrimSpace(value), time.Time{}
+}
+
+// Estructuras XML de RSS 0.9x/1.0/2.0
+
+type rssDocument struct {
+	XMLName xml.Name
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+	Items   []rssItem  `xml:"item"` // RSS 0.90/1.0 (RDF) declara los items fuera del canal
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Links       []rssLink `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+// rssLink cubre <link> y los <atom:link rel="self"> que muchos canales incluyen
+type rssLink struct {
+	Text string `xml:",chardata"`
+}
+
+// link devuelve el primer <link> con texto del canal
+func (c rssChannel) link() string {
+	for _, l := range c.Links {
+		if text := strings.TrimSpace(l.Text); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+type rssItem struct {
+	GUID        string `xml:"guid"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Encoded     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Author      string `xml:"author"`
+	Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Enclosures  []struct {
+		URL    string `xml:"url,attr"`
+		Type   string `xml:"type,attr"`
+		Length string `xml:"length,attr"`
+	} `xml:"enclosure"`
+}
+
+// Estructuras XML de Atom 1.0
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// value devuelve el contenido; en type="xhtml" el marcado viene sin escapar
+func (t atomText) value() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomFeed struct {
+	Title    atomText     `xml:"title"`
+	Subtitle atomText     `xml:"subtitle"`
+	Links    []atomLink   `xml:"link"`
+	Authors  []atomAuthor `xml:"author"`
+	Entries  []struct {
+		ID        string       `xml:"id"`
+		Title     atomText     `xml:"title"`
+		Links     []atomLink   `xml:"link"`
+		Published string       `xml:"published"`
+		Updated   string       `xml:"updated"`
+		Authors   []atomAuthor `xml:"author"`
+		Summary   atomText     `xml:"summary"`
+		Content   atomText     `xml:"content"`
+	} `xml:"entry"`
+}
+
+// Estructura de JSON Feed 1.0/1.1
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	Description string           `json:"description"`
+	Author      *jsonFeedAuthor  `json:"author"`
+	Authors     []jsonFeedAuthor `json:"authors"`
+	Items       []struct {
+		ID            interface{}      `json:"id"`
+		URL           string           `json:"url"`
+		ExternalURL   string           `json:"external_url"`
+		Title         string           `json:"title"`
+		ContentHTML   string           `json:"content_html"`
+		ContentText   string           `json:"content_text"`
+		Summary       string           `json:"summary"`
+		DatePublished string           `json:"date_published"`
+		DateModified  string           `json:"date_modified"`
+		Author        *jsonFeedAuthor  `json:"author"`
+		Authors       []jsonFeedAuthor `json:"authors"`
+		Attachments   []struct {
+			URL      string `json:"url"`
+			MimeType string `json:"mime_type"`
+			Size     int64  `json:"size_in_bytes"`
+		} `json:"attachments"`
+	} `json:"items"`
+}
+
+// jsonFeedAuthorName devuelve el primer autor de JSON Feed 1.1 o el autor de 1.0
+func jsonFeedAuthorName(author *jsonFeedAuthor, authors []jsonFeedAuthor) string {
+	if len(authors) > 0 {
+		return strings.TrimSpace(authors[0].Name)
+	}
+	if author != nil {
+		return strings.TrimSpace(author.Name)
+	}
+	return ""
+}
+
+// resolveFeedURL convierte enlaces relativos en absolutos respecto al feed
+func resolveFeedURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || base == nil {
+		return ref
+	}
+	if resolved, err := base.Parse(ref); err == nil {
+		return resolved.String()
+	}
+	return ref
+}
+
+// IsFeedContent indica si el contenido parece un feed RSS, Atom o JSON Feed
+func IsFeedContent(content []byte) bool {
+	head := bytes.ToLower(content)
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	trimmed := bytes.TrimSpace(head)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return bytes.Contains(head, []byte("jsonfeed.org"))
+	}
+	return bytes.Contains(head, []byte("<rss")) || bytes.Contains(head, []byte("<rdf:rdf")) || bytes.Contains(head, []byte("<feed"))
+}
+
+// ParseFeed normaliza un feed RSS, Atom o JSON Feed. feedURL se usa para resolver enlaces relativos.
+func ParseFeed(content []byte, feedURL string) (*Feed, error) {
+	base, _ := url.Parse(feedURL)
+
+	if trimmed := bytes.TrimSpace(content); bytes.HasPrefix(trimmed, []byte("{")) {
+		return parseJSONFeed(trimmed, base)
+	}
+
+	// Leer solo el elemento raíz para decidir el formato
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Strict = false
+	decoder.CharsetReader = charset.NewReaderLabel
+	var root xml.StartElement
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, &ToolError{Code: "invalid_feed", Message: "el contenido no es un feed RSS, Atom o JSON Feed"}
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			root = start
+			break
+		}
+	}
+
+	switch strings.ToLower(root.Name.Local) {
+	case "rss", "rdf":
+		var doc rssDocument
+		if err := decoder.DecodeElement(&doc, &root); err != nil {
+			return nil, &ToolError{Code: "invalid_feed", Message: "RSS inválido: " + err.Error()}
+		}
+		return normalizeRSS(&doc, root, base), nil
+	case "feed":
+		var doc atomFeed
+		if err := decoder.DecodeElement(&doc, &root); err != nil {
+			return nil, &ToolError{Code: "invalid_feed", Message: "Atom inválido: " + err.Error()}
+		}
+		return normalizeAtom(&doc, base), nil
+	default:
+		return nil, &ToolError{Code: "invalid_feed", Message: fmt.Sprintf("el documento no es un feed (raíz <%s>)", root.Name.Local)}
+	}
+}
+
+func normalizeRSS(doc *rssDocument, root xml.StartElement, base *url.URL) *Feed {
+	feed := &Feed{
+		Type:        "rss",
+		Version:     doc.Version,
+		Title:       strings.TrimSpace(doc.Channel.Title),
+		Link:        resolveFeedURL(base, doc.Channel.link()),
+		Description: strings.TrimSpace(doc.Channel.Description),
+		Items:       []FeedItem{},
+	}
+	if strings.EqualFold(root.Name.Local, "rdf") {
+		feed.Version = "1.0"
+	}
+
+	items := append(doc.Channel.Items, doc.Items...)
+	for _, it := range items {
+		item := FeedItem{
+			ID:      strings.TrimSpace(it.GUID),
+			Title:   strings.TrimSpace(it.Title),
+			Link:    resolveFeedURL(base, it.Link),
+			Summary: strings.TrimSpace(it.Description),
+			Content: strings.TrimSpace(it.Encoded),
+			Author:  strings.TrimSpace(it.Author),
+		}
+		if item.Content == "" {
+			item.Content = item.Summary
+		}
+		if item.Author == "" {
+			item.Author = strings.TrimSpace(it.Creator)
+		}
+		published := it.PubDate
+		if published == "" {
+			published = it.Date
+		}
+		item.Published, item.date = formatFeedDate(published)
+		for _, enc := range it.Enclosures {
+			length, _ := strconv.ParseInt(strings.TrimSpace(enc.Length), 10, 64)
+			item.Enclosures = append(item.Enclosures, FeedEnclosure{URL: resolveFeedURL(base, enc.URL), Type: enc.Type, Length: length})
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
+
+func normalizeAtom(doc *atomFeed, base *url.URL) *Feed {
+	feed := &Feed{
+		Type:        "atom",
+		Version:     "1.0",
+		Title:       doc.Title.value(),
+		Description: doc.Subtitle.value(),
+		Items:       []FeedItem{},
+	}
+	for _, link := range doc.Links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			feed.Link = resolveFeedURL(base, link.Href)
+			break
+		}
+	}
+	feedAuthor := ""
+	if len(doc.Authors) > 0 {
+		feedAuthor = strings.TrimSpace(doc.Authors[0].Name)
+	}
+
+	for _, entry := range doc.Entries {
+		item := FeedItem{
+			ID:      strings.TrimSpace(entry.ID),
+			Title:   entry.Title.value(),
+			Summary: entry.Summary.value(),
+			Content: entry.Content.value(),
+			Author:  feedAuthor,
+		}
+		if len(entry.Authors) > 0 {
+			item.Author = strings.TrimSpace(entry.Authors[0].Name)
+		}
+		if item.Content == "" {
+			item.Content = item.Summary
+		}
+		for _, link := range entry.Links {
+			switch link.Rel {
+			case "", "alternate":
+				if item.Link == "" {
+					item.Link = resolveFeedURL(base, link.Href)
+				}
+			case "enclosure":
+				length, _ := strconv.ParseInt(strings.TrimSpace(link.Length), 10, 64)
+				item.Enclosures = append(item.Enclosures, FeedEnclosure{URL: resolveFeedURL(base, link.Href), Type: link.Type, Length: length})
+			}
+		}
+
+		var updated time.Time
+		item.Published, item.date = formatFeedDate(entry.Published)
+		item.Updated, updated = formatFeedDate(entry.Updated)
+		if item.date.IsZero() {
+			item.date = updated
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
+
+func parseJSONFeed(content []byte, base *url.URL) (*Feed, error) {
+	var doc jsonFeed
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, &ToolError{Code: "invalid_feed", Message: "JSON Feed inválido: " + err.Error()}
+	}
+	if !strings.Contains(doc.Version, "jsonfeed.org") {
+		return nil, &ToolError{Code: "invalid_feed", Message: "el documento JSON no es un JSON Feed"}
+	}
+
+	feed := &Feed{
+		Type:        "json",
+		Version:     strings.TrimPrefix(strings.TrimPrefix(doc.Version, "https://jsonfeed.org/version/"), "http://jsonfeed.org/version/"),
+		Title:       strings.TrimSpace(doc.Title),
+		Link:        resolveFeedURL(base, doc.HomePageURL),
+		Description: strings.TrimSpace(doc.Description),
+		Items:       []FeedItem{},
+	}
+	feedAuthor := jsonFeedAuthorName(doc.Author, doc.Authors)
+
+	for _, it := range doc.Items {
+		item := FeedItem{
+			Title:   strings.TrimSpace(it.Title),
+			Link:    resolveFeedURL(base, it.URL),
+			Summary: strings.TrimSpace(it.Summary),
+			Content: strings.TrimSpace(it.ContentHTML),
+			Author:  jsonFeedAuthorName(it.Author, it.Authors),
+		}
+		if it.ID != nil {
+			item.ID = fmt.Sprint(it.ID)
+		}
+		if item.Link == "" {
+			item.Link = resolveFeedURL(base, it.ExternalURL)
+		}
+		if item.Content == "" {
+			item.Content = strings.TrimSpace(it.ContentText)
+		}
+		if item.Author == "" {
+			item.Author = feedAuthor
+		}
+		var updated time.Time
+		item.Published, item.date = formatFeedDate(it.DatePublished)
+		item.Updated, updated = formatFeedDate(it.DateModified)
+		if item.date.IsZero() {
+			item.date = updated
+		}
+		for _, att := range it.Attachments {
+			item.Enclosures = append(item.Enclosures, FeedEnclosure{URL: resolveFeedURL(base, att.URL), Type: att.MimeType, Length: att.Size})
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed, nil
+}
+
+// fetchFeedURL descarga una URL con los límites de webfetch
+func fetchFeedURL(ctx context.Context, opts *FetchOptions, target string) ([]byte, string, *url.URL, error) {
+	resp, err := Fetch(ctx, target, opts)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, "", nil, fmt.Errorf("el servidor respondió con el código %d", resp.StatusCode)
+	}
+	return resp.Body, resp.ContentType, resp.FinalURL, nil
+}
+
+// FetchFeed descarga y normaliza un feed. Si la URL es una página HTML, usa el
+// primer feed que anuncie con <link rel="alternate">.
+func FetchFeed(ctx context.Context, opts *FeedOptions) (*Feed, string, error) {
+	// Las descargas comparten encabezados, timeout y robots.txt (también en
+	// cada redirección) con webfetch; el XML se analiza sin transcodificar
+	fetchOpts := defaultFetchOptions(opts.RespectRobots)
+	fetchOpts.Accept = "application/rss+xml,application/atom+xml,application/feed+json,application/xml;q=0.9,text/html;q=0.8,*/*;q=0.5"
+	fetchOpts.Raw = true
+
+	feedURL := opts.URL
+	body, contentType, finalURL, err := fetchFeedURL(ctx, fetchOpts, feedURL)
+	if err != nil {
+		return nil, feedURL, err
+	}
+
+	var feed *Feed
+	if !IsFeedContent(body) && strings.Contains(contentType, "html") {
+		if decoded, _, _, err := DecodeToUTF8(body, contentType); err == nil {
+			body = decoded
+		}
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, feedURL, &ToolError{Code: "feed_not_found", Message: "la página no anuncia ningún feed"}
+		}
+		feeds := DiscoverFeeds(finalURL, doc)
+		if len(feeds) == 0 {
+			return nil, feedURL, &ToolError{Code: "feed_not_found", Message: "la página no anuncia ningún feed"}
+		}
+		// Usar el primer feed anunciado que se pueda descargar y analizar
+		for _, candidate := range feeds {
+			feedURL = candidate.URL
+			if body, _, finalURL, err = fetchFeedURL(ctx, fetchOpts, feedURL); err != nil {
+				continue
+			}
+			if feed, err = ParseFeed(body, finalURL.String()); err == nil {
+				break
+			}
+		}
+	} else {
+		feed, err = ParseFeed(body, finalURL.String())
+	}
+	if err != nil {
+		return nil, feedURL, err
+	}
+
+	// Filtrar por fecha y limitar; sin fecha no se puede comparar con since
+	items := []FeedItem{}
+	for _, item := range feed.Items {
+		if !opts.Since.IsZero() && (item.date.IsZero() || item.date.Before(opts.Since)) {
+			continue
+		}
+		items = append(items, item)
+		if len(items) >= opts.Limit {
+			break
+		}
+	}
+	feed.Items = items
+
+	if opts.FullContent {
+		fetchFullContent(ctx, fetchOpts, feed.Items)
+	}
+
+	return feed, feedURL, nil
+}
+
+// fetchFullContent descarga la página de cada elemento y la convierte a markdown
+func fetchFullContent(ctx context.Context, opts *FetchOptions, items []FeedItem) {
+	// Las páginas de los elementos se piden con el Accept por defecto
+	pageOpts := *opts
+	pageOpts.Accept = ""
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, fullContentConcurrent)
+
+	for i := range items {
+		if i >= maxFullContentItems {
+			break
+		}
+		if items[i].Link == "" {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(item *FeedItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			body, contentType, _, err := fetchFeedURL(ctx, &pageOpts, item.Link)
+			if err != nil {
+				item.FetchError = err.Error()
+				return
+			}
+			if IsTextContent(contentType) {
+				if decoded, _, _, err := DecodeToUTF8(body, contentType); err == nil {
+					body = decoded
+				}
+			}
+			if !strings.Contains(contentType, "html") {
+				item.FullContent = string(body)
+				return
+			}
+			markdown, err := ConvertHTML(body, "markdown")
+			if err != nil {
+				item.FetchError = err.Error()
+				return
+			}
+			item.FullContent = markdown
+		}(&items[i])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,239 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultFetchHeaders son los encabezados por defecto de las descargas, para
+// parecer un navegador; las opciones de la petición tienen prioridad
+var defaultFetchHeaders = map[string]string{
+	"User-Agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
+	"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8",
+	"Accept-Language": "es-ES,es;q=0.8,en-US;q=0.5,en;q=0.3",
+	"Cache-Control":   "no-cache",
+	"Pragma":          "no-cache",
+}
+
+// FetchOptions agrupa las opciones de descarga comunes a las herramientas que
+// leen páginas: petición (method, headers, cookies, auth, user_agent),
+// redirecciones, timeout y robots.txt
+type FetchOptions struct {
+	Request       *RequestOptions
+	Redirects     *RedirectTracker // solo configuración; cada descarga usa su propia cadena
+	Timeout       time.Duration
+	RespectRobots bool
+	Accept        string // sustituye al Accept por defecto (sitemaps, feeds)
+	MaxSize       int    // límite de la respuesta en bytes; 0 usa maxResponseSize
+	Raw           bool   // devuelve el cuerpo sin extraer documentos ni transcodificar
+}
+
+// ParseFetchOptions lee del payload las opciones de descarga. Sin ellas se
+// obtiene una petición GET con el timeout por defecto.
+func ParseFetchOptions(payload map[string]interface{}) (*FetchOptions, error) {
+	reqOptions, err := ParseRequestOptions(payload)
+	if err != nil {
+		return nil, err
+	}
+	redirects, err := ParseRedirectOptions(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := defaultTimeout
+	if t, ok := payload["timeout"].(float64); ok && t > 0 {
+		timeout = time.Duration(t) * time.Second
+		if timeout > maxTimeout {
+			timeout = maxTimeout
+		}
+	}
+
+	return &FetchOptions{
+		Request:       reqOptions,
+		Redirects:     redirects,
+		Timeout:       timeout,
+		RespectRobots: RespectRobots(payload),
+	}, nil
+}
+
+// defaultFetchOptions devuelve las opciones de una petición GET sin
+// personalizar, para las herramientas que descargan recursos internos
+// (sitemaps, feeds)
+func defaultFetchOptions(respectRobots bool) *FetchOptions {
+	return &FetchOptions{
+		Request:       &RequestOptions{Method: http.MethodGet},
+		Redirects:     &RedirectTracker{Follow: true, MaxRedirects: defaultMaxRedirects},
+		Timeout:       defaultTimeout,
+		RespectRobots: respectRobots,
+	}
+}
+
+// RequireGET rechaza 'method' y 'body' en las herramientas que descargan
+// páginas repetidamente (crawl, research, monitores)
+func (o *FetchOptions) RequireGET() error {
+	if o.Request.Method != http.MethodGet || len(o.Request.Body) > 0 {
+		return &ToolError{Code: "invalid_method", Message: "esta herramienta solo admite peticiones GET sin cuerpo"}
+	}
+	return nil
+}
+
+// FetchResponse es una página descargada. Body está en UTF-8 si el contenido
+// es textual; si es un documento (PDF, Office) Document contiene su texto.
+type FetchResponse struct {
+	URL           string
+	FinalURL      *url.URL
+	StatusCode    int
+	ContentType   string
+	ContentLength int // bytes recibidos, antes de transcodificar
+	Body          []byte
+	RedirectChain []RedirectHop
+	Charset       string
+	CharsetSource string
+	DocumentType  string
+	Document      *DocumentResult
+}
+
+// IsHTML indica si la respuesta es una página HTML
+func (r *FetchResponse) IsHTML() bool {
+	return strings.Contains(r.ContentType, "text/html") || strings.Contains(r.ContentType, "application/xhtml+xml")
+}
+
+// Fetch descarga rawURL aplicando las opciones: encabezados por defecto y del
+// usuario, robots.txt en la URL y en cada redirección, límite de tamaño,
+// extracción de documentos y transcodificación a UTF-8. Los códigos HTTP de
+// error no se tratan como fallo. Ante un error la respuesta conserva lo
+// obtenido hasta entonces (p. ej. la cadena de redirecciones).
+func Fetch(ctx context.Context, rawURL string, opts *FetchOptions) (*FetchResponse, error) {
+	result := &FetchResponse{URL: rawURL, RedirectChain: []RedirectHop{}}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	redirects := &RedirectTracker{
+		Follow:       opts.Redirects.Follow,
+		MaxRedirects: opts.Redirects.MaxRedirects,
+		Chain:        []RedirectHop{},
+	}
+
+	headers := make(map[string]string, len(defaultFetchHeaders))
+	for name, value := range defaultFetchHeaders {
+		headers[name] = value
+	}
+	if opts.Accept != "" {
+		headers["Accept"] = opts.Accept
+	}
+
+	// Con robots.txt nos identificamos con el User-Agent configurado y se
+	// revisa cada redirección
+	if opts.RespectRobots {
+		if err := checkRobots(ctx, rawURL); err != nil {
+			return result, err
+		}
+		redirects.BeforeRedirect = func(req *http.Request) error {
+			return checkRobots(req.Context(), req.URL.String())
+		}
+		headers["User-Agent"] = Robots.UserAgent
+	}
+
+	client := &http.Client{
+		Timeout:       opts.Timeout,
+		CheckRedirect: redirects.CheckRedirect,
+	}
+
+	req, err := opts.Request.NewRequest(rawURL, headers)
+	if err != nil {
+		return result, &ToolError{Code: "request_creation_failed", Message: "error al crear la solicitud HTTP: " + err.Error()}
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	result.RedirectChain = redirects.Chain
+	if err != nil {
+		if redirectErr, ok := AsRedirectError(err); ok {
+			return result, redirectErr
+		}
+		return result, &ToolError{Code: "request_failed", Message: "no se pudo completar la solicitud: " + err.Error()}
+	}
+	defer resp.Body.Close()
+	redirects.Finish(resp)
+	result.RedirectChain = redirects.Chain
+
+	result.StatusCode = resp.StatusCode
+	result.ContentType = resp.Header.Get("Content-Type")
+	result.FinalURL = resp.Request.URL
+
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = maxResponseSize
+	}
+	tooLarge := &ToolError{Code: "response_too_large", Message: fmt.Sprintf("la respuesta excede el límite de %dMB", maxSize>>20)}
+	if contentLength := resp.Header.Get("Content-Length"); contentLength != "" {
+		if size, err := strconv.ParseInt(contentLength, 10, 64); err == nil && size > int64(maxSize) {
+			return result, tooLarge
+		}
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(resp.Body, int64(maxSize)+1)); err != nil {
+		return result, &ToolError{Code: "read_response_failed", Message: "error al leer la respuesta: " + err.Error()}
+	}
+	if buf.Len() > maxSize {
+		return result, tooLarge
+	}
+	body := buf.Bytes()
+	result.ContentLength = len(body)
+	if opts.Raw {
+		result.Body = body
+		return result, nil
+	}
+
+	// Documentos (PDF, Office, EPUB): extraer el texto en lugar de devolver binario
+	if docType := DetectDocumentType(result.ContentType, rawURL, body); docType != "" {
+		result.DocumentType = docType
+		result.Body = body
+		doc, err := ExtractDocument(docType, body)
+		if err != nil {
+			return result, &ToolError{Code: "document_extraction_failed", Message: err.Error()}
+		}
+		result.Document = doc
+		return result, nil
+	}
+
+	// Transcodificar a UTF-8 el contenido textual (Shift_JIS, Windows-1252, ISO-8859-1...)
+	if IsTextContent(result.ContentType) {
+		decoded, name, source, err := DecodeToUTF8(body, result.ContentType)
+		if err == nil {
+			body = decoded
+		}
+		result.Charset, result.CharsetSource = name, source
+	}
+	result.Body = body
+	return result, nil
+}
+
+// checkRobots comprueba robots.txt y convierte en *ToolError los fallos que
+// no lo son (p. ej. el contexto vencido mientras se espera el Crawl-delay),
+// para que CheckRedirect los reconozca como fallos de la cadena
+func checkRobots(ctx context.Context, rawURL string) error {
+	err := Robots.Check(ctx, rawURL)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*ToolError); ok {
+		return err
+	}
+	return &ToolError{Code: "robots_check_failed", Message: fmt.Sprintf("no se pudo comprobar robots.txt para %s: %v", rawURL, err)}
+}
+
+// fetchErrorCode devuelve el código de un *ToolError o fallback si no lo tiene
+func fetchErrorCode(err error, fallback string) string {
+	if toolErr, ok := err.(*ToolError); ok && toolErr.Code != "" {
+		return toolErr.Code
+	}
+	return fallback
+}
@@ -0,0 +1,104 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// ValidateSelector comprueba que un selector CSS sea válido
+func ValidateSelector(selector string) error {
+	if _, err := cascadia.ParseGroup(selector); err != nil {
+		return &ToolError{Code: "invalid_selector", Message: fmt.Sprintf("selector CSS inválido: %v", err)}
+	}
+	return nil
+}
+
+// FetchSnapshot descarga una página y devuelve su contenido en el formato
+// indicado ("text" o "markdown"), limitado opcionalmente a un selector CSS
+func FetchSnapshot(ctx context.Context, rawURL, selector, format string, opts *FetchOptions) (string, error) {
+	resp, err := Fetch(ctx, rawURL, opts)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 400 {
+		return "", &ToolError{Code: "http_error", Message: fmt.Sprintf("el servidor respondió con el código %d", resp.StatusCode)}
+	}
+
+	// Los documentos se comparan por su texto extraído
+	if doc := resp.Document; doc != nil {
+		if selector != "" {
+			return "", &ToolError{Code: "selector_not_found", Message: "el selector solo se admite en páginas HTML"}
+		}
+		if format == "markdown" {
+			return strings.TrimSpace(doc.Markdown), nil
+		}
+		return strings.TrimSpace(doc.Text), nil
+	}
+
+	body := resp.Body
+	if !resp.IsHTML() {
+		if selector != "" {
+			return "", &ToolError{Code: "selector_not_found", Message: "el selector solo se admite en páginas HTML"}
+		}
+		return strings.TrimSpace(string(body)), nil
+	}
+
+	if selector != "" {
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		selection := doc.Find(selector)
+		if selection.Length() == 0 {
+			return "", &ToolError{Code: "selector_not_found", Message: fmt.Sprintf("el selector '%s' no coincide con ningún elemento", selector)}
+		}
+		var parts []string
+		selection.Each(func(_ int, s *goquery.Selection) {
+			if html, err := goquery.OuterHtml(s); err == nil {
+				parts = append(parts, html)
+			}
+		})
+		body = []byte(strings.Join(parts, "\n"))
+	}
+
+	output, err := ConvertHTML(body, format)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// SnapshotHash devuelve el hash SHA-256 de una instantánea
+func SnapshotHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// DiffSnapshots calcula un diff unificado por líneas entre dos instantáneas y
+// el porcentaje de cambio (0 = idénticas, 100 = sin líneas en común)
+func DiffSnapshots(previous, current string) (string, float64) {
+	a := difflib.SplitLines(previous)
+	b := difflib.SplitLines(current)
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        a,
+		B:        b,
+		FromFile: "anterior",
+		ToFile:   "actual",
+		Context:  2,
+	})
+	if err != nil {
+		diff = ""
+	}
+
+	ratio := difflib.NewMatcher(a, b).Ratio()
+	return diff, (1 - ratio) * 100
+}
@@ -0,0 +1,112 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	defaultMaxRedirects = 10
+	maxAllowedRedirects = 20
+)
+
+// RedirectHop describe un salto de redirección: la URL que respondió, su código
+// de estado y el destino indicado en Location
+type RedirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Location   string `json:"location"`
+}
+
+// RedirectTracker controla y registra las redirecciones de un http.Client
+type RedirectTracker struct {
+	Follow       bool
+	MaxRedirects int
+	Chain        []RedirectHop
+	// BeforeRedirect, si está definido, puede impedir un salto (p. ej. por robots.txt)
+	BeforeRedirect func(req *http.Request) error
+}
+
+// ParseRedirectOptions lee follow_redirects (por defecto true) y max_redirects
+// (por defecto 10, máximo 20) del payload
+func ParseRedirectOptions(payload map[string]interface{}) (*RedirectTracker, error) {
+	tracker := &RedirectTracker{
+		Follow:       true,
+		MaxRedirects: defaultMaxRedirects,
+		Chain:        []RedirectHop{},
+	}
+
+	if v, ok := payload["follow_redirects"]; ok && v != nil {
+		follow, ok := v.(bool)
+		if !ok {
+			return nil, &ToolError{Code: "invalid_redirect_options", Message: "el campo 'follow_redirects' debe ser booleano"}
+		}
+		tracker.Follow = follow
+	}
+
+	if v, ok := payload["max_redirects"]; ok && v != nil {
+		max, ok := v.(float64)
+		if !ok || max < 0 || max != float64(int(max)) {
+			return nil, &ToolError{Code: "invalid_redirect_options", Message: "el campo 'max_redirects' debe ser un entero no negativo"}
+		}
+		tracker.MaxRedirects = int(max)
+		if tracker.MaxRedirects > maxAllowedRedirects {
+			tracker.MaxRedirects = maxAllowedRedirects
+		}
+	}
+
+	return tracker, nil
+}
+
+// CheckRedirect se asigna a http.Client.CheckRedirect. Registra cada salto y
+// detiene la cadena cuando se desactivan las redirecciones o se supera el límite.
+func (t *RedirectTracker) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if !t.Follow {
+		// Devolver la respuesta 3xx tal cual; Finish registrará el salto
+		return http.ErrUseLastResponse
+	}
+
+	if req.Response != nil {
+		t.Chain = append(t.Chain, RedirectHop{
+			URL:        req.Response.Request.URL.String(),
+			StatusCode: req.Response.StatusCode,
+			Location:   req.Response.Header.Get("Location"),
+		})
+	}
+
+	if len(via) > t.MaxRedirects {
+		return &ToolError{
+			Code:    "too_many_redirects",
+			Message: fmt.Sprintf("se superó el máximo de %d redirecciones", t.MaxRedirects),
+		}
+	}
+	if t.BeforeRedirect != nil {
+		return t.BeforeRedirect(req)
+	}
+	return nil
+}
+
+// Finish registra la respuesta final si es una redirección que no se siguió
+func (t *RedirectTracker) Finish(resp *http.Response) {
+	if resp == nil || t.Follow {
+		return
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != "" {
+		t.Chain = append(t.Chain, RedirectHop{
+			URL:        resp.Request.URL.String(),
+			StatusCode: resp.StatusCode,
+			Location:   resp.Header.Get("Location"),
+		})
+	}
+}
+
+// AsRedirectError indica si client.Do falló porque CheckRedirect detuvo la
+// cadena (demasiadas redirecciones o un destino bloqueado por robots.txt)
+func AsRedirectError(err error) (*ToolError, bool) {
+	var toolErr *ToolError
+	if errors.As(err, &toolErr) && toolErr.Code != "" {
+		return toolErr, true
+	}
+	return nil, false
+}
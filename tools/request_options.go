@@ -0,0 +1,254 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// maxRequestBodySize limita el cuerpo que se envía al servidor remoto
+const maxRequestBodySize = 1 * 1024 * 1024 // 1MB
+
+// allowedMethods son los métodos HTTP que se pueden usar en una petición personalizada
+var allowedMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// forbiddenHeaders son encabezados que el cliente no puede establecer porque
+// los controla el transporte o permitirían falsear el origen de la petición
+var forbiddenHeaders = map[string]bool{
+	"Host":                true,
+	"Content-Length":      true,
+	"Transfer-Encoding":   true,
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Upgrade":             true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Expect":              true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Forwarded":           true,
+	"Via":                 true,
+	"X-Forwarded-For":     true,
+	"X-Forwarded-Host":    true,
+	"X-Forwarded-Proto":   true,
+	"X-Real-Ip":           true,
+	"X-Client-Ip":         true,
+	"True-Client-Ip":      true,
+	"Cf-Connecting-Ip":    true,
+}
+
+// forbiddenHeaderPrefixes bloquea familias completas de encabezados
+var forbiddenHeaderPrefixes = []string{"Proxy-", "Sec-"}
+
+// RequestOptions describe una petición HTTP personalizada construida a partir
+// del payload de una herramienta (method, headers, body, cookies, auth, user_agent)
+type RequestOptions struct {
+	Method      string
+	Headers     map[string]string
+	Body        []byte
+	ContentType string
+	Cookies     map[string]string
+	UserAgent   string
+	AuthHeader  string
+}
+
+// IsForbiddenHeader indica si un encabezado está en la lista de encabezados prohibidos
+func IsForbiddenHeader(name string) bool {
+	canonical := http.CanonicalHeaderKey(strings.TrimSpace(name))
+	if forbiddenHeaders[canonical] {
+		return true
+	}
+	for _, prefix := range forbiddenHeaderPrefixes {
+		if strings.HasPrefix(canonical, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRequestOptions lee las opciones de petición del payload. Todos los campos
+// son opcionales; sin ellos se obtiene una petición GET sin cuerpo.
+func ParseRequestOptions(payload map[string]interface{}) (*RequestOptions, error) {
+	opts := &RequestOptions{
+		Method:  http.MethodGet,
+		Headers: map[string]string{},
+		Cookies: map[string]string{},
+	}
+
+	// Método
+	if m, ok := payload["method"]; ok && m != nil {
+		method, ok := m.(string)
+		if !ok {
+			return nil, &ToolError{Code: "invalid_method", Message: "el campo 'method' debe ser una cadena"}
+		}
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method != "" {
+			if !allowedMethods[method] {
+				return nil, &ToolError{Code: "invalid_method", Message: "método HTTP no soportado: " + method}
+			}
+			opts.Method = method
+		}
+	}
+
+	// Encabezados
+	if h, ok := payload["headers"]; ok && h != nil {
+		headers, ok := h.(map[string]interface{})
+		if !ok {
+			return nil, &ToolError{Code: "invalid_headers", Message: "el campo 'headers' debe ser un objeto"}
+		}
+		for name, v := range headers {
+			value, ok := v.(string)
+			if !ok {
+				return nil, &ToolError{Code: "invalid_headers", Message: fmt.Sprintf("el valor del encabezado '%s' debe ser una cadena", name)}
+			}
+			if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " :\r\n") || strings.ContainsAny(value, "\r\n") {
+				return nil, &ToolError{Code: "invalid_headers", Message: fmt.Sprintf("encabezado inválido: '%s'", name)}
+			}
+			if IsForbiddenHeader(name) {
+				return nil, &ToolError{Code: "forbidden_header", Message: fmt.Sprintf("no está permitido establecer el encabezado '%s'", name)}
+			}
+			opts.Headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+
+	// Cuerpo: una cadena se envía tal cual, cualquier otro valor se serializa como JSON
+	if b, ok := payload["body"]; ok && b != nil {
+		switch body := b.(type) {
+		case string:
+			opts.Body = []byte(body)
+		default:
+			encoded, err := json.Marshal(body)
+			if err != nil {
+				return nil, &ToolError{Code: "invalid_body", Message: "no se pudo serializar el campo 'body' como JSON"}
+			}
+			opts.Body = encoded
+			opts.ContentType = "application/json"
+		}
+		if len(opts.Body) > maxRequestBodySize {
+			return nil, &ToolError{Code: "invalid_body", Message: "el campo 'body' excede el tamaño máximo de 1MB"}
+		}
+		if len(opts.Body) > 0 && (opts.Method == http.MethodGet || opts.Method == http.MethodHead) {
+			return nil, &ToolError{Code: "invalid_body", Message: "las peticiones " + opts.Method + " no pueden llevar cuerpo"}
+		}
+	}
+
+	// Cookies
+	if c, ok := payload["cookies"]; ok && c != nil {
+		cookies, ok := c.(map[string]interface{})
+		if !ok {
+			return nil, &ToolError{Code: "invalid_cookies", Message: "el campo 'cookies' debe ser un objeto nombre -> valor"}
+		}
+		for name, v := range cookies {
+			value, ok := v.(string)
+			if !ok || name == "" || strings.ContainsAny(name, "=; \r\n") || strings.ContainsAny(value, ";\r\n") {
+				return nil, &ToolError{Code: "invalid_cookies", Message: fmt.Sprintf("cookie inválida: '%s'", name)}
+			}
+			opts.Cookies[name] = value
+		}
+	}
+
+	// Autenticación básica o bearer
+	if a, ok := payload["auth"]; ok && a != nil {
+		authMap, ok := a.(map[string]interface{})
+		if !ok {
+			return nil, &ToolError{Code: "invalid_auth", Message: "el campo 'auth' debe ser un objeto"}
+		}
+		authType, _ := authMap["type"].(string)
+		switch strings.ToLower(authType) {
+		case "basic":
+			username, _ := authMap["username"].(string)
+			password, _ := authMap["password"].(string)
+			if username == "" {
+				return nil, &ToolError{Code: "invalid_auth", Message: "la autenticación básica requiere 'username'"}
+			}
+			opts.AuthHeader = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+		case "bearer":
+			token, _ := authMap["token"].(string)
+			if token == "" || strings.ContainsAny(token, "\r\n") {
+				return nil, &ToolError{Code: "invalid_auth", Message: "la autenticación bearer requiere 'token'"}
+			}
+			opts.AuthHeader = "Bearer " + token
+		default:
+			return nil, &ToolError{Code: "invalid_auth", Message: "tipo de autenticación no soportado. Use 'basic' o 'bearer'"}
+		}
+	}
+
+	// User-Agent
+	if ua, ok := payload["user_agent"].(string); ok && strings.TrimSpace(ua) != "" {
+		if strings.ContainsAny(ua, "\r\n") {
+			return nil, &ToolError{Code: "invalid_headers", Message: "user_agent inválido"}
+		}
+		opts.UserAgent = strings.TrimSpace(ua)
+	}
+
+	return opts, nil
+}
+
+// BodyReader devuelve el cuerpo de la petición o nil si no hay cuerpo
+func (o *RequestOptions) BodyReader() io.Reader {
+	if len(o.Body) == 0 {
+		return nil
+	}
+	return bytes.NewReader(o.Body)
+}
+
+// Apply aplica las opciones sobre una petición que ya tiene los encabezados por
+// defecto, de modo que los valores del usuario tengan prioridad
+func (o *RequestOptions) Apply(req *http.Request) {
+	if o.ContentType != "" && o.Headers["Content-Type"] == "" {
+		req.Header.Set("Content-Type", o.ContentType)
+	}
+	if o.UserAgent != "" {
+		req.Header.Set("User-Agent", o.UserAgent)
+	}
+
+	// Orden estable para que las peticiones sean reproducibles
+	names := make([]string, 0, len(o.Headers))
+	for name := range o.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		req.Header.Set(name, o.Headers[name])
+	}
+
+	if o.AuthHeader != "" {
+		req.Header.Set("Authorization", o.AuthHeader)
+	}
+
+	cookieNames := make([]string, 0, len(o.Cookies))
+	for name := range o.Cookies {
+		cookieNames = append(cookieNames, name)
+	}
+	sort.Strings(cookieNames)
+	for _, name := range cookieNames {
+		req.AddCookie(&http.Cookie{Name: name, Value: o.Cookies[name]})
+	}
+}
+
+// NewRequest crea la petición HTTP, establece los encabezados por defecto y
+// aplica encima las opciones del usuario
+func (o *RequestOptions) NewRequest(url string, defaults map[string]string) (*http.Request, error) {
+	req, err := http.NewRequest(o.Method, url, o.BodyReader())
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range defaults {
+		req.Header.Set(name, value)
+	}
+	o.Apply(req)
+	return req, nil
+}
@@ -0,0 +1,350 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	defaultResearchResults     = 5
+	maxResearchResults         = 10
+	defaultResearchTokenBudget = 8000
+	minResearchTokenBudget     = 500
+	maxResearchTokenBudget     = 100000
+	researchConcurrency        = 4
+)
+
+// researchTrackingParams son parámetros de seguimiento que no forman parte de la URL canónica
+var researchTrackingParams = []string{"utm_", "fbclid", "gclid", "mc_cid", "mc_eid", "ref_src"}
+
+// ResearchOptions configura la herramienta research
+type ResearchOptions struct {
+	Query       string
+	MaxResults  int
+	TokenBudget int
+	Search      SearchOptions // proveedor y filtros de la búsqueda
+	Fetch       *FetchOptions // encabezados, cookies, timeout, redirecciones y robots.txt de las descargas
+}
+
+// ResearchSource es una fuente citada en el resultado de research
+type ResearchSource struct {
+	Citation     int    `json:"citation"`
+	Title        string `json:"title"`
+	URL          string `json:"url"`
+	CanonicalURL string `json:"canonical_url"`
+	Snippet      string `json:"snippet,omitempty"`
+	Content      string `json:"content,omitempty"`
+	Tokens       int    `json:"tokens"`
+	Truncated    bool   `json:"truncated"`
+	Error        string `json:"error,omitempty"`
+	ErrorCode    string `json:"error_code,omitempty"`
+}
+
+// ResearchResult agrupa las fuentes y el texto combinado con citas [n]
+type ResearchResult struct {
+	Query      string           `json:"query"`
+	Output     string           `json:"output"`
+	Sources    []ResearchSource `json:"sources"`
+	Tokens     int              `json:"tokens"`
+	Duplicates int              `json:"duplicates"`
+	Provider   string           `json:"provider"`
+}
+
+// ParseResearchOptions lee query, max_results y token_budget del payload
+func ParseResearchOptions(payload map[string]interface{}) (*ResearchOptions, error) {
+	opts := &ResearchOptions{
+		MaxResults:  defaultResearchResults,
+		TokenBudget: defaultResearchTokenBudget,
+	}
+
+	query, _ := payload["query"].(string)
+	opts.Query = strings.TrimSpace(query)
+	if opts.Query == "" {
+		return nil, &ToolError{Code: "missing_query", Message: "el parámetro 'query' es requerido"}
+	}
+
+	if v, ok := payload["max_results"]; ok && v != nil {
+		n, ok := v.(float64)
+		if !ok || n < 1 || n > maxResearchResults || n != float64(int(n)) {
+			return nil, &ToolError{Code: "invalid_research_options", Message: fmt.Sprintf("'max_results' debe ser un entero entre 1 y %d", maxResearchResults)}
+		}
+		opts.MaxResults = int(n)
+	}
+
+	if v, ok := payload["token_budget"]; ok && v != nil {
+		n, ok := v.(float64)
+		if !ok || n < minResearchTokenBudget || n > maxResearchTokenBudget || n != float64(int(n)) {
+			return nil, &ToolError{Code: "invalid_research_options", Message: fmt.Sprintf("'token_budget' debe ser un entero entre %d y %d", minResearchTokenBudget, maxResearchTokenBudget)}
+		}
+		opts.TokenBudget = int(n)
+	}
+
+	provider, fallback, err := parseProviderOptions(payload)
+	if err != nil {
+		return nil, err
+	}
+	opts.Search = SearchOptions{Query: opts.Query, MaxResults: maxResearchResults, Provider: provider, Fallback: fallback}
+	if err := parseSearchFilters(payload, &opts.Search); err != nil {
+		return nil, err
+	}
+	// research solo descarga páginas web
+	opts.Search.Type = "web"
+
+	if opts.Fetch, err = ParseFetchOptions(payload); err != nil {
+		return nil, err
+	}
+	if err := opts.Fetch.RequireGET(); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// canonicalResearchURL normaliza una URL para deduplicar: sin fragmento, sin
+// "www.", sin parámetros de seguimiento y sin barra final
+func canonicalResearchURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	query := u.Query()
+	for key := range query {
+		for _, prefix := range researchTrackingParams {
+			if strings.HasPrefix(strings.ToLower(key), prefix) {
+				query.Del(key)
+				break
+			}
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u.String()
+}
+
+// extractArticle devuelve el HTML del contenido principal de la página y su
+// URL canónica, descartando navegación, cabeceras, pies y scripts
+func extractArticle(doc *goquery.Document) (string, string) {
+	canonical, _ := doc.Find("link[rel='canonical']").First().Attr("href")
+
+	doc.Find("script, style, noscript, template, iframe, nav, header, footer, aside, form, [role='navigation'], [role='banner'], [role='contentinfo'], [aria-hidden='true']").Remove()
+
+	var main *goquery.Selection
+	for _, selector := range []string{"article", "main", "[role='main']", "#content", ".content", "body"} {
+		if s := doc.Find(selector); s.Length() > 0 {
+			// Si hay varios <article>, quedarse con el más largo
+			main = s.First()
+			s.Each(func(_ int, candidate *goquery.Selection) {
+				if len(candidate.Text()) > len(main.Text()) {
+					main = candidate
+				}
+			})
+			break
+		}
+	}
+	if main == nil {
+		return "", canonical
+	}
+	content, err := goquery.OuterHtml(main)
+	if err != nil {
+		return "", canonical
+	}
+	return content, canonical
+}
+
+// truncateToTokens recorta el texto a como máximo limit tokens, en un límite de palabra
+func truncateToTokens(text string, limit int) (string, bool) {
+	if EstimateTokens(text) <= limit {
+		return text, false
+	}
+	runes := []rune(text)
+	// Búsqueda binaria de la posición más larga que cabe en el presupuesto
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if EstimateTokens(string(runes[:mid])) <= limit {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	cut := string(runes[:lo])
+	if i := strings.LastIndexAny(cut, " \n\t"); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimSpace(cut), true
+}
+
+// fetchResearchSource descarga una fuente y la convierte a markdown
+func fetchResearchSource(ctx context.Context, source *ResearchSource, opts *FetchOptions) {
+	resp, err := Fetch(ctx, source.URL, opts)
+	if err == nil && resp.StatusCode >= 400 {
+		err = &ToolError{Code: "http_error", Message: fmt.Sprintf("el servidor respondió con el código %d", resp.StatusCode)}
+	}
+	if err != nil {
+		source.Error = err.Error()
+		source.ErrorCode = fetchErrorCode(err, "fetch_failed")
+		return
+	}
+	finalURL := resp.FinalURL
+	source.CanonicalURL = canonicalResearchURL(finalURL.String())
+
+	if doc := resp.Document; doc != nil {
+		source.Content = doc.Markdown
+		return
+	}
+
+	body := resp.Body
+	if !resp.IsHTML() {
+		source.Content = string(body)
+		return
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		source.Error = err.Error()
+		source.ErrorCode = "parse_failed"
+		return
+	}
+	if title := strings.TrimSpace(doc.Find("title").First().Text()); title != "" && source.Title == "" {
+		source.Title = title
+	}
+	article, canonical := extractArticle(doc)
+	if canonical != "" {
+		if resolved, err := finalURL.Parse(canonical); err == nil {
+			source.CanonicalURL = canonicalResearchURL(resolved.String())
+		}
+	}
+	markdown, err := ConvertHTML([]byte(article), "markdown")
+	if err != nil {
+		source.Error = err.Error()
+		source.ErrorCode = "conversion_failed"
+		return
+	}
+	source.Content = strings.TrimSpace(markdown)
+}
+
+// Research busca la consulta, descarga en paralelo los mejores resultados,
+// elimina duplicados por URL canónica y combina el contenido con citas [n]
+// sin superar el presupuesto de tokens
+func Research(ctx context.Context, opts *ResearchOptions) (*ResearchResult, error) {
+	// Pedir resultados de sobra para compensar los duplicados
+	search, err := Search(ctx, &opts.Search)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ResearchResult{Query: opts.Query, Sources: []ResearchSource{}, Provider: search.Provider, Duplicates: search.Duplicates}
+	seen := map[string]bool{}
+	var candidates []ResearchSource
+	for _, item := range search.Results {
+		link := item.URL
+		canonical := canonicalResearchURL(link)
+		if seen[canonical] {
+			result.Duplicates++
+			continue
+		}
+		seen[canonical] = true
+		candidates = append(candidates, ResearchSource{Title: item.Title, URL: link, CanonicalURL: canonical, Snippet: item.Description})
+	}
+
+	// Las redirecciones y <link rel="canonical"> pueden revelar duplicados tras
+	// la descarga; sus huecos se rellenan con los siguientes resultados
+	canonicalSeen := map[string]bool{}
+	var unique []ResearchSource
+	for len(unique) < opts.MaxResults && len(candidates) > 0 {
+		n := opts.MaxResults - len(unique)
+		if n > len(candidates) {
+			n = len(candidates)
+		}
+		batch := candidates[:n]
+		candidates = candidates[n:]
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, researchConcurrency)
+		for i := range batch {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(source *ResearchSource) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				fetchResearchSource(ctx, source, opts.Fetch)
+			}(&batch[i])
+		}
+		wg.Wait()
+
+		for _, source := range batch {
+			if canonicalSeen[source.CanonicalURL] {
+				result.Duplicates++
+				continue
+			}
+			canonicalSeen[source.CanonicalURL] = true
+			unique = append(unique, source)
+		}
+	}
+
+	// Los encabezados y la lista de fuentes también cuentan para el presupuesto
+	var overhead strings.Builder
+	if len(unique) > 0 {
+		overhead.WriteString("## Fuentes\n\n")
+	}
+	for i := range unique {
+		unique[i].Citation = i + 1
+		fmt.Fprintf(&overhead, "[%d] %s - %s\n", unique[i].Citation, unique[i].Title, unique[i].URL)
+		if unique[i].Content != "" {
+			fmt.Fprintf(&overhead, "## [%d] %s\n\n", unique[i].Citation, unique[i].Title)
+		}
+	}
+	remaining := opts.TokenBudget - EstimateTokens(overhead.String())
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	// Repartir el presupuesto: cada fuente recibe una parte igual de lo que
+	// queda, de modo que lo que no usan las fuentes cortas pasa a las largas
+	order := make([]int, 0, len(unique))
+	for i := range unique {
+		if unique[i].Content != "" {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return EstimateTokens(unique[order[a]].Content) < EstimateTokens(unique[order[b]].Content)
+	})
+	for n, i := range order {
+		share := remaining / (len(order) - n)
+		unique[i].Content, unique[i].Truncated = truncateToTokens(unique[i].Content, share)
+		unique[i].Tokens = EstimateTokens(unique[i].Content)
+		remaining -= unique[i].Tokens
+	}
+
+	var output strings.Builder
+	for _, source := range unique {
+		result.Sources = append(result.Sources, source)
+		if source.Content == "" {
+			continue
+		}
+		fmt.Fprintf(&output, "## [%d] %s\n\n%s\n\n", source.Citation, source.Title, source.Content)
+	}
+
+	if len(result.Sources) > 0 {
+		output.WriteString("## Fuentes\n\n")
+		for _, source := range result.Sources {
+			fmt.Fprintf(&output, "[%d] %s - %s\n", source.Citation, source.Title, source.URL)
+		}
+	}
+	result.Output = strings.TrimSpace(output.String())
+	result.Tokens = EstimateTokens(result.Output)
+	return result, nil
+}
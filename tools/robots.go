@@ -0,0 +1,429 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	robotsCacheTTL      = 1 * time.Hour
+	robotsFailureTTL    = 1 * time.Minute // errores de red y 5xx, que suelen ser pasajeros
+	maxRobotsCacheSize  = 10000           // hosts en caché
+	robotsFetchTimeout  = 10 * time.Second
+	maxRobotsSize       = 512 * 1024 // 512KB, como recomienda RFC 9309
+	maxCrawlDelay       = 30 * time.Second
+	defaultRobotsUAName = "ToolboxBot/1.0 (+https://toolbox-api.fly.dev)"
+)
+
+// RobotsUserAgent es el User-Agent con el que se evalúa robots.txt y que se
+// envía en las peticiones que respetan robots.txt. Se configura con ROBOTS_USER_AGENT.
+var RobotsUserAgent = robotsUserAgentFromEnv()
+
+func robotsUserAgentFromEnv() string {
+	if ua := strings.TrimSpace(os.Getenv("ROBOTS_USER_AGENT")); ua != "" {
+		return ua
+	}
+	return defaultRobotsUAName
+}
+
+// robotsRule es una regla Allow/Disallow de robots.txt
+type robotsRule struct {
+	allow bool
+	path  string
+}
+
+// robotsGroup agrupa las reglas aplicables a uno o varios user-agents
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// RobotsTxt es el resultado de interpretar un archivo robots.txt
+type RobotsTxt struct {
+	groups   []robotsGroup
+	Sitemaps []string
+	// allowAll/disallowAll se usan cuando robots.txt no existe o no se pudo obtener
+	allowAll    bool
+	disallowAll bool
+}
+
+// ParseRobotsTxt interpreta el contenido de un robots.txt
+func ParseRobotsTxt(content string) *RobotsTxt {
+	robots := &RobotsTxt{}
+	var current *robotsGroup
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Varias líneas user-agent seguidas comparten el mismo grupo
+			if current == nil || !lastWasAgent {
+				robots.groups = append(robots.groups, robotsGroup{})
+				current = &robots.groups[len(robots.groups)-1]
+			}
+			// Se guarda solo el token de producto; un user-agent vacío no coincide con nadie
+			if agent := productToken(value); agent != "" {
+				current.agents = append(current.agents, agent)
+			}
+			lastWasAgent = true
+		case "allow", "disallow":
+			lastWasAgent = false
+			if current == nil {
+				continue
+			}
+			// "Disallow:" vacío equivale a permitir todo
+			if value == "" {
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{allow: key == "allow", path: value})
+		case "crawl-delay":
+			lastWasAgent = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		case "sitemap":
+			if value != "" {
+				robots.Sitemaps = append(robots.Sitemaps, value)
+			}
+		default:
+			lastWasAgent = false
+		}
+	}
+
+	return robots
+}
+
+// productToken obtiene el nombre del agente ("ToolboxBot/1.0 (...)" -> "toolboxbot")
+func productToken(userAgent string) string {
+	token := strings.Fields(userAgent)
+	if len(token) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.SplitN(token[0], "/", 2)[0])
+}
+
+// hasAgent indica si el grupo incluye el token de producto indicado
+func (g *robotsGroup) hasAgent(token string) bool {
+	for _, agent := range g.agents {
+		if agent == token {
+			return true
+		}
+	}
+	return false
+}
+
+// groupFor devuelve las reglas que se aplican al user-agent. Según RFC 9309
+// el token de producto se compara completo y sin distinguir mayúsculas; si
+// varios grupos coinciden sus reglas se combinan, y si ninguno coincide se
+// usan los grupos "*".
+func (r *RobotsTxt) groupFor(userAgent string) *robotsGroup {
+	token := productToken(userAgent)
+	var matched, wildcard []*robotsGroup
+	for i := range r.groups {
+		switch group := &r.groups[i]; {
+		case token != "" && group.hasAgent(token):
+			matched = append(matched, group)
+		case group.hasAgent("*"):
+			wildcard = append(wildcard, group)
+		}
+	}
+	if len(matched) == 0 {
+		matched = wildcard
+	}
+	switch len(matched) {
+	case 0:
+		return nil
+	case 1:
+		return matched[0]
+	}
+
+	combined := &robotsGroup{}
+	for _, group := range matched {
+		combined.rules = append(combined.rules, group.rules...)
+		if group.crawlDelay > combined.crawlDelay {
+			combined.crawlDelay = group.crawlDelay
+		}
+	}
+	return combined
+}
+
+// Allowed indica si el user-agent puede acceder a la ruta (path + query).
+// Gana la regla más larga; en caso de empate gana Allow.
+func (r *RobotsTxt) Allowed(userAgent, path string) bool {
+	if r.allowAll {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+	if path == "" {
+		path = "/"
+	}
+	// robots.txt siempre está permitido
+	if path == "/robots.txt" {
+		return true
+	}
+
+	group := r.groupFor(userAgent)
+	if group == nil {
+		return true
+	}
+
+	bestLen := -1
+	allowed := true
+	for _, rule := range group.rules {
+		if !robotsPathMatch(rule.path, path) {
+			continue
+		}
+		if len(rule.path) > bestLen || (len(rule.path) == bestLen && rule.allow) {
+			bestLen = len(rule.path)
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+// CrawlDelay devuelve el Crawl-delay aplicable al user-agent
+func (r *RobotsTxt) CrawlDelay(userAgent string) time.Duration {
+	group := r.groupFor(userAgent)
+	if group == nil {
+		return 0
+	}
+	return group.crawlDelay
+}
+
+// robotsPathMatch compara una ruta con un patrón que admite '*' y '$' final
+func robotsPathMatch(pattern, path string) bool {
+	if !strings.ContainsAny(pattern, "*$") {
+		return strings.HasPrefix(path, pattern)
+	}
+
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(path)
+}
+
+// robotsEntry es una entrada de la caché de robots.txt
+type robotsEntry struct {
+	robots    *RobotsTxt
+	expiresAt time.Time
+}
+
+// RobotsChecker obtiene, guarda en caché y evalúa robots.txt, y aplica el
+// Crawl-delay limitando la frecuencia de peticiones por host
+type RobotsChecker struct {
+	UserAgent string
+	Client    *http.Client
+
+	mu       sync.Mutex
+	cache    map[string]robotsEntry
+	nextSlot map[string]time.Time
+}
+
+// NewRobotsChecker crea un verificador de robots.txt para el user-agent indicado
+func NewRobotsChecker(userAgent string) *RobotsChecker {
+	return &RobotsChecker{
+		UserAgent: userAgent,
+		Client:    &http.Client{Timeout: robotsFetchTimeout},
+		cache:     make(map[string]robotsEntry),
+		nextSlot:  make(map[string]time.Time),
+	}
+}
+
+// Robots es el verificador compartido por todas las herramientas
+var Robots = NewRobotsChecker(RobotsUserAgent)
+
+// Get devuelve el robots.txt del host de la URL, usando la caché si es reciente
+func (c *RobotsChecker) Get(ctx context.Context, target *url.URL) *RobotsTxt {
+	origin := target.Scheme + "://" + target.Host
+
+	c.mu.Lock()
+	entry, ok := c.cache[origin]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.robots
+	}
+
+	robots, ttl := c.fetch(ctx, origin)
+	// Si el fallo se debe a que el llamante canceló o agotó su contexto, el
+	// resultado no dice nada del host y no se guarda para los demás
+	if ttl <= 0 {
+		return robots
+	}
+
+	c.mu.Lock()
+	if len(c.cache) >= maxRobotsCacheSize {
+		c.evict()
+	}
+	c.cache[origin] = robotsEntry{robots: robots, expiresAt: time.Now().Add(ttl)}
+	c.mu.Unlock()
+	return robots
+}
+
+// evict elimina las entradas caducadas y, si la caché sigue llena, la que
+// caduca antes. También descarta los turnos de Crawl-delay ya pasados.
+// Se llama con c.mu bloqueado.
+func (c *RobotsChecker) evict() {
+	now := time.Now()
+	for origin, entry := range c.cache {
+		if !now.Before(entry.expiresAt) {
+			delete(c.cache, origin)
+		}
+	}
+	for host, slot := range c.nextSlot {
+		if slot.Before(now) {
+			delete(c.nextSlot, host)
+		}
+	}
+	if len(c.cache) < maxRobotsCacheSize {
+		return
+	}
+	var oldest string
+	for origin, entry := range c.cache {
+		if oldest == "" || entry.expiresAt.Before(c.cache[oldest].expiresAt) {
+			oldest = origin
+		}
+	}
+	delete(c.cache, oldest)
+}
+
+// fetch descarga robots.txt siguiendo RFC 9309: 4xx permite todo, 5xx o un
+// error de red se tratan como prohibición total. Devuelve también cuánto
+// tiempo se puede guardar el resultado: 0 si falló por el contexto del
+// llamante y robotsFailureTTL si el fallo puede ser pasajero.
+func (c *RobotsChecker) fetch(ctx context.Context, origin string) (*RobotsTxt, time.Duration) {
+	failed := func() (*RobotsTxt, time.Duration) {
+		if ctx.Err() != nil {
+			return &RobotsTxt{disallowAll: true}, 0
+		}
+		return &RobotsTxt{disallowAll: true}, robotsFailureTTL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return failed()
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return failed()
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return failed()
+	case resp.StatusCode >= 400:
+		return &RobotsTxt{allowAll: true}, robotsCacheTTL
+	case resp.StatusCode >= 300:
+		// El cliente ya siguió las redirecciones; un 3xx aquí es un bucle
+		return &RobotsTxt{allowAll: true}, robotsCacheTTL
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+	if err != nil {
+		return failed()
+	}
+	return ParseRobotsTxt(string(body)), robotsCacheTTL
+}
+
+// Check verifica que la URL esté permitida y espera el Crawl-delay del host.
+// Devuelve un *ToolError con código "blocked_by_robots" si está prohibida.
+func (c *RobotsChecker) Check(ctx context.Context, rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil || target.Host == "" {
+		return &ToolError{Code: "invalid_url", Message: "URL inválida: " + rawURL}
+	}
+
+	robots := c.Get(ctx, target)
+	path := target.EscapedPath()
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+	if !robots.Allowed(c.UserAgent, path) {
+		return &ToolError{
+			Code:    "blocked_by_robots",
+			Message: fmt.Sprintf("robots.txt de %s no permite el acceso a %s para %s", target.Host, path, productToken(c.UserAgent)),
+		}
+	}
+
+	return c.wait(ctx, target.Host, robots.CrawlDelay(c.UserAgent))
+}
+
+// wait reserva el siguiente turno del host y duerme hasta entonces
+func (c *RobotsChecker) wait(ctx context.Context, host string, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	if delay > maxCrawlDelay {
+		delay = maxCrawlDelay
+	}
+
+	c.mu.Lock()
+	now := time.Now()
+	slot := c.nextSlot[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	c.nextSlot[host] = slot.Add(delay)
+	c.mu.Unlock()
+
+	wait := time.Until(slot)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RespectRobots indica si el payload pide respetar robots.txt
+func RespectRobots(payload map[string]interface{}) bool {
+	respect, _ := payload["respect_robots"].(bool)
+	return respect
+}
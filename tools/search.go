@@ -0,0 +1,723 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSearchResults = 5
+	maxSearchResults     = 50
+	maxSearchPages       = 5
+	maxSearchPage        = 10  // página más alta que se puede pedir con 'page'
+	maxSearchOffset      = 200 // resultados que se pueden saltar con 'offset'
+	searchTimeout        = 10 * time.Second
+	maxSearchResponse    = 2 * 1024 * 1024
+	searchBrowserUA      = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+)
+
+// Endpoints de los proveedores; son variables para poder apuntarlos a un servidor local
+var (
+	DuckDuckGoLiteURL = "https://lite.duckduckgo.com/lite/"
+	BraveSearchURL    = "https://api.search.brave.com/res/v1/web/search"
+	BingSearchURL     = "https://api.bing.microsoft.com/v7.0/search"
+)
+
+// SearchProviderNames son los proveedores disponibles, en el orden de respaldo por defecto.
+// SEARCH_PROVIDERS (lista separada por comas) cambia ese orden.
+var SearchProviderNames = []string{"duckduckgo", "duckduckgo_lite", "searxng", "brave", "bing"}
+
+// Valores aceptados por safe_search y time_range
+var (
+	searchSafeSearchValues = []string{"strict", "moderate", "off"}
+	searchTimeRangeValues  = []string{"day", "week", "month", "year"}
+	searchTypeValues       = []string{"web", "news", "images", "videos"}
+	searchRegionPattern    = regexp.MustCompile(`^[a-z]{2}-[a-z]{2}$`)
+)
+
+// SearchOptions son los parámetros comunes a todos los proveedores de búsqueda
+type SearchOptions struct {
+	Query        string
+	MaxResults   int
+	Provider     string // proveedor preferido; vacío usa el orden por defecto
+	Fallback     bool   // probar otros proveedores si el elegido falla o no devuelve resultados
+	Region       string // código de región de DuckDuckGo (kl), p. ej. "es-es" o "wt-wt"
+	SafeSearch   string // "strict", "moderate" u "off"
+	TimeRange    string // "day", "week", "month" o "year"
+	Page         int    // página de resultados, desde 1
+	Offset       int    // resultados a saltar; tiene prioridad sobre Page
+	Site         string
+	ExcludeSites []string
+	Type         string // "web", "news", "images" o "videos"
+}
+
+// EffectiveQuery devuelve la consulta con los operadores site: y -site: añadidos
+func (o *SearchOptions) EffectiveQuery() string {
+	query := o.Query
+	if o.Site != "" {
+		query += " site:" + o.Site
+	}
+	for _, site := range o.ExcludeSites {
+		query += " -site:" + site
+	}
+	return query
+}
+
+// Resolved devuelve las opciones efectivas para incluirlas en metadata
+func (o *SearchOptions) Resolved() map[string]interface{} {
+	resolved := map[string]interface{}{
+		"search_type": o.Type,
+		"query":       o.EffectiveQuery(),
+		"max_results": o.MaxResults,
+		"region":      o.Region,
+		"safe_search": o.SafeSearch,
+		"page":        o.Page,
+		"offset":      o.Offset,
+	}
+	if o.TimeRange != "" {
+		resolved["time_range"] = o.TimeRange
+	}
+	if o.Site != "" {
+		resolved["site"] = o.Site
+	}
+	if len(o.ExcludeSites) > 0 {
+		resolved["exclude_site"] = o.ExcludeSites
+	}
+	return resolved
+}
+
+// regionParts separa un código de región "país-idioma" de DuckDuckGo; "wt-wt" no tiene región
+func (o *SearchOptions) regionParts() (country, language string) {
+	if o.Region == "" || o.Region == "wt-wt" {
+		return "", ""
+	}
+	parts := strings.SplitN(o.Region, "-", 2)
+	return parts[0], parts[1]
+}
+
+// SearchResult es un resultado de búsqueda normalizado
+type SearchResult struct {
+	Title         string `json:"title"`
+	URL           string `json:"url"`
+	Description   string `json:"description"`
+	Thumbnail     string `json:"thumbnail,omitempty"`
+	DisplayDomain string `json:"display_domain"`
+	Favicon       string `json:"favicon,omitempty"`
+}
+
+// SearchFaviconURL es el servicio de favicons; %s es el dominio del resultado
+var SearchFaviconURL = "https://external-content.duckduckgo.com/ip3/%s.ico"
+
+// normalizeSearchResults completa el dominio visible y el favicon de cada
+// resultado y elimina los duplicados por URL canónica
+func normalizeSearchResults(results []SearchResult) ([]SearchResult, int) {
+	seen := map[string]bool{}
+	normalized := []SearchResult{}
+	duplicates := 0
+	for _, result := range results {
+		result.URL = unwrapSearchURL(result.URL)
+		u, err := url.Parse(result.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+
+		canonical := canonicalResearchURL(result.URL)
+		if seen[canonical] {
+			duplicates++
+			continue
+		}
+		seen[canonical] = true
+
+		host := strings.ToLower(u.Hostname())
+		result.DisplayDomain = strings.TrimPrefix(host, "www.")
+		if result.Favicon == "" {
+			result.Favicon = fmt.Sprintf(SearchFaviconURL, host)
+		}
+		normalized = append(normalized, result)
+	}
+	return normalized, duplicates
+}
+
+// SearchAttempt registra el resultado de consultar un proveedor
+type SearchAttempt struct {
+	Provider    string `json:"provider"`
+	ResultCount int    `json:"result_count"`
+	Error       string `json:"error,omitempty"`
+}
+
+// SearchResponse es la respuesta de Search: los resultados del tipo pedido,
+// el proveedor que los dio y los intentos realizados
+type SearchResponse struct {
+	Results    []SearchResult
+	News       []NewsResult
+	Images     []ImageResult
+	Videos     []VideoResult
+	Provider   string
+	Attempts   []SearchAttempt
+	Duplicates int // resultados web descartados por repetir una URL
+}
+
+// Count devuelve el número de resultados, sea cual sea el tipo de búsqueda
+func (r *SearchResponse) Count() int {
+	return len(r.Results) + len(r.News) + len(r.Images) + len(r.Videos)
+}
+
+// truncate limita los resultados a max
+func (r *SearchResponse) truncate(max int) {
+	if len(r.Results) > max {
+		r.Results = r.Results[:max]
+	}
+	if len(r.News) > max {
+		r.News = r.News[:max]
+	}
+	if len(r.Images) > max {
+		r.Images = r.Images[:max]
+	}
+	if len(r.Videos) > max {
+		r.Videos = r.Videos[:max]
+	}
+}
+
+// SearchProvider es un motor de búsqueda
+type SearchProvider interface {
+	Name() string
+	// Configured indica si el proveedor tiene lo necesario (endpoint, API key) para usarse
+	Configured() bool
+	Search(ctx context.Context, opts *SearchOptions) ([]SearchResult, error)
+}
+
+// NewSearchProvider crea el proveedor indicado con la configuración del entorno
+func NewSearchProvider(name string) (SearchProvider, error) {
+	switch name {
+	case "duckduckgo":
+		return &duckDuckGoHTMLProvider{endpoint: DuckDuckGoHTMLURL}, nil
+	case "duckduckgo_lite":
+		return &duckDuckGoLiteProvider{endpoint: DuckDuckGoLiteURL}, nil
+	case "searxng":
+		return &searxngProvider{endpoint: strings.TrimSpace(os.Getenv("SEARXNG_URL"))}, nil
+	case "brave":
+		return &braveProvider{endpoint: BraveSearchURL, apiKey: strings.TrimSpace(os.Getenv("BRAVE_SEARCH_API_KEY"))}, nil
+	case "bing":
+		return &bingProvider{endpoint: BingSearchURL, apiKey: strings.TrimSpace(os.Getenv("BING_SEARCH_API_KEY"))}, nil
+	}
+	return nil, &ToolError{Code: "invalid_provider", Message: fmt.Sprintf("proveedor de búsqueda desconocido '%s'; use uno de: %s", name, strings.Join(SearchProviderNames, ", "))}
+}
+
+// IsSearchProvider indica si name es un proveedor de búsqueda conocido
+func IsSearchProvider(name string) bool {
+	for _, known := range SearchProviderNames {
+		if known == name {
+			return true
+		}
+	}
+	return false
+}
+
+// searchProviderOrder devuelve el orden de respaldo configurado
+func searchProviderOrder() []string {
+	configured := strings.TrimSpace(os.Getenv("SEARCH_PROVIDERS"))
+	if configured == "" {
+		return SearchProviderNames
+	}
+	var order []string
+	for _, name := range strings.Split(configured, ",") {
+		if name = strings.TrimSpace(name); IsSearchProvider(name) {
+			order = append(order, name)
+		}
+	}
+	if len(order) == 0 {
+		return SearchProviderNames
+	}
+	return order
+}
+
+// ParseSearchOptions lee query, max_results, provider y fallback del payload
+func ParseSearchOptions(payload map[string]interface{}) (*SearchOptions, error) {
+	query, _ := payload["query"].(string)
+	opts := &SearchOptions{Query: strings.TrimSpace(query), MaxResults: defaultSearchResults, Fallback: true}
+	if opts.Query == "" {
+		return nil, &ToolError{Code: "missing_query", Message: "el parámetro 'query' es requerido"}
+	}
+
+	if mr, ok := payload["max_results"].(float64); ok {
+		opts.MaxResults = int(mr)
+	}
+	if opts.MaxResults <= 0 {
+		opts.MaxResults = defaultSearchResults
+	} else if opts.MaxResults > maxSearchResults {
+		opts.MaxResults = maxSearchResults
+	}
+
+	provider, fallback, err := parseProviderOptions(payload)
+	if err != nil {
+		return nil, err
+	}
+	opts.Provider, opts.Fallback = provider, fallback
+
+	if err := parseSearchFilters(payload, opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// parseSearchFilters lee region, safe_search, time_range, page, offset, site y exclude_site
+func parseSearchFilters(payload map[string]interface{}, opts *SearchOptions) error {
+	invalid := func(format string, args ...interface{}) error {
+		return &ToolError{Code: "invalid_search_options", Message: fmt.Sprintf(format, args...)}
+	}
+	readString := func(field string) (string, error) {
+		v, ok := payload[field]
+		if !ok || v == nil {
+			return "", nil
+		}
+		str, ok := v.(string)
+		if !ok {
+			return "", invalid("el campo '%s' debe ser una cadena", field)
+		}
+		return strings.ToLower(strings.TrimSpace(str)), nil
+	}
+	readInt := func(field string, min, max int) (int, error) {
+		v, ok := payload[field]
+		if !ok || v == nil {
+			return min, nil
+		}
+		n, ok := v.(float64)
+		if !ok || n < float64(min) || n > float64(max) || n != float64(int(n)) {
+			return 0, invalid("el campo '%s' debe ser un entero entre %d y %d", field, min, max)
+		}
+		return int(n), nil
+	}
+	oneOf := func(field, value string, accepted []string) error {
+		for _, a := range accepted {
+			if value == a {
+				return nil
+			}
+		}
+		return invalid("'%s' debe ser uno de: %s", field, strings.Join(accepted, ", "))
+	}
+
+	var err error
+	if opts.Type, err = readString("search_type"); err != nil {
+		return err
+	}
+	if opts.Type == "" {
+		opts.Type = "web"
+	} else if err := oneOf("search_type", opts.Type, searchTypeValues); err != nil {
+		return err
+	}
+
+	if opts.Region, err = readString("region"); err != nil {
+		return err
+	}
+	if opts.Region == "" {
+		opts.Region = "wt-wt"
+	} else if !searchRegionPattern.MatchString(opts.Region) {
+		return invalid("'region' debe tener el formato país-idioma de DuckDuckGo (p. ej. 'es-es', 'us-en' o 'wt-wt')")
+	}
+
+	if opts.SafeSearch, err = readString("safe_search"); err != nil {
+		return err
+	}
+	if opts.SafeSearch == "" {
+		opts.SafeSearch = "moderate"
+	} else if err := oneOf("safe_search", opts.SafeSearch, searchSafeSearchValues); err != nil {
+		return err
+	}
+
+	if opts.TimeRange, err = readString("time_range"); err != nil {
+		return err
+	}
+	if opts.TimeRange != "" {
+		if err := oneOf("time_range", opts.TimeRange, searchTimeRangeValues); err != nil {
+			return err
+		}
+	}
+
+	if opts.Page, err = readInt("page", 1, maxSearchPage); err != nil {
+		return err
+	}
+	if opts.Offset, err = readInt("offset", 0, maxSearchOffset); err != nil {
+		return err
+	}
+
+	if opts.Site, err = readString("site"); err != nil {
+		return err
+	}
+	switch v := payload["exclude_site"].(type) {
+	case nil:
+	case string:
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			opts.ExcludeSites = []string{v}
+		}
+	case []interface{}:
+		for _, item := range v {
+			site, ok := item.(string)
+			if !ok {
+				return invalid("'exclude_site' debe ser una cadena o una lista de cadenas")
+			}
+			if site = strings.ToLower(strings.TrimSpace(site)); site != "" {
+				opts.ExcludeSites = append(opts.ExcludeSites, site)
+			}
+		}
+	default:
+		return invalid("'exclude_site' debe ser una cadena o una lista de cadenas")
+	}
+	for _, site := range append([]string{opts.Site}, opts.ExcludeSites...) {
+		if strings.ContainsAny(site, " \t\"/") {
+			return invalid("'site' y 'exclude_site' deben ser dominios, p. ej. 'example.com'")
+		}
+	}
+	return nil
+}
+
+// startOffset devuelve el número de resultados a saltar según Offset o Page
+func (o *SearchOptions) startOffset(pageSize int) int {
+	if o.Offset > 0 {
+		return o.Offset
+	}
+	return (o.Page - 1) * pageSize
+}
+
+// parseProviderOptions lee provider y fallback, compartidos por search y research
+func parseProviderOptions(payload map[string]interface{}) (string, bool, error) {
+	provider, _ := payload["provider"].(string)
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	if provider != "" && !IsSearchProvider(provider) {
+		_, err := NewSearchProvider(provider)
+		return "", false, err
+	}
+
+	fallback := true
+	if v, ok := payload["fallback"]; ok && v != nil {
+		b, ok := v.(bool)
+		if !ok {
+			return "", false, &ToolError{Code: "invalid_search_options", Message: "el campo 'fallback' debe ser booleano"}
+		}
+		fallback = b
+	}
+	return provider, fallback, nil
+}
+
+// Search consulta el proveedor preferido y, si falla o no devuelve resultados,
+// los siguientes del orden de respaldo que estén configurados
+func Search(ctx context.Context, opts *SearchOptions) (*SearchResponse, error) {
+	var order []string
+	if opts.Provider != "" {
+		order = append(order, opts.Provider)
+	}
+	if opts.Provider == "" || opts.Fallback {
+		for _, name := range searchProviderOrder() {
+			if name != opts.Provider {
+				order = append(order, name)
+			}
+		}
+	}
+
+	response := &SearchResponse{Results: []SearchResult{}, News: []NewsResult{}, Images: []ImageResult{}, Videos: []VideoResult{}}
+	var lastErr error
+	blocked := 0
+	for _, name := range order {
+		provider, err := NewSearchProvider(name)
+		if err != nil {
+			return nil, err
+		}
+		if !provider.Configured() {
+			// Solo se informa de los proveedores no configurados que se pidieron expresamente
+			if name == opts.Provider {
+				lastErr = &ToolError{Code: "provider_not_configured", Message: fmt.Sprintf("el proveedor '%s' no está configurado", name)}
+				response.Attempts = append(response.Attempts, SearchAttempt{Provider: name, Error: lastErr.Error()})
+			}
+			continue
+		}
+
+		// Los proveedores sin la vertical pedida se saltan salvo que se eligieran expresamente
+		vertical, isVertical := provider.(VerticalSearchProvider)
+		if opts.Type != "web" && !isVertical {
+			if name == opts.Provider {
+				lastErr = &ToolError{Code: "unsupported_search_type", Message: fmt.Sprintf("el proveedor '%s' no admite búsquedas de tipo '%s'", name, opts.Type)}
+				response.Attempts = append(response.Attempts, SearchAttempt{Provider: name, Error: lastErr.Error()})
+			}
+			continue
+		}
+
+		candidate := &SearchResponse{Results: []SearchResult{}, News: []NewsResult{}, Images: []ImageResult{}, Videos: []VideoResult{}}
+		switch opts.Type {
+		case "news":
+			candidate.News, err = vertical.SearchNews(ctx, opts)
+		case "images":
+			candidate.Images, err = vertical.SearchImages(ctx, opts)
+		case "videos":
+			candidate.Videos, err = vertical.SearchVideos(ctx, opts)
+		default:
+			candidate.Results, err = provider.Search(ctx, opts)
+			if err == nil {
+				candidate.Results, candidate.Duplicates = normalizeSearchResults(candidate.Results)
+			}
+		}
+		candidate.truncate(opts.MaxResults)
+
+		attempt := SearchAttempt{Provider: name, ResultCount: candidate.Count()}
+		if err != nil {
+			attempt.Error = err.Error()
+			lastErr = err
+			if toolErr, ok := err.(*ToolError); ok && toolErr.Code == "search_blocked" {
+				blocked++
+			}
+		}
+		response.Attempts = append(response.Attempts, attempt)
+
+		if err == nil {
+			candidate.Provider, candidate.Attempts = name, response.Attempts
+			response = candidate
+			if candidate.Count() > 0 {
+				return response, nil
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	// Sin resultados: si al menos un proveedor respondió, es una búsqueda vacía
+	if response.Provider != "" {
+		return response, nil
+	}
+	if toolErr, ok := lastErr.(*ToolError); ok && len(response.Attempts) == 1 {
+		return nil, toolErr
+	}
+	if blocked > 0 && blocked == len(response.Attempts) {
+		return nil, &ToolError{Code: "search_blocked", Message: "todos los proveedores bloquearon la búsqueda con una verificación anti-bots"}
+	}
+	if lastErr == nil {
+		return nil, &ToolError{Code: "provider_not_configured", Message: "no hay ningún proveedor de búsqueda configurado"}
+	}
+	return nil, &ToolError{Code: "search_failed", Message: "todos los proveedores de búsqueda fallaron: " + lastErr.Error()}
+}
+
+// searchGet realiza una petición GET a un proveedor y devuelve el cuerpo
+func searchGet(ctx context.Context, endpoint string, params url.Values, headers map[string]string) ([]byte, error) {
+	return searchRequest(ctx, http.MethodGet, endpoint, params, headers)
+}
+
+// searchRequest realiza una petición a un proveedor; en POST los parámetros
+// se envían como formulario
+func searchRequest(ctx context.Context, method, endpoint string, params url.Values, headers map[string]string) ([]byte, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint de búsqueda inválido: %v", err)
+	}
+
+	var body io.Reader
+	if method == http.MethodPost {
+		body = strings.NewReader(params.Encode())
+	} else {
+		query := target.Query()
+		for key, values := range params {
+			query[key] = values
+		}
+		target.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("error al crear la petición: %v", err)
+	}
+	req.Header.Set("User-Agent", searchBrowserUA)
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{Timeout: searchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error al realizar la petición: %v", err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxSearchResponse))
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la respuesta: %v", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("el proveedor respondió con el código %d", resp.StatusCode)
+	}
+	return content, nil
+}
+
+// searxngProvider consulta la API JSON de una instancia de SearXNG (SEARXNG_URL)
+type searxngProvider struct {
+	endpoint string
+}
+
+func (p *searxngProvider) Name() string     { return "searxng" }
+func (p *searxngProvider) Configured() bool { return p.endpoint != "" }
+
+func (p *searxngProvider) Search(ctx context.Context, opts *SearchOptions) ([]SearchResult, error) {
+	params := url.Values{
+		"q":          {opts.EffectiveQuery()},
+		"format":     {"json"},
+		"safesearch": {map[string]string{"off": "0", "moderate": "1", "strict": "2"}[opts.SafeSearch]},
+	}
+	if country, language := opts.regionParts(); language != "" {
+		params.Set("language", language+"-"+strings.ToUpper(country))
+	}
+	// SearXNG no admite "week" como intervalo de tiempo
+	if opts.TimeRange != "" && opts.TimeRange != "week" {
+		params.Set("time_range", opts.TimeRange)
+	}
+	// SearXNG pagina por páginas de unos 10 resultados
+	if start := opts.startOffset(10); start > 0 {
+		params.Set("pageno", fmt.Sprint(start/10+1))
+	}
+
+	body, err := searchGet(ctx, strings.TrimRight(p.endpoint, "/")+"/search", params, map[string]string{"Accept": "application/json"})
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Results []struct {
+			Title     string `json:"title"`
+			URL       string `json:"url"`
+			Content   string `json:"content"`
+			Thumbnail string `json:"thumbnail"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("respuesta de SearXNG inválida: %v", err)
+	}
+
+	results := []SearchResult{}
+	for _, r := range data.Results {
+		if r.URL == "" {
+			continue
+		}
+		results = append(results, SearchResult{Title: r.Title, URL: r.URL, Description: r.Content, Thumbnail: r.Thumbnail})
+	}
+	return results, nil
+}
+
+// braveProvider consulta la API de Brave Search (BRAVE_SEARCH_API_KEY)
+type braveProvider struct {
+	endpoint string
+	apiKey   string
+}
+
+func (p *braveProvider) Name() string     { return "brave" }
+func (p *braveProvider) Configured() bool { return p.apiKey != "" }
+
+func (p *braveProvider) Search(ctx context.Context, opts *SearchOptions) ([]SearchResult, error) {
+	count := opts.MaxResults
+	if count > 20 {
+		count = 20 // máximo de la API de Brave
+	}
+	params := url.Values{
+		"q":          {opts.EffectiveQuery()},
+		"count":      {fmt.Sprint(count)},
+		"safesearch": {opts.SafeSearch},
+	}
+	if country, language := opts.regionParts(); country != "" {
+		params.Set("country", country)
+		params.Set("search_lang", language)
+	}
+	if opts.TimeRange != "" {
+		params.Set("freshness", map[string]string{"day": "pd", "week": "pw", "month": "pm", "year": "py"}[opts.TimeRange])
+	}
+	// Brave pagina por páginas de count resultados (offset máximo 9)
+	if start := opts.startOffset(count); start > 0 {
+		page := start / count
+		if page > 9 {
+			page = 9
+		}
+		params.Set("offset", fmt.Sprint(page))
+	}
+
+	body, err := searchGet(ctx, p.endpoint, params, map[string]string{"Accept": "application/json", "X-Subscription-Token": p.apiKey})
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+				Thumbnail   struct {
+					Src string `json:"src"`
+				} `json:"thumbnail"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("respuesta de Brave inválida: %v", err)
+	}
+
+	results := []SearchResult{}
+	for _, r := range data.Web.Results {
+		results = append(results, SearchResult{Title: r.Title, URL: r.URL, Description: r.Description, Thumbnail: r.Thumbnail.Src})
+	}
+	return results, nil
+}
+
+// bingProvider consulta la API de Bing Web Search (BING_SEARCH_API_KEY)
+type bingProvider struct {
+	endpoint string
+	apiKey   string
+}
+
+func (p *bingProvider) Name() string     { return "bing" }
+func (p *bingProvider) Configured() bool { return p.apiKey != "" }
+
+func (p *bingProvider) Search(ctx context.Context, opts *SearchOptions) ([]SearchResult, error) {
+	params := url.Values{
+		"q":          {opts.EffectiveQuery()},
+		"count":      {fmt.Sprint(opts.MaxResults)},
+		"safeSearch": {map[string]string{"off": "Off", "moderate": "Moderate", "strict": "Strict"}[opts.SafeSearch]},
+	}
+	if country, language := opts.regionParts(); country != "" {
+		params.Set("mkt", language+"-"+strings.ToUpper(country))
+	}
+	// Bing no admite "year" como intervalo de frescura
+	if opts.TimeRange != "" && opts.TimeRange != "year" {
+		params.Set("freshness", map[string]string{"day": "Day", "week": "Week", "month": "Month"}[opts.TimeRange])
+	}
+	if start := opts.startOffset(opts.MaxResults); start > 0 {
+		params.Set("offset", fmt.Sprint(start))
+	}
+
+	body, err := searchGet(ctx, p.endpoint, params, map[string]string{"Ocp-Apim-Subscription-Key": p.apiKey})
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		WebPages struct {
+			Value []struct {
+				Name    string `json:"name"`
+				URL     string `json:"url"`
+				Snippet string `json:"snippet"`
+			} `json:"value"`
+		} `json:"webPages"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("respuesta de Bing inválida: %v", err)
+	}
+
+	results := []SearchResult{}
+	for _, r := range data.WebPages.Value {
+		results = append(results, SearchResult{Title: r.Name, URL: r.URL, Description: r.Snippet})
+	}
+	return results, nil
+}
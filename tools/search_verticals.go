@@ -0,0 +1,383 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DuckDuckGoURL es la página principal de DuckDuckGo, de la que se obtiene el
+// token vqd que exigen sus endpoints de noticias, imágenes y vídeos
+var DuckDuckGoURL = "https://duckduckgo.com/"
+
+var duckDuckGoVQD = regexp.MustCompile(`vqd=["']?([0-9-]+)`)
+
+// NewsResult es un resultado de la búsqueda de noticias
+type NewsResult struct {
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	Source    string `json:"source,omitempty"`
+	Published string `json:"published,omitempty"` // RFC 3339
+	Excerpt   string `json:"excerpt,omitempty"`
+	Thumbnail string `json:"thumbnail,omitempty"`
+}
+
+// ImageResult es un resultado de la búsqueda de imágenes
+type ImageResult struct {
+	Title      string `json:"title"`
+	ImageURL   string `json:"image_url"`
+	Thumbnail  string `json:"thumbnail,omitempty"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	SourcePage string `json:"source_page,omitempty"`
+	Source     string `json:"source,omitempty"`
+}
+
+// VideoResult es un resultado de la búsqueda de vídeos
+type VideoResult struct {
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+	Duration    string `json:"duration,omitempty"`
+	Publisher   string `json:"publisher,omitempty"`
+	Published   string `json:"published,omitempty"` // RFC 3339
+	Thumbnail   string `json:"thumbnail,omitempty"`
+	EmbedURL    string `json:"embed_url,omitempty"`
+	ViewCount   int64  `json:"view_count,omitempty"`
+}
+
+// VerticalSearchProvider es un proveedor que además admite búsquedas de
+// noticias, imágenes y vídeos
+type VerticalSearchProvider interface {
+	SearchNews(ctx context.Context, opts *SearchOptions) ([]NewsResult, error)
+	SearchImages(ctx context.Context, opts *SearchOptions) ([]ImageResult, error)
+	SearchVideos(ctx context.Context, opts *SearchOptions) ([]VideoResult, error)
+}
+
+// formatUnixDate convierte una marca de tiempo Unix a RFC 3339
+func formatUnixDate(seconds int64) string {
+	if seconds <= 0 {
+		return ""
+	}
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+}
+
+// formatSearchDate normaliza una fecha ISO 8601 a RFC 3339; si no se reconoce se devuelve tal cual
+func formatSearchDate(value string) string {
+	if value == "" {
+		return ""
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format(time.RFC3339)
+		}
+	}
+	return value
+}
+
+// duckDuckGoVerticalJSON obtiene el token vqd y consulta un endpoint JSON de
+// DuckDuckGo (news.js, i.js, v.js)
+func duckDuckGoVerticalJSON(ctx context.Context, endpoint string, opts *SearchOptions, params url.Values, target interface{}) error {
+	page, err := searchGet(ctx, DuckDuckGoURL, url.Values{"q": {opts.EffectiveQuery()}}, nil)
+	if err != nil {
+		return err
+	}
+	match := duckDuckGoVQD.FindSubmatch(page)
+	if match == nil {
+		if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page)); err == nil && isDuckDuckGoChallenge(doc) {
+			return errSearchBlocked("DuckDuckGo")
+		}
+		return fmt.Errorf("no se pudo obtener el token vqd de DuckDuckGo")
+	}
+
+	params.Set("q", opts.EffectiveQuery())
+	params.Set("vqd", string(match[1]))
+	params.Set("o", "json")
+	params.Set("l", opts.Region)
+	params.Set("p", map[string]string{"strict": "1", "moderate": "-1", "off": "-2"}[opts.SafeSearch])
+	if start := opts.startOffset(opts.MaxResults); start > 0 {
+		params.Set("s", fmt.Sprint(start))
+	}
+
+	base, err := url.Parse(DuckDuckGoURL)
+	if err != nil {
+		return err
+	}
+	ref, err := base.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	body, err := searchGet(ctx, ref.String(), params, map[string]string{
+		"Accept":  "application/json",
+		"Referer": DuckDuckGoURL,
+	})
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("respuesta de DuckDuckGo inválida: %v", err)
+	}
+	return nil
+}
+
+func (p *duckDuckGoHTMLProvider) SearchNews(ctx context.Context, opts *SearchOptions) ([]NewsResult, error) {
+	params := url.Values{"noamp": {"1"}}
+	if opts.TimeRange != "" {
+		params.Set("df", opts.TimeRange[:1])
+	}
+
+	var data struct {
+		Results []struct {
+			Date    int64  `json:"date"`
+			Excerpt string `json:"excerpt"`
+			Image   string `json:"image"`
+			Source  string `json:"source"`
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+		} `json:"results"`
+	}
+	if err := duckDuckGoVerticalJSON(ctx, "news.js", opts, params, &data); err != nil {
+		return nil, err
+	}
+
+	results := []NewsResult{}
+	for _, r := range data.Results {
+		if r.URL == "" {
+			continue
+		}
+		results = append(results, NewsResult{
+			Title:     r.Title,
+			URL:       r.URL,
+			Source:    r.Source,
+			Published: formatUnixDate(r.Date),
+			Excerpt:   r.Excerpt,
+			Thumbnail: r.Image,
+		})
+	}
+	return results, nil
+}
+
+func (p *duckDuckGoHTMLProvider) SearchImages(ctx context.Context, opts *SearchOptions) ([]ImageResult, error) {
+	params := url.Values{}
+	if opts.TimeRange != "" {
+		params.Set("f", "time:"+map[string]string{"day": "Day", "week": "Week", "month": "Month", "year": "Year"}[opts.TimeRange]+",,,,")
+	}
+
+	var data struct {
+		Results []struct {
+			Height    int    `json:"height"`
+			Width     int    `json:"width"`
+			Image     string `json:"image"`
+			Source    string `json:"source"`
+			Thumbnail string `json:"thumbnail"`
+			Title     string `json:"title"`
+			URL       string `json:"url"`
+		} `json:"results"`
+	}
+	if err := duckDuckGoVerticalJSON(ctx, "i.js", opts, params, &data); err != nil {
+		return nil, err
+	}
+
+	results := []ImageResult{}
+	for _, r := range data.Results {
+		if r.Image == "" {
+			continue
+		}
+		results = append(results, ImageResult{
+			Title:      r.Title,
+			ImageURL:   r.Image,
+			Thumbnail:  r.Thumbnail,
+			Width:      r.Width,
+			Height:     r.Height,
+			SourcePage: r.URL,
+			Source:     r.Source,
+		})
+	}
+	return results, nil
+}
+
+func (p *duckDuckGoHTMLProvider) SearchVideos(ctx context.Context, opts *SearchOptions) ([]VideoResult, error) {
+	params := url.Values{}
+	if opts.TimeRange != "" && opts.TimeRange != "year" {
+		params.Set("f", "publishedAfter:"+opts.TimeRange[:1]+",,")
+	}
+
+	var data struct {
+		Results []struct {
+			Content     string `json:"content"`
+			Description string `json:"description"`
+			Duration    string `json:"duration"`
+			EmbedURL    string `json:"embed_url"`
+			Images      struct {
+				Large  string `json:"large"`
+				Medium string `json:"medium"`
+				Small  string `json:"small"`
+			} `json:"images"`
+			Published  string `json:"published"`
+			Publisher  string `json:"publisher"`
+			Title      string `json:"title"`
+			Statistics struct {
+				ViewCount int64 `json:"viewCount"`
+			} `json:"statistics"`
+		} `json:"results"`
+	}
+	if err := duckDuckGoVerticalJSON(ctx, "v.js", opts, params, &data); err != nil {
+		return nil, err
+	}
+
+	results := []VideoResult{}
+	for _, r := range data.Results {
+		if r.Content == "" {
+			continue
+		}
+		thumbnail := r.Images.Medium
+		if thumbnail == "" {
+			thumbnail = r.Images.Large
+		}
+		results = append(results, VideoResult{
+			Title:       r.Title,
+			URL:         r.Content,
+			Description: r.Description,
+			Duration:    r.Duration,
+			Publisher:   r.Publisher,
+			Published:   formatSearchDate(r.Published),
+			Thumbnail:   thumbnail,
+			EmbedURL:    r.EmbedURL,
+			ViewCount:   r.Statistics.ViewCount,
+		})
+	}
+	return results, nil
+}
+
+// searxngVertical es un resultado de SearXNG con los campos de las categorías
+// news, images y videos
+type searxngVertical struct {
+	Title         string `json:"title"`
+	URL           string `json:"url"`
+	Content       string `json:"content"`
+	PublishedDate string `json:"publishedDate"`
+	Thumbnail     string `json:"thumbnail"`
+	ThumbnailSrc  string `json:"thumbnail_src"`
+	ImgSrc        string `json:"img_src"`
+	Resolution    string `json:"resolution"`
+	Source        string `json:"source"`
+	Engine        string `json:"engine"`
+	Author        string `json:"author"`
+	Length        string `json:"length"`
+	IframeSrc     string `json:"iframe_src"`
+}
+
+// searchCategory consulta una categoría de SearXNG
+func (p *searxngProvider) searchCategory(ctx context.Context, opts *SearchOptions, category string) ([]searxngVertical, error) {
+	params := url.Values{
+		"q":          {opts.EffectiveQuery()},
+		"format":     {"json"},
+		"categories": {category},
+		"safesearch": {map[string]string{"off": "0", "moderate": "1", "strict": "2"}[opts.SafeSearch]},
+	}
+	if country, language := opts.regionParts(); language != "" {
+		params.Set("language", language+"-"+strings.ToUpper(country))
+	}
+	if opts.TimeRange != "" && opts.TimeRange != "week" {
+		params.Set("time_range", opts.TimeRange)
+	}
+
+	body, err := searchGet(ctx, strings.TrimRight(p.endpoint, "/")+"/search", params, map[string]string{"Accept": "application/json"})
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Results []searxngVertical `json:"results"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("respuesta de SearXNG inválida: %v", err)
+	}
+	return data.Results, nil
+}
+
+func (p *searxngProvider) SearchNews(ctx context.Context, opts *SearchOptions) ([]NewsResult, error) {
+	items, err := p.searchCategory(ctx, opts, "news")
+	if err != nil {
+		return nil, err
+	}
+	results := []NewsResult{}
+	for _, r := range items {
+		source := r.Source
+		if source == "" {
+			if u, err := url.Parse(r.URL); err == nil {
+				source = strings.TrimPrefix(u.Hostname(), "www.")
+			}
+		}
+		thumbnail := r.Thumbnail
+		if thumbnail == "" {
+			thumbnail = r.ImgSrc
+		}
+		results = append(results, NewsResult{
+			Title:     r.Title,
+			URL:       r.URL,
+			Source:    source,
+			Published: formatSearchDate(r.PublishedDate),
+			Excerpt:   r.Content,
+			Thumbnail: thumbnail,
+		})
+	}
+	return results, nil
+}
+
+func (p *searxngProvider) SearchImages(ctx context.Context, opts *SearchOptions) ([]ImageResult, error) {
+	items, err := p.searchCategory(ctx, opts, "images")
+	if err != nil {
+		return nil, err
+	}
+	results := []ImageResult{}
+	for _, r := range items {
+		if r.ImgSrc == "" {
+			continue
+		}
+		// La resolución llega como "1920x1080" o "1920 x 1080"
+		var width, height int
+		if parts := strings.Split(strings.ReplaceAll(r.Resolution, " ", ""), "x"); len(parts) == 2 {
+			width, _ = strconv.Atoi(parts[0])
+			height, _ = strconv.Atoi(parts[1])
+		}
+		results = append(results, ImageResult{
+			Title:      r.Title,
+			ImageURL:   r.ImgSrc,
+			Thumbnail:  r.ThumbnailSrc,
+			Width:      width,
+			Height:     height,
+			SourcePage: r.URL,
+			Source:     r.Engine,
+		})
+	}
+	return results, nil
+}
+
+func (p *searxngProvider) SearchVideos(ctx context.Context, opts *SearchOptions) ([]VideoResult, error) {
+	items, err := p.searchCategory(ctx, opts, "videos")
+	if err != nil {
+		return nil, err
+	}
+	results := []VideoResult{}
+	for _, r := range items {
+		results = append(results, VideoResult{
+			Title:       r.Title,
+			URL:         r.URL,
+			Description: r.Content,
+			Duration:    r.Length,
+			Publisher:   r.Author,
+			Published:   formatSearchDate(r.PublishedDate),
+			Thumbnail:   r.Thumbnail,
+			EmbedURL:    r.IframeSrc,
+		})
+	}
+	return results, nil
+}
@@ -7,8 +7,24 @@ import (
 	"github.com/chromedp/chromedp"
 )
 
-// ShotScrapper toma una captura de pantalla de la URL dada y devuelve el buffer de la imagen PNG.
-func ShotScrapper(url string) ([]byte, error) {
+// ShotScrapper toma una captura de pantalla de la URL dada y devuelve el buffer de la imagen.
+// Con fullPage se captura la página completa y, si no, solo la parte visible (viewport).
+func ShotScrapper(url string, fullPage bool) ([]byte, error) {
+	return CaptureScreenshot(url, 90, fullPage)
+}
+
+// ShotScrapperPNG toma una captura sin pérdida (PNG), necesaria para comparar píxel a píxel.
+func ShotScrapperPNG(url string, fullPage bool) ([]byte, error) {
+	return CaptureScreenshot(url, 100, fullPage)
+}
+
+// CaptureScreenshot abre la URL en Chrome y devuelve la captura; es una
+// variable para poder sustituir el navegador en las pruebas
+var CaptureScreenshot = captureScreenshot
+
+// captureScreenshot captura el viewport (PNG) o la página completa; en ese
+// caso chromedp usa PNG con calidad 100 y JPEG en otro caso.
+func captureScreenshot(url string, quality int, fullPage bool) ([]byte, error) {
 	ctx, cancel := chromedp.NewContext(context.Background())
 	defer cancel()
 
@@ -17,13 +33,17 @@ func ShotScrapper(url string) ([]byte, error) {
 	defer cancel()
 
 	var buf []byte
+	capture := chromedp.CaptureScreenshot(&buf)
+	if fullPage {
+		capture = chromedp.FullScreenshot(&buf, quality)
+	}
 	err := chromedp.Run(ctx,
 		chromedp.Navigate(url),
 		chromedp.Sleep(2*time.Second), // Espera para cargar la página
-		chromedp.FullScreenshot(&buf, 90),
+		capture,
 	)
 	if err != nil {
 		return nil, err
 	}
 	return buf, nil
-} 
\ No newline at end of file
+}
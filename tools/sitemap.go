@@ -0,0 +1,343 @@
+package tools
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	defaultSitemapURLs = 1000
+	maxSitemapURLs     = 50000
+	maxSitemapFiles    = 50
+	maxSitemapNesting  = 5
+	// Límite del protocolo de sitemaps para un archivo sin comprimir
+	maxSitemapSize = 50 * 1024 * 1024
+)
+
+// SitemapOptions configura el descubrimiento y el filtrado de sitemaps
+type SitemapOptions struct {
+	URL           string
+	PathPrefix    string
+	Since         time.Time
+	Until         time.Time
+	MaxURLs       int
+	RespectRobots bool
+}
+
+// SitemapURL es una entrada <url> de un sitemap
+type SitemapURL struct {
+	Loc        string   `json:"loc"`
+	LastMod    string   `json:"lastmod,omitempty"`
+	ChangeFreq string   `json:"changefreq,omitempty"`
+	Priority   *float64 `json:"priority,omitempty"`
+	Sitemap    string   `json:"sitemap"`
+}
+
+// SitemapError describe un sitemap que no se pudo procesar
+type SitemapError struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// SitemapResult agrupa las URLs encontradas y los sitemaps procesados
+type SitemapResult struct {
+	Sitemaps  []string       `json:"sitemaps"`
+	URLs      []SitemapURL   `json:"urls"`
+	Count     int            `json:"count"`
+	Truncated bool           `json:"truncated"`
+	Errors    []SitemapError `json:"errors,omitempty"`
+}
+
+// sitemapDocument cubre tanto <urlset> como <sitemapindex>
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
+}
+
+// sitemapDateLayouts son los formatos W3C Datetime admitidos en <lastmod>
+var sitemapDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// parseSitemapDate interpreta una fecha en formato W3C Datetime
+func parseSitemapDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range sitemapDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ParseSitemapOptions valida el payload de la herramienta sitemap
+func ParseSitemapOptions(payload map[string]interface{}) (*SitemapOptions, error) {
+	rawURL, _ := payload["url"].(string)
+	if rawURL == "" {
+		return nil, &ToolError{Code: "missing_url", Message: "se requiere el parámetro 'url' en el payload"}
+	}
+	parsed, err := url.ParseRequestURI(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, &ToolError{Code: "invalid_url", Message: "URL inválida. Debe comenzar con http:// o https://"}
+	}
+
+	opts := &SitemapOptions{
+		URL:           parsed.String(),
+		MaxURLs:       defaultSitemapURLs,
+		RespectRobots: RespectRobots(payload),
+	}
+
+	if v, ok := payload["path_prefix"]; ok && v != nil {
+		prefix, ok := v.(string)
+		if !ok {
+			return nil, &ToolError{Code: "invalid_sitemap_options", Message: "el campo 'path_prefix' debe ser una cadena"}
+		}
+		if prefix != "" && !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		opts.PathPrefix = prefix
+	}
+
+	for field, target := range map[string]*time.Time{"since": &opts.Since, "until": &opts.Until} {
+		v, ok := payload[field]
+		if !ok || v == nil {
+			continue
+		}
+		value, ok := v.(string)
+		date, valid := parseSitemapDate(value)
+		if !ok || !valid {
+			return nil, &ToolError{Code: "invalid_sitemap_options", Message: fmt.Sprintf("el campo '%s' debe ser una fecha (YYYY-MM-DD o RFC 3339)", field)}
+		}
+		*target = date
+	}
+
+	if v, ok := payload["max_urls"]; ok && v != nil {
+		n, ok := v.(float64)
+		if !ok || n < 1 || n != float64(int(n)) {
+			return nil, &ToolError{Code: "invalid_sitemap_options", Message: "el campo 'max_urls' debe ser un entero positivo"}
+		}
+		opts.MaxURLs = int(n)
+		if opts.MaxURLs > maxSitemapURLs {
+			opts.MaxURLs = maxSitemapURLs
+		}
+	}
+
+	return opts, nil
+}
+
+// isSitemapURL indica si la URL apunta directamente a un sitemap
+func isSitemapURL(u *url.URL) bool {
+	ext := strings.ToLower(path.Ext(u.Path))
+	return ext == ".xml" || ext == ".gz" || strings.Contains(strings.ToLower(u.Path), "sitemap")
+}
+
+// DiscoverSitemaps devuelve los sitemaps declarados en robots.txt y, si no hay
+// ninguno, la ubicación convencional /sitemap.xml
+func DiscoverSitemaps(ctx context.Context, site *url.URL) []string {
+	if isSitemapURL(site) {
+		return []string{site.String()}
+	}
+
+	var sitemaps []string
+	if robots := Robots.Get(ctx, site); robots != nil {
+		sitemaps = append(sitemaps, robots.Sitemaps...)
+	}
+	if len(sitemaps) == 0 {
+		sitemaps = append(sitemaps, site.Scheme+"://"+site.Host+"/sitemap.xml")
+	}
+	return sitemaps
+}
+
+// Sitemap descubre los sitemaps del sitio, expande los índices y devuelve las
+// URLs que cumplen los filtros
+func Sitemap(ctx context.Context, opts *SitemapOptions) (*SitemapResult, error) {
+	site, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, &ToolError{Code: "invalid_url", Message: "URL inválida: " + opts.URL}
+	}
+
+	// Las descargas comparten encabezados, timeout y robots.txt (también en
+	// cada redirección) con webfetch; el XML se analiza sin transcodificar
+	fetchOpts := defaultFetchOptions(opts.RespectRobots)
+	fetchOpts.Accept = "application/xml,text/xml;q=0.9,*/*;q=0.8"
+	fetchOpts.MaxSize = maxSitemapSize
+	fetchOpts.Raw = true
+
+	type pending struct {
+		url   string
+		depth int
+	}
+	queue := []pending{}
+	for _, s := range DiscoverSitemaps(ctx, site) {
+		queue = append(queue, pending{url: s})
+	}
+
+	result := &SitemapResult{Sitemaps: []string{}, URLs: []SitemapURL{}}
+	seen := map[string]bool{}
+
+	for len(queue) > 0 && !result.Truncated {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		current := queue[0]
+		queue = queue[1:]
+		if seen[current.url] {
+			continue
+		}
+		seen[current.url] = true
+
+		if len(result.Sitemaps) >= maxSitemapFiles {
+			result.Truncated = true
+			break
+		}
+
+		doc, err := fetchSitemap(ctx, fetchOpts, current.url)
+		if err != nil {
+			result.Errors = append(result.Errors, SitemapError{URL: current.url, Error: err.Error()})
+			continue
+		}
+		result.Sitemaps = append(result.Sitemaps, current.url)
+
+		// Índice de sitemaps: encolar los hijos
+		for _, child := range doc.Sitemaps {
+			loc := strings.TrimSpace(child.Loc)
+			if loc == "" {
+				continue
+			}
+			if current.depth+1 > maxSitemapNesting {
+				result.Errors = append(result.Errors, SitemapError{URL: loc, Error: "se superó el anidamiento máximo de índices de sitemaps"})
+				continue
+			}
+			queue = append(queue, pending{url: loc, depth: current.depth + 1})
+		}
+
+		for _, entry := range doc.URLs {
+			item, ok := opts.filter(entry)
+			if !ok {
+				continue
+			}
+			if len(result.URLs) >= opts.MaxURLs {
+				result.Truncated = true
+				break
+			}
+			item.Sitemap = current.url
+			result.URLs = append(result.URLs, item)
+		}
+	}
+
+	if len(result.Sitemaps) == 0 {
+		message := "no se encontró ningún sitemap para " + opts.URL
+		if len(result.Errors) > 0 {
+			message += ": " + result.Errors[0].Error
+		}
+		return nil, &ToolError{Code: "sitemap_not_found", Message: message}
+	}
+
+	result.Count = len(result.URLs)
+	return result, nil
+}
+
+// filter aplica los filtros de ruta y fecha a una entrada <url>
+func (o *SitemapOptions) filter(entry sitemapEntry) (SitemapURL, bool) {
+	item := SitemapURL{
+		Loc:        strings.TrimSpace(entry.Loc),
+		LastMod:    strings.TrimSpace(entry.LastMod),
+		ChangeFreq: strings.TrimSpace(entry.ChangeFreq),
+	}
+	if item.Loc == "" {
+		return item, false
+	}
+
+	if o.PathPrefix != "" {
+		parsed, err := url.Parse(item.Loc)
+		if err != nil || !strings.HasPrefix(parsed.Path, o.PathPrefix) {
+			return item, false
+		}
+	}
+
+	// Con filtros de fecha, las entradas sin lastmod válido se descartan
+	if !o.Since.IsZero() || !o.Until.IsZero() {
+		lastMod, ok := parseSitemapDate(item.LastMod)
+		if !ok {
+			return item, false
+		}
+		if !o.Since.IsZero() && lastMod.Before(o.Since) {
+			return item, false
+		}
+		if !o.Until.IsZero() && lastMod.After(o.Until) {
+			return item, false
+		}
+	}
+
+	if entry.Priority != "" {
+		var priority float64
+		if _, err := fmt.Sscanf(strings.TrimSpace(entry.Priority), "%g", &priority); err == nil {
+			item.Priority = &priority
+		}
+	}
+
+	return item, true
+}
+
+// fetchSitemap descarga un sitemap (descomprimiendo gzip si hace falta) y lo analiza
+func fetchSitemap(ctx context.Context, opts *FetchOptions, sitemapURL string) (*sitemapDocument, error) {
+	resp, err := Fetch(ctx, sitemapURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("el servidor respondió con el código %d", resp.StatusCode)
+	}
+	body := resp.Body
+
+	// Los .xml.gz se sirven comprimidos sin Content-Encoding; detectar por los bytes mágicos
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("sitemap gzip inválido: %v", err)
+		}
+		defer reader.Close()
+		body, err = io.ReadAll(io.LimitReader(reader, maxSitemapSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("sitemap gzip inválido: %v", err)
+		}
+	}
+	if len(body) > maxSitemapSize {
+		return nil, fmt.Errorf("el sitemap excede el límite de 50MB")
+	}
+
+	var doc sitemapDocument
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	decoder.CharsetReader = charset.NewReaderLabel
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("XML de sitemap inválido: %v", err)
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("el documento no es un sitemap (raíz <%s>)", doc.XMLName.Local)
+	}
+	return &doc, nil
+}
@@ -0,0 +1,324 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"sort"
+	"strings"
+
+	"github.com/orisano/pixelmatch"
+)
+
+const (
+	// visualDiffCell agrupa los píxeles distintos en celdas para formar regiones
+	visualDiffCell       = 16
+	maxVisualDiffRegions = 50
+	defaultDiffThreshold = 0.1
+
+	// Límites de las imágenes de referencia: se comprueban con la cabecera antes
+	// de decodificar, porque una imagen pequeña puede declarar dimensiones enormes
+	maxBaselineWidth  = 10000
+	maxBaselineHeight = 30000
+	maxBaselinePixels = 40000000
+)
+
+var (
+	// diffPixelColor es el color con el que pixelmatch marca los píxeles distintos
+	diffPixelColor   = color.RGBA{R: 255, A: 255}
+	regionColor      = color.RGBA{R: 255, B: 255, A: 255}
+	ignoredFillColor = color.RGBA{R: 128, G: 128, B: 128, A: 255}
+)
+
+// Region es un rectángulo de la imagen en píxeles
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	Pixels int `json:"pixels,omitempty"`
+}
+
+func (r Region) rect() image.Rectangle {
+	return image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+}
+
+// ImageSize son las dimensiones de una imagen
+type ImageSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// VisualDiffResult es el resultado de comparar una captura con su referencia
+type VisualDiffResult struct {
+	MismatchPercent  float64   `json:"mismatch_percent"`
+	MismatchedPixels int       `json:"mismatched_pixels"`
+	TotalPixels      int       `json:"total_pixels"`
+	BaselineSize     ImageSize `json:"baseline_size"`
+	CurrentSize      ImageSize `json:"current_size"`
+	SizeChanged      bool      `json:"size_changed"`
+	Regions          []Region  `json:"regions"`
+	DiffImage        []byte    `json:"-"`
+}
+
+// ParseIgnoreRegions lee la opción ignore_regions: [{x, y, width, height}, ...]
+func ParseIgnoreRegions(payload map[string]interface{}) ([]Region, error) {
+	raw, ok := payload["ignore_regions"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, &ToolError{Code: "invalid_ignore_regions", Message: "'ignore_regions' debe ser una lista de objetos {x, y, width, height}"}
+	}
+
+	var regions []Region
+	for i, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, &ToolError{Code: "invalid_ignore_regions", Message: fmt.Sprintf("la región %d debe ser un objeto {x, y, width, height}", i)}
+		}
+		values := map[string]int{}
+		for _, field := range []string{"x", "y", "width", "height"} {
+			n, ok := obj[field].(float64)
+			if !ok || n < 0 || n != float64(int(n)) {
+				return nil, &ToolError{Code: "invalid_ignore_regions", Message: fmt.Sprintf("la región %d necesita '%s' como entero no negativo", i, field)}
+			}
+			values[field] = int(n)
+		}
+		if values["width"] == 0 || values["height"] == 0 {
+			return nil, &ToolError{Code: "invalid_ignore_regions", Message: fmt.Sprintf("la región %d tiene tamaño cero", i)}
+		}
+		regions = append(regions, Region{X: values["x"], Y: values["y"], Width: values["width"], Height: values["height"]})
+	}
+	return regions, nil
+}
+
+// DecodeBase64Image decodifica una imagen en base64, aceptando también data URIs
+func DecodeBase64Image(encoded string) ([]byte, error) {
+	if strings.HasPrefix(encoded, "data:") {
+		if comma := strings.Index(encoded, ","); comma >= 0 {
+			encoded = encoded[comma+1:]
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, &ToolError{Code: "invalid_baseline_image", Message: "la imagen de referencia no es base64 válido"}
+	}
+	if err := checkBaselineSize(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// checkBaselineSize lee solo la cabecera de la imagen de referencia y rechaza
+// las que no son PNG o JPEG o superan las dimensiones máximas
+func checkBaselineSize(data []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return &ToolError{Code: "invalid_baseline_image", Message: "la imagen de referencia no es un PNG o JPEG válido"}
+	}
+	if cfg.Width > maxBaselineWidth || cfg.Height > maxBaselineHeight || cfg.Width*cfg.Height > maxBaselinePixels {
+		return &ToolError{Code: "baseline_image_too_large", Message: fmt.Sprintf("la imagen de referencia mide %dx%d; el máximo es %dx%d y %d píxeles", cfg.Width, cfg.Height, maxBaselineWidth, maxBaselineHeight, maxBaselinePixels)}
+	}
+	return nil
+}
+
+// opaqueImage oculta el tipo concreto de la imagen a pixelmatch: su atajo para
+// imágenes idénticas solo compara la primera cuarta parte de cada fila de un
+// *image.RGBA y da por iguales imágenes que no lo son
+type opaqueImage struct {
+	image.Image
+}
+
+// padImage copia la imagen sobre un lienzo blanco del tamaño indicado y
+// rellena las regiones ignoradas con un color neutro
+func padImage(src image.Image, width, height int, ignore []Region) *image.RGBA {
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(canvas, src.Bounds().Sub(src.Bounds().Min), src, src.Bounds().Min, draw.Src)
+	for _, region := range ignore {
+		draw.Draw(canvas, region.rect().Intersect(canvas.Bounds()), &image.Uniform{C: ignoredFillColor}, image.Point{}, draw.Src)
+	}
+	return canvas
+}
+
+// CompareImages compara dos imágenes con pixelmatch y devuelve el porcentaje
+// de diferencia, las regiones cambiadas y una imagen con las diferencias resaltadas.
+// threshold (0-1) es la sensibilidad por píxel; si las dimensiones difieren, el
+// área que no se solapa cuenta como diferencia.
+func CompareImages(baseline, current []byte, threshold float64, ignore []Region) (*VisualDiffResult, error) {
+	if err := checkBaselineSize(baseline); err != nil {
+		return nil, err
+	}
+	baseImg, _, err := image.Decode(bytes.NewReader(baseline))
+	if err != nil {
+		return nil, &ToolError{Code: "invalid_baseline_image", Message: "no se pudo decodificar la imagen de referencia: " + err.Error()}
+	}
+	currImg, _, err := image.Decode(bytes.NewReader(current))
+	if err != nil {
+		return nil, &ToolError{Code: "invalid_image", Message: "no se pudo decodificar la captura: " + err.Error()}
+	}
+	if threshold <= 0 {
+		threshold = defaultDiffThreshold
+	}
+
+	result := &VisualDiffResult{
+		BaselineSize: ImageSize{Width: baseImg.Bounds().Dx(), Height: baseImg.Bounds().Dy()},
+		CurrentSize:  ImageSize{Width: currImg.Bounds().Dx(), Height: currImg.Bounds().Dy()},
+		Regions:      []Region{},
+	}
+	result.SizeChanged = result.BaselineSize != result.CurrentSize
+
+	width := result.BaselineSize.Width
+	if result.CurrentSize.Width > width {
+		width = result.CurrentSize.Width
+	}
+	height := result.BaselineSize.Height
+	if result.CurrentSize.Height > height {
+		height = result.CurrentSize.Height
+	}
+
+	a := padImage(baseImg, width, height, ignore)
+	b := padImage(currImg, width, height, ignore)
+
+	var out image.Image
+	if _, err := pixelmatch.MatchPixel(opaqueImage{a}, opaqueImage{b}, pixelmatch.Threshold(threshold), pixelmatch.WriteTo(&out), pixelmatch.DiffColor(diffPixelColor)); err != nil {
+		return nil, &ToolError{Code: "visual_diff_failed", Message: err.Error()}
+	}
+	// Con imágenes idénticas pixelmatch no genera imagen de salida
+	identical := out == nil
+	if identical {
+		out = a
+	}
+	diffImg := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(diffImg, diffImg.Bounds(), out, image.Point{}, draw.Src)
+
+	// El área fuera de la intersección de ambas imágenes también es diferencia
+	overlap := image.Rect(0, 0, result.BaselineSize.Width, result.BaselineSize.Height).
+		Intersect(image.Rect(0, 0, result.CurrentSize.Width, result.CurrentSize.Height))
+
+	cols := (width + visualDiffCell - 1) / visualDiffCell
+	rows := (height + visualDiffCell - 1) / visualDiffCell
+	cells := make([]int, cols*rows)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			mismatch := !identical && diffImg.RGBAAt(x, y) == diffPixelColor
+			if point := (image.Point{X: x, Y: y}); !point.In(overlap) {
+				mismatch = true
+				for _, region := range ignore {
+					if point.In(region.rect()) {
+						mismatch = false
+						break
+					}
+				}
+				if mismatch {
+					diffImg.SetRGBA(x, y, diffPixelColor)
+				}
+			}
+			if mismatch {
+				result.MismatchedPixels++
+				cells[(y/visualDiffCell)*cols+x/visualDiffCell]++
+			}
+		}
+	}
+
+	result.TotalPixels = width * height
+	if result.TotalPixels > 0 {
+		result.MismatchPercent = float64(result.MismatchedPixels) * 100 / float64(result.TotalPixels)
+	}
+	result.Regions = diffRegions(cells, cols, rows, width, height)
+
+	// Resaltar las regiones con un rectángulo
+	for _, region := range result.Regions {
+		outlineRect(diffImg, region.rect(), regionColor)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, diffImg); err != nil {
+		return nil, &ToolError{Code: "visual_diff_failed", Message: err.Error()}
+	}
+	result.DiffImage = buf.Bytes()
+	return result, nil
+}
+
+// diffRegions agrupa las celdas con diferencias contiguas (8-vecindad) en rectángulos
+func diffRegions(cells []int, cols, rows, width, height int) []Region {
+	visited := make([]bool, len(cells))
+	var regions []Region
+
+	for start := range cells {
+		if cells[start] == 0 || visited[start] {
+			continue
+		}
+		minX, minY, maxX, maxY := cols, rows, -1, -1
+		pixels := 0
+		queue := []int{start}
+		visited[start] = true
+		for len(queue) > 0 {
+			cell := queue[0]
+			queue = queue[1:]
+			cx, cy := cell%cols, cell/cols
+			pixels += cells[cell]
+			if cx < minX {
+				minX = cx
+			}
+			if cy < minY {
+				minY = cy
+			}
+			if cx > maxX {
+				maxX = cx
+			}
+			if cy > maxY {
+				maxY = cy
+			}
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := cx+dx, cy+dy
+					if nx < 0 || ny < 0 || nx >= cols || ny >= rows {
+						continue
+					}
+					next := ny*cols + nx
+					if cells[next] > 0 && !visited[next] {
+						visited[next] = true
+						queue = append(queue, next)
+					}
+				}
+			}
+		}
+
+		rect := image.Rect(minX*visualDiffCell, minY*visualDiffCell, (maxX+1)*visualDiffCell, (maxY+1)*visualDiffCell).
+			Intersect(image.Rect(0, 0, width, height))
+		regions = append(regions, Region{X: rect.Min.X, Y: rect.Min.Y, Width: rect.Dx(), Height: rect.Dy(), Pixels: pixels})
+	}
+
+	// Las regiones con más píxeles distintos primero
+	sort.SliceStable(regions, func(i, j int) bool { return regions[i].Pixels > regions[j].Pixels })
+	if len(regions) > maxVisualDiffRegions {
+		regions = regions[:maxVisualDiffRegions]
+	}
+	if regions == nil {
+		regions = []Region{}
+	}
+	return regions
+}
+
+// outlineRect dibuja el borde de un rectángulo de 2 píxeles de grosor
+func outlineRect(img *image.RGBA, rect image.Rectangle, c color.RGBA) {
+	rect = rect.Intersect(img.Bounds())
+	for t := 0; t < 2; t++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.SetRGBA(x, rect.Min.Y+t, c)
+			img.SetRGBA(x, rect.Max.Y-1-t, c)
+		}
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			img.SetRGBA(rect.Min.X+t, y, c)
+			img.SetRGBA(rect.Max.X-1-t, y, c)
+		}
+	}
+}
@@ -1,9 +1,9 @@
 package tools
 
 import (
-	"bytes"
-	"io"
-	"net/http"
+	"context"
+	"encoding/json"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -46,62 +46,50 @@ func WebFetch(payload map[string]interface{}) (interface{}, error) {
 		}
 	}
 
-	// Parse timeout (in seconds)
-	timeout := defaultTimeout
-	if t, ok := payload["timeout"].(float64); ok && t > 0 {
-		timeout = time.Duration(t) * time.Second
-		if timeout > maxTimeout {
-			timeout = maxTimeout
-		}
-	}
-
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: timeout,
-	}
-
-	// Create request with headers
-	req, err := http.NewRequest("GET", url, nil)
+	// Parse fetch options (timeout, request, redirects, respect_robots)
+	fetchOptions, err := ParseFetchOptions(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
-
-	// Send request
-	resp, err := client.Do(req)
+	resp, err := Fetch(context.Background(), url, fetchOptions)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
 	// Check status code
 	if resp.StatusCode >= 400 {
 		return nil, &ToolError{Message: "Request failed with status code: " + strconv.Itoa(resp.StatusCode)}
 	}
 
-	// Check content length
-	if contentLength := resp.Header.Get("Content-Length"); contentLength != "" {
-		if size, err := strconv.ParseInt(contentLength, 10, 64); err == nil && size > maxResponseSize {
-			return nil, &ToolError{Message: "Response too large (exceeds 5MB limit)"}
+	content := resp.Body
+	contentType := resp.ContentType
+
+	// Return the extracted text of PDF and Office documents instead of binary
+	if doc := resp.Document; doc != nil {
+		output := doc.Text
+		if format == "markdown" {
+			output = doc.Markdown
 		}
-	}
 
-	// Read response with size limit
-	var buf bytes.Buffer
-	limitedReader := io.LimitReader(resp.Body, maxResponseSize+1)
-	written, err := io.Copy(&buf, limitedReader)
-	if err != nil {
-		return nil, err
-	}
-	if written > maxResponseSize {
-		return nil, &ToolError{Message: "Response too large (exceeds 5MB limit)"}
-	}
+		metadata := map[string]string{
+			"title": url + " (" + contentType + ")",
+		}
+		addRedirectMetadata(metadata, resp)
+		for k, v := range doc.Metadata {
+			switch value := v.(type) {
+			case []string:
+				metadata[k] = strings.Join(value, ", ")
+			default:
+				metadata[k] = fmt.Sprint(value)
+			}
+		}
 
-	content := buf.Bytes()
-	contentType := resp.Header.Get("Content-Type")
+		return WebFetchResult{
+			Output:   output,
+			Metadata: metadata,
+		}, nil
+	}
 
 	// Process content based on format
 	var output string
@@ -142,10 +130,23 @@ func WebFetch(payload map[string]interface{}) (interface{}, error) {
 			"title": url + " (" + contentType + ")",
 		},
 	}
+	addRedirectMetadata(result.Metadata, resp)
+	if resp.Charset != "" {
+		result.Metadata["charset"] = resp.Charset
+		result.Metadata["charset_source"] = resp.CharsetSource
+	}
 
 	return result, nil
 }
 
+// addRedirectMetadata adds the final URL and the JSON-encoded redirect chain
+func addRedirectMetadata(metadata map[string]string, resp *FetchResponse) {
+	metadata["final_url"] = resp.FinalURL.String()
+	if chain, err := json.Marshal(resp.RedirectChain); err == nil {
+		metadata["redirect_chain"] = string(chain)
+	}
+}
+
 func extractTextFromHTML(html []byte) (string, error) {
 	// First, sanitize HTML to remove scripts, styles, etc.
 	p := bluemonday.StrictPolicy()
@@ -181,6 +182,7 @@ func convertHTMLToMarkdown(html []byte) (string, error) {
 }
 
 type ToolError struct {
+	Code    string
 	Message string
 }
 